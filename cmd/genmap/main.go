@@ -0,0 +1,124 @@
+// Command genmap generates maps without starting the game, so generators
+// can be tuned by reviewing many seeds offline. For every seed it writes
+// the terrain file, an ASCII dump and a PNG preview to the output
+// directory, named after the generator and the seed:
+//
+//	genmap -generator caves -seed 1 -count 100 -params '{"WallChance": 0.42}' -out maps
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+	"github.com/dwethmar/apostle/terrain/prefab"
+)
+
+func main() {
+	generatorName := flag.String("generator", "rooms", fmt.Sprintf("generator of the maps, one of %v", generate.Names()))
+	params := flag.String("params", "", `parameters of the generator as a JSON object, such as '{"WallChance": 0.42}' for caves`)
+	seed := flag.Uint64("seed", 0, "seed of the first map, a random seed is picked when it is not set")
+	count := flag.Int("count", 1, "number of maps to generate, from consecutive seeds")
+	width := flag.Int("width", 60, "width of the maps in cells")
+	height := flag.Int("height", 40, "height of the maps in cells")
+	prefabs := flag.Int("prefabs", 0, "number of builtin prefabs to stamp into every map")
+	repair := flag.Bool("repair", false, "connect the pockets that can not be reached")
+	cellSize := flag.Int("cell", 8, "size of a cell in the PNG previews in pixels")
+	out := flag.String("out", ".", "directory the maps are written to")
+	flag.Parse()
+
+	g, err := generate.Lookup(*generatorName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if g, err = withParams(g, *params); err != nil {
+		log.Fatal(err)
+	}
+	opts := []generate.Option{generate.WithGenerator(g)}
+	if *prefabs > 0 {
+		builtin, err := prefab.Builtin()
+		if err != nil {
+			log.Fatalf("failed to load prefabs: %v", err)
+		}
+		opts = append(opts, generate.WithPrefabs(*prefabs, builtin...))
+	}
+	if *repair {
+		opts = append(opts, generate.WithRepair())
+	}
+
+	first := rand.Uint64()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			first = *seed
+		}
+	})
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	for i := range uint64(max(*count, 0)) {
+		s := first + i
+		t := terrain.New(*width, *height)
+		result, err := generate.Generate(t, append(opts, generate.WithSeed(s))...)
+		if err != nil {
+			log.Fatalf("failed to generate map with seed %d: %v", s, err)
+		}
+		level := result.Levels[0]
+		base := filepath.Join(*out, fmt.Sprintf("%s-%d", *generatorName, s))
+		if err := write(base, t, level.Spawns, *cellSize); err != nil {
+			log.Fatalf("failed to write map with seed %d: %v", s, err)
+		}
+		fmt.Printf("%s: %d rooms, %d prefabs, %d pockets, %d repaired\n",
+			base, len(level.Rooms), len(level.Prefabs), len(level.Pockets), level.Repaired)
+	}
+}
+
+// withParams returns a copy of the generator with the fields in the JSON
+// object params set. Fields that are not in params keep their value.
+func withParams(g generate.Generator, params string) (generate.Generator, error) {
+	if params == "" {
+		return g, nil
+	}
+	v := reflect.New(reflect.TypeOf(g))
+	v.Elem().Set(reflect.ValueOf(g))
+	dec := json.NewDecoder(strings.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid parameters for %T: %w", g, err)
+	}
+	return v.Elem().Interface().(generate.Generator), nil
+}
+
+// write writes the terrain file, the ASCII dump and the PNG preview of the
+// map to base with the extensions .terrain, .txt and .png.
+func write(base string, t *terrain.Terrain, spawns []ascii.Spawn, cellSize int) error {
+	files := map[string]func(w io.Writer) error{
+		".terrain": t.Save,
+		".txt":     func(w io.Writer) error { return ascii.Print(w, t, spawns) },
+		".png":     func(w io.Writer) error { return png.Encode(w, render(t, spawns, cellSize)) },
+	}
+	for ext, write := range files {
+		f, err := os.Create(base + ext)
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write %s: %w", f.Name(), err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/dwethmar/apostle/system/world/palette"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+)
+
+// render draws the terrain and the spawns the way the world draws them,
+// with every cell size by size pixels.
+func render(t *terrain.Terrain, spawns []ascii.Spawn, size int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, t.Width()*size, t.Height()*size))
+	fill := func(r image.Rectangle, c color.Color) {
+		draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Over)
+	}
+	// walls are drawn on both sides of the edge, doors are thicker
+	wall, door := max(size/16, 1), max(size/8, 1)
+
+	for s := range t.Walk() {
+		cell := image.Rect(s.X*size, s.Y*size, (s.X+1)*size, (s.Y+1)*size)
+		if s.Cell&terrain.Solid != 0 {
+			fill(cell, palette.Solid)
+		} else {
+			fill(cell, s.Material.Color())
+			if s.Biome == terrain.Forest {
+				fill(cell, palette.Forest)
+			}
+		}
+
+		if s.Cell&terrain.Stairs != 0 {
+			for y := cell.Min.Y + 2; y < cell.Max.Y; y += 4 {
+				fill(image.Rect(cell.Min.X+2, y, cell.Max.X-2, y+1), palette.Stairs)
+			}
+		}
+
+		for _, border := range s.Cell.Walls() {
+			r := cell
+			switch border {
+			case terrain.BorderNorth:
+				r.Max.Y = r.Min.Y + wall
+			case terrain.BorderSouth:
+				r.Min.Y = r.Max.Y - wall
+			case terrain.BorderWest:
+				r.Max.X = r.Min.X + wall
+			case terrain.BorderEast:
+				r.Min.X = r.Max.X - wall
+			}
+			fill(r, palette.Border)
+		}
+
+		drawDoor(fill, cell, s.DoorNorth, false, door)
+		drawDoor(fill, cell, s.DoorWest, true, door)
+	}
+
+	for _, s := range spawns {
+		c, ok := palette.Spawn(s.Name)
+		if !ok {
+			continue
+		}
+		cell := image.Rect(s.P.X*size, s.P.Y*size, (s.P.X+1)*size, (s.P.Y+1)*size)
+		drawSpawn(img, cell, s.Name, c)
+	}
+	return img
+}
+
+// drawDoor draws a door on the north edge of the cell, or on the west edge
+// if west is true. Open doors are drawn as a gap in the frame.
+func drawDoor(fill func(image.Rectangle, color.Color), cell image.Rectangle, state terrain.DoorState, west bool, width int) {
+	var c color.Color
+	switch state {
+	case terrain.DoorOpen:
+		c = palette.DoorOpen
+	case terrain.DoorClosed:
+		c = palette.DoorClosed
+	case terrain.DoorLocked:
+		c = palette.DoorLocked
+	default:
+		return
+	}
+	// the door lies across the edge from from to to
+	edge := func(from, to int) image.Rectangle {
+		if west {
+			return image.Rect(cell.Min.X-width, cell.Min.Y+from, cell.Min.X+width, cell.Min.Y+to)
+		}
+		return image.Rect(cell.Min.X+from, cell.Min.Y-width, cell.Min.X+to, cell.Min.Y+width)
+	}
+	size := cell.Dx()
+	if state == terrain.DoorOpen {
+		// only the ends of the frame
+		fill(edge(0, size/4), c)
+		fill(edge(size-size/4, size), c)
+		return
+	}
+	fill(edge(0, size), c)
+}
+
+// drawSpawn draws the entity of the named blueprint in the cell: humans as
+// a diamond, stones as a small dot and anything else as a large dot.
+func drawSpawn(img *image.RGBA, cell image.Rectangle, name string, c color.RGBA) {
+	size := float64(cell.Dx())
+	cx, cy := float64(cell.Min.X)+size/2, float64(cell.Min.Y)+size/2
+	inside := func(x, y float64) bool {
+		r := 0.4 * size
+		if name == "stone" {
+			r = 0.25 * size
+		}
+		return (x-cx)*(x-cx)+(y-cy)*(y-cy) <= r*r
+	}
+	if name == "human" {
+		w, h := 0.57*size, 0.9*size
+		inside = func(x, y float64) bool {
+			return abs(x-cx)/(w/2)+abs(y-cy)/(h/2) <= 1
+		}
+	}
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			if inside(float64(x)+0.5, float64(y)+0.5) {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
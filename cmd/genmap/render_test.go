@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dwethmar/apostle/system/world/palette"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+func TestRender(t *testing.T) {
+	tr, spawns := ascii.MustParse(`
+D = door-west=closed
+#.>.
+.D.@
+`)
+	const size = 16
+	img := render(tr, spawns, size)
+	if got := img.Bounds().Size(); got.X != 4*size || got.Y != 2*size {
+		t.Fatalf("size = %v, want %dx%d", got, 4*size, 2*size)
+	}
+
+	tests := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"solid", size / 2, size / 2, palette.Solid},
+		{"floor", size + size/2, size / 2, tr.Material(1, 0).Color()},
+		{"border", 3*size - 1, size / 2, palette.Border},
+		{"border on the other side", 3 * size, size / 2, palette.Border},
+		{"door", size, size + size/2, palette.DoorClosed},
+		{"spawn", 3*size + size/2, size + size/2, palette.Entity},
+	}
+	for _, tt := range tests {
+		if got := img.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("%s: pixel (%d, %d) = %v, want %v", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	src := terrain.New(30, 20)
+	result, err := generate.Generate(src, generate.WithSeed(1))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	base := filepath.Join(t.TempDir(), "rooms-1")
+	if err := write(base, src, result.Levels[0].Spawns, 8); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	f, err := os.Open(base + ".terrain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dst := terrain.New(30, 20)
+	if err := dst.Load(f); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !slices.Equal(slices.Collect(dst.Walk()), slices.Collect(src.Walk())) {
+		t.Errorf("the written terrain does not load back to the generated terrain")
+	}
+
+	for _, ext := range []string{".txt", ".png"} {
+		if _, err := os.Stat(base + ext); err != nil {
+			t.Errorf("Stat() error = %v", err)
+		}
+	}
+}
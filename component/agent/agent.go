@@ -8,10 +8,18 @@ type Goal uint
 const (
 	None Goal = iota
 	MoveAdjacentToTarget
+	WorkOnJob // go to the job of the target entity and work on it
 )
 
 const NoTargetID = -1
 
+// Faction groups agents that share what they have seen of the world.
+type Faction int
+
+// PlayerFaction is the faction of the player, and of every agent that is not
+// given another one.
+const PlayerFaction Faction = 0
+
 // Agent represents an entity that can perform actions and has a state.
 // It can target other entities and has a state machine for its behavior.
 // ideas:
@@ -20,6 +28,7 @@ type Agent struct {
 	entityID                 int
 	goal                     Goal
 	targetEntityID           int                              // ID of the entity that this agent targets
+	faction                  Faction                          // faction the agent shares what it sees with
 	emitTargetEntitySetEvent func(*TargetEntityAcquiredEvent) // Event handler for when a target entity is acquired
 }
 
@@ -33,6 +42,7 @@ func WithEmitTargetEntityAcquiredEvent(handler func(*TargetEntityAcquiredEvent))
 
 func NewAgent(entityID int, opts ...AgentOption) *Agent {
 	a := &Agent{
+		entityID:       entityID,
 		goal:           None,
 		targetEntityID: NoTargetID,
 	}
@@ -50,6 +60,14 @@ func (a *Agent) ComponentType() string {
 	return Type
 }
 
+func (a *Agent) Faction() Faction {
+	return a.faction
+}
+
+func (a *Agent) SetFaction(f Faction) {
+	a.faction = f
+}
+
 func (a *Agent) SetGoal(goal Goal) {
 	a.goal = goal
 }
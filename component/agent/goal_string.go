@@ -10,11 +10,12 @@ func _() {
 	var x [1]struct{}
 	_ = x[None-0]
 	_ = x[MoveAdjacentToTarget-1]
+	_ = x[WorkOnJob-2]
 }
 
-const _Goal_name = "NoneMoveAdjacentToTarget"
+const _Goal_name = "NoneMoveAdjacentToTargetWorkOnJob"
 
-var _Goal_index = [...]uint8{0, 4, 24}
+var _Goal_index = [...]uint8{0, 4, 24, 33}
 
 func (i Goal) String() string {
 	if i >= Goal(len(_Goal_index)-1) {
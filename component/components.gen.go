@@ -4,6 +4,7 @@ package component
 import (
 	"fmt"
 	agent "github.com/dwethmar/apostle/component/agent"
+	job "github.com/dwethmar/apostle/component/job"
 	kind "github.com/dwethmar/apostle/component/kind"
 	movement "github.com/dwethmar/apostle/component/movement"
 	path "github.com/dwethmar/apostle/component/path"
@@ -14,6 +15,7 @@ import (
 type Store struct {
 	mu       sync.RWMutex
 	agent    []*agent.Agent
+	job      []*job.Job
 	kind     []*kind.Kind
 	movement []*movement.Movement
 	path     []*path.Path
@@ -22,6 +24,7 @@ type Store struct {
 func NewStore() *Store {
 	return &Store{
 		agent:    make([]*agent.Agent, 0),
+		job:      make([]*job.Job, 0),
 		kind:     make([]*kind.Kind, 0),
 		movement: make([]*movement.Movement, 0),
 		path:     make([]*path.Path, 0),
@@ -35,6 +38,14 @@ func (s *Store) AgentEntries() []*agent.Agent {
 	return r
 }
 
+func (s *Store) JobEntries() []*job.Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := make([]*job.Job, len(s.job))
+	copy(r, s.job)
+	return r
+}
+
 func (s *Store) KindEntries() []*kind.Kind {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -65,6 +76,12 @@ func (s *Store) addAgent(c *agent.Agent) {
 	s.mu.Unlock()
 }
 
+func (s *Store) addJob(c *job.Job) {
+	s.mu.Lock()
+	s.job = append(s.job, c)
+	s.mu.Unlock()
+}
+
 func (s *Store) addKind(c *kind.Kind) {
 	s.mu.Lock()
 	s.kind = append(s.kind, c)
@@ -93,6 +110,16 @@ func (s *Store) removeAgent(c *agent.Agent) {
 	s.agent = slices.Delete(s.agent, i, i+1)
 }
 
+func (s *Store) removeJob(c *job.Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.Index(s.job, c)
+	if i == -1 {
+		return
+	}
+	s.job = slices.Delete(s.job, i, i+1)
+}
+
 func (s *Store) removeKind(c *kind.Kind) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -126,6 +153,7 @@ func (s *Store) removePath(c *path.Path) {
 type Components struct {
 	store    *Store
 	agent    *agent.Agent
+	job      *job.Job
 	kind     *kind.Kind
 	movement *movement.Movement
 	path     *path.Path
@@ -148,6 +176,17 @@ func (o *Components) SetAgent(c *agent.Agent) error {
 	return nil
 }
 
+func (o *Components) SetJob(c *job.Job) error {
+	if o.job != nil {
+		return fmt.Errorf("component job already set")
+	}
+	o.job = c
+	if o.store != nil {
+		o.store.addJob(c)
+	}
+	return nil
+}
+
 func (o *Components) SetKind(c *kind.Kind) error {
 	if o.kind != nil {
 		return fmt.Errorf("component kind already set")
@@ -182,6 +221,7 @@ func (o *Components) SetPath(c *path.Path) error {
 }
 
 func (o *Components) Agent() *agent.Agent          { return o.agent }
+func (o *Components) Job() *job.Job                { return o.job }
 func (o *Components) Kind() *kind.Kind             { return o.kind }
 func (o *Components) Movement() *movement.Movement { return o.movement }
 func (o *Components) Path() *path.Path             { return o.path }
@@ -198,6 +238,18 @@ func (o *Components) RemoveAgent() *agent.Agent {
 	return c
 }
 
+func (o *Components) RemoveJob() *job.Job {
+	c := o.job
+	if c == nil {
+		return nil
+	}
+	if o.store != nil {
+		o.store.removeJob(c)
+	}
+	o.job = nil
+	return c
+}
+
 func (o *Components) RemoveKind() *kind.Kind {
 	c := o.kind
 	if c == nil {
@@ -236,6 +288,7 @@ func (o *Components) RemovePath() *path.Path {
 
 func (o *Components) RemoveAll() {
 	o.RemoveAgent()
+	o.RemoveJob()
 	o.RemoveKind()
 	o.RemoveMovement()
 	o.RemovePath()
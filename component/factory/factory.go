@@ -2,6 +2,7 @@ package factory
 
 import (
 	"github.com/dwethmar/apostle/component/agent"
+	"github.com/dwethmar/apostle/component/job"
 	"github.com/dwethmar/apostle/component/kind"
 	"github.com/dwethmar/apostle/component/movement"
 	"github.com/dwethmar/apostle/component/path"
@@ -38,3 +39,7 @@ func (f *Factory) NewPathComponent(entityID int) *path.Path {
 func (f *Factory) NewKindComponent(entityID int) *kind.Kind {
 	return kind.NewComponent(entityID)
 }
+
+func (f *Factory) NewJobComponent(entityID int) *job.Job {
+	return job.NewComponent(entityID)
+}
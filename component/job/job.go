@@ -0,0 +1,102 @@
+package job
+
+import (
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+)
+
+const Type = "Job"
+
+//go:generate go tool stringer -type=Kind
+type Kind uint
+
+const (
+	None  Kind = iota
+	Dig        // dig out a Solid cell
+	Build      // build a wall in the cell, or a border on one of its edges
+)
+
+const NoWorker = -1
+
+// Job is work that an agent does at a cell, such as digging it out. The
+// agent works from a cell next to it until no work is left; the system that
+// owns the kind of job then applies the result.
+type Job struct {
+	entityID int
+	kind     Kind
+	cell     point.P             // cell that is worked on
+	side     direction.Direction // edge of the cell that is worked on, None for the whole cell
+	work     int                 // ticks of work that are left
+	workerID int                 // ID of the agent entity that does the job
+}
+
+func NewComponent(entityID int) *Job {
+	return &Job{
+		entityID: entityID,
+		side:     direction.None,
+		workerID: NoWorker,
+	}
+}
+
+func (j *Job) EntityID() int {
+	return j.entityID
+}
+
+func (j *Job) ComponentType() string {
+	return Type
+}
+
+func (j *Job) Kind() Kind {
+	return j.kind
+}
+
+func (j *Job) SetKind(k Kind) {
+	j.kind = k
+}
+
+func (j *Job) Cell() point.P {
+	return j.cell
+}
+
+func (j *Job) SetCell(p point.P) {
+	j.cell = p
+}
+
+// Side returns the edge of the cell that is worked on, or direction.None if
+// the job is about the whole cell.
+func (j *Job) Side() direction.Direction {
+	return j.side
+}
+
+func (j *Job) SetSide(d direction.Direction) {
+	j.side = d
+}
+
+// SetWork sets the number of ticks of work that are left.
+func (j *Job) SetWork(ticks int) {
+	j.work = ticks
+}
+
+// Work does a tick of work.
+func (j *Job) Work() {
+	if j.work > 0 {
+		j.work--
+	}
+}
+
+// Done reports whether no work is left.
+func (j *Job) Done() bool {
+	return j.work <= 0
+}
+
+func (j *Job) WorkerID() int {
+	return j.workerID
+}
+
+func (j *Job) HasWorker() bool {
+	return j.workerID != NoWorker
+}
+
+func (j *Job) SetWorker(entityID int) {
+	j.workerID = entityID
+}
@@ -9,6 +9,9 @@ const (
 	None Value = iota
 	Human
 	Apple
+	DigSite // cell that is designated to be dug out
+	Stone   // stone left behind by digging
+	Ghost   // wall that is yet to be built
 )
 
 type Kind struct {
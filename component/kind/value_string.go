@@ -11,11 +11,14 @@ func _() {
 	_ = x[None-0]
 	_ = x[Human-1]
 	_ = x[Apple-2]
+	_ = x[DigSite-3]
+	_ = x[Stone-4]
+	_ = x[Ghost-5]
 }
 
-const _Value_name = "NoneHumanApple"
+const _Value_name = "NoneHumanAppleDigSiteStoneGhost"
 
-var _Value_index = [...]uint8{0, 4, 9, 14}
+var _Value_index = [...]uint8{0, 4, 9, 14, 21, 26, 31}
 
 func (i Value) String() string {
 	if i >= Value(len(_Value_index)-1) {
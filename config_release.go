@@ -5,4 +5,5 @@ package main
 const (
 	windowWidth  = 800
 	windowHeight = 800
+	mapGenerator = "rooms" // name of the generator of the map, see generate.Names
 )
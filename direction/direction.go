@@ -15,4 +15,78 @@ const (
 	NorthWest
 	SouthEast
 	SouthWest
+	Up   // to the level above
+	Down // to the level below
 )
+
+// Delta returns the change in coordinates when moving one cell in the direction.
+func (d Direction) Delta() (dx, dy, dz int) {
+	// a switch instead of a map, this is on the path of every move
+	switch d {
+	case North:
+		return 0, -1, 0
+	case South:
+		return 0, 1, 0
+	case East:
+		return 1, 0, 0
+	case West:
+		return -1, 0, 0
+	case NorthEast:
+		return 1, -1, 0
+	case NorthWest:
+		return -1, -1, 0
+	case SouthEast:
+		return 1, 1, 0
+	case SouthWest:
+		return -1, 1, 0
+	case Up:
+		return 0, 0, 1
+	case Down:
+		return 0, 0, -1
+	}
+	return 0, 0, 0
+}
+
+// FromDelta returns the direction of a move by (dx, dy, dz), where every
+// component is -1, 0 or 1. It returns None for anything else.
+func FromDelta(dx, dy, dz int) Direction {
+	for _, d := range all {
+		if x, y, z := d.Delta(); x == dx && y == dy && z == dz {
+			return d
+		}
+	}
+	return None
+}
+
+// all are the directions that move.
+var all = [...]Direction{North, South, East, West, NorthEast, NorthWest, SouthEast, SouthWest, Up, Down}
+
+// Opposite returns the direction pointing the other way.
+func (d Direction) Opposite() Direction {
+	dx, dy, dz := d.Delta()
+	if dx == 0 && dy == 0 && dz == 0 {
+		return None
+	}
+	return FromDelta(-dx, -dy, -dz)
+}
+
+// Diagonal reports whether the direction is one of the four diagonals.
+func (d Direction) Diagonal() bool {
+	return d == NorthEast || d == NorthWest || d == SouthEast || d == SouthWest
+}
+
+// Split returns the vertical (North or South) and horizontal (East or West)
+// parts of a diagonal direction. Other directions return None twice.
+func (d Direction) Split() (vertical, horizontal Direction) {
+	switch d {
+	case NorthEast:
+		return North, East
+	case NorthWest:
+		return North, West
+	case SouthEast:
+		return South, East
+	case SouthWest:
+		return South, West
+	}
+	return None, None
+}
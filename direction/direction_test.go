@@ -0,0 +1,33 @@
+package direction
+
+import "testing"
+
+func TestFromDelta(t *testing.T) {
+	for _, d := range all {
+		dx, dy, dz := d.Delta()
+		if got := FromDelta(dx, dy, dz); got != d {
+			t.Errorf("FromDelta(%d, %d, %d) = %d, want %d", dx, dy, dz, got, d)
+		}
+	}
+	if got := FromDelta(2, 0, 0); got != None {
+		t.Errorf("FromDelta(2, 0, 0) = %d, want None", got)
+	}
+}
+
+func TestDirection_Opposite(t *testing.T) {
+	tests := []struct {
+		d, want Direction
+	}{
+		{North, South},
+		{East, West},
+		{NorthEast, SouthWest},
+		{SouthEast, NorthWest},
+		{Up, Down},
+		{None, None},
+	}
+	for _, tt := range tests {
+		if got := tt.d.Opposite(); got != tt.want {
+			t.Errorf("%d.Opposite() = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
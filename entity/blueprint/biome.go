@@ -0,0 +1,40 @@
+package blueprint
+
+import (
+	"math/rand/v2"
+
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// biomeSpawn is an entity that is created on a cell of a biome with the
+// given chance.
+type biomeSpawn struct {
+	chance float64
+	create func(p point.P, s *entity.Store, componentFactory *factory.Factory) (*entity.Entity, error)
+}
+
+// biomeSpawns are the entities that belong in every biome.
+var biomeSpawns = map[terrain.Biome][]biomeSpawn{
+	terrain.Grassland: {{chance: 0.002, create: NewApple}},
+	terrain.Forest:    {{chance: 0.02, create: NewApple}},
+}
+
+// NewBiomeSpawns creates the entities that belong in the biome at the pixel
+// position p, such as apples in a forest. r decides which of them are created.
+func NewBiomeSpawns(p point.P, b terrain.Biome, r *rand.Rand, s *entity.Store, componentFactory *factory.Factory) ([]*entity.Entity, error) {
+	var created []*entity.Entity
+	for _, spawn := range biomeSpawns[b] {
+		if r.Float64() >= spawn.chance {
+			continue
+		}
+		e, err := spawn.create(p, s, componentFactory)
+		if err != nil {
+			return created, err
+		}
+		created = append(created, e)
+	}
+	return created, nil
+}
@@ -0,0 +1,32 @@
+package blueprint
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/point"
+)
+
+var ErrUnknownBlueprint = errors.New("unknown blueprint")
+
+// byName are the blueprints that maps refer to by name, such as the spawns
+// of a prefab.
+var byName = map[string]func(p point.P, s *entity.Store, componentFactory *factory.Factory) (*entity.Entity, error){
+	"human": NewHuman,
+	"apple": NewApple,
+	"stone": NewStone,
+}
+
+// New creates the entity of the blueprint with the given name at the pixel
+// position p.
+func New(name string, p point.P, s *entity.Store, componentFactory *factory.Factory) (*entity.Entity, error) {
+	create, ok := byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, want one of %v", ErrUnknownBlueprint, name, slices.Sorted(maps.Keys(byName)))
+	}
+	return create(p, s, componentFactory)
+}
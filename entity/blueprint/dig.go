@@ -0,0 +1,37 @@
+package blueprint
+
+import (
+	"errors"
+
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/component/job"
+	"github.com/dwethmar/apostle/component/kind"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/point"
+)
+
+// NewDigSite creates the designation to dig out the cell at the pixel
+// position p. cell is the cell itself and work the number of ticks it takes.
+func NewDigSite(p, cell point.P, work int, s *entity.Store, componentFactory *factory.Factory) (*entity.Entity, error) {
+	e := s.CreateEntity(p)
+	k := componentFactory.NewKindComponent(e.ID())
+	k.SetValue(kind.DigSite)
+	j := componentFactory.NewJobComponent(e.ID())
+	j.SetKind(job.Dig)
+	j.SetCell(cell)
+	j.SetWork(work)
+	return e, errors.Join(
+		e.Components().SetKind(k),
+		e.Components().SetJob(j),
+	)
+}
+
+func NewStone(p point.P, s *entity.Store, componentFactory *factory.Factory) (*entity.Entity, error) {
+	e := s.CreateEntity(p)
+	k := componentFactory.NewKindComponent(e.ID())
+	k.SetValue(kind.Stone)
+	if err := e.Components().SetKind(k); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
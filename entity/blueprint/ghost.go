@@ -0,0 +1,31 @@
+package blueprint
+
+import (
+	"errors"
+
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/component/job"
+	"github.com/dwethmar/apostle/component/kind"
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/point"
+)
+
+// NewGhost creates the ghost of a wall that is yet to be built at the pixel
+// position p. cell is the cell of the wall and side the edge to put a border
+// on, or direction.None for a wall filling the cell. work is the number of
+// ticks it takes to build.
+func NewGhost(p, cell point.P, side direction.Direction, work int, s *entity.Store, componentFactory *factory.Factory) (*entity.Entity, error) {
+	e := s.CreateEntity(p)
+	k := componentFactory.NewKindComponent(e.ID())
+	k.SetValue(kind.Ghost)
+	j := componentFactory.NewJobComponent(e.ID())
+	j.SetKind(job.Build)
+	j.SetCell(cell)
+	j.SetSide(side)
+	j.SetWork(work)
+	return e, errors.Join(
+		e.Components().SetKind(k),
+		e.Components().SetJob(j),
+	)
+}
@@ -1,12 +1,43 @@
 package input
 
+import "github.com/dwethmar/apostle/direction"
+
 const ClickEvent = "click"
 
 type Click struct {
 	X int
 	Y int
+	Z int // level that was viewed when clicking
 }
 
 func (c Click) Event() string {
 	return ClickEvent
 }
+
+const DigEvent = "dig"
+
+// Dig is published for every position the player paints a dig designation on.
+type Dig struct {
+	X int
+	Y int
+	Z int // level that was viewed when painting
+}
+
+func (d Dig) Event() string {
+	return DigEvent
+}
+
+const BuildEvent = "build"
+
+// Build is published when the player places a wall. Side is the edge of the
+// cell to put a border on, or direction.None for a wall filling the cell.
+type Build struct {
+	X    int
+	Y    int
+	Z    int // level that was viewed when placing
+	Side direction.Direction
+}
+
+func (b Build) Event() string {
+	return BuildEvent
+}
@@ -1,31 +1,56 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
-	"math/rand/v2"
 
 	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/agent"
 	"github.com/dwethmar/apostle/component/factory"
 	"github.com/dwethmar/apostle/entity"
 	"github.com/dwethmar/apostle/entity/blueprint"
 	"github.com/dwethmar/apostle/event"
 	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/cache"
+	"github.com/dwethmar/apostle/pathfinding/flow"
+	"github.com/dwethmar/apostle/pathfinding/region"
 	"github.com/dwethmar/apostle/point"
 	"github.com/dwethmar/apostle/propagation"
 	"github.com/dwethmar/apostle/system/behavior"
+	"github.com/dwethmar/apostle/system/construction"
 	"github.com/dwethmar/apostle/system/debugger"
+	"github.com/dwethmar/apostle/system/fog"
 	"github.com/dwethmar/apostle/system/locomotion"
+	"github.com/dwethmar/apostle/system/mining"
 	"github.com/dwethmar/apostle/system/world"
 	"github.com/dwethmar/apostle/terrain"
 	"github.com/dwethmar/apostle/terrain/generate"
+	"github.com/dwethmar/apostle/terrain/prefab"
+	"github.com/dwethmar/apostle/terrain/spawn"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 //go:generate go run ./genout -config=components.yaml
 
+// Size of the generated map in cells and levels.
+const (
+	mapWidth        = 50
+	mapHeight       = 50
+	mapLevels       = 2
+	stairsPerLevel  = 4
+	prefabsPerLevel = 3
+)
+
+// spawnTable is what is spawned on the generated map, besides the spawns of
+// the prefabs and the biomes.
+var spawnTable = spawn.Table{
+	{Blueprint: "human", Min: 1, Max: 1},
+	{Blueprint: "apple", Min: 1, Max: 3, MinDistance: map[string]int{"human": 3, "apple": 2}},
+}
+
 type Drawer interface {
 	Draw(screen *ebiten.Image)
 }
@@ -83,70 +108,106 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeigh
 }
 
 func main() {
+	seed := flag.Uint64("seed", 0, "seed of the generated map, a random seed is picked when it is not set")
+	generatorName := flag.String("generator", mapGenerator, fmt.Sprintf("generator of the map, one of %v", generate.Names()))
+	flag.Parse()
+
 	logger := slog.New(slog.NewTextHandler(log.Writer(), &slog.HandlerOptions{
 		Level: slog.LevelDebug,
 	}))
 
-	tr := terrain.New()
-	// for s := range tr.Walk() {
-	// 	if s.X%2 == 0 && s.Y%2 == 0 {
-	// 		// Fill every second cell with solid terrain
-	// 		// except the starting area around (10,10)
-	// 		if (s.X >= 8 && s.X <= 12) && (s.Y >= 8 && s.Y <= 12) {
-	// 			continue
-	// 		}
-	// 		if err := tr.Fill(s.X, s.Y, terrain.Solid); err != nil {
-	// 			logger.Error("failed to fill cell", "x", s.X, "y", s.Y, "error", err)
-	// 		}
-	// 	}
-
-	// 	// Add borders to some cells
-	// 	if s.X == 5 && s.Y == 5 {
-	// 		if err := tr.Fill(s.X, s.Y, terrain.BorderNorth|terrain.BorderWest); err != nil {
-	// 			log.Fatalf("failed to fill borders at (%d, %d): %v", s.X, s.Y, err)
-	// 		}
-	// 	}
-	// }
-	generate.Generate(tr)
+	eventBus := event.NewBus(0)
+	tr := terrain.NewStack(mapWidth, mapHeight, mapLevels,
+		terrain.WithEmitCellChangedEvent(func(e *terrain.CellChangedEvent) {
+			if err := eventBus.Publish(e); err != nil {
+				logger.Error("failed to publish cell changed event", slog.Any("error", err))
+			}
+		}),
+		terrain.WithEmitCellsChangedEvent(func(e *terrain.CellsChangedEvent) {
+			if err := eventBus.Publish(e); err != nil {
+				logger.Error("failed to publish cells changed event", slog.Any("error", err))
+			}
+		}),
+		terrain.WithEmitDoorChangedEvent(func(e *terrain.DoorChangedEvent) {
+			if err := eventBus.Publish(e); err != nil {
+				logger.Error("failed to publish door changed event", slog.Any("error", err))
+			}
+		}),
+	)
+	generator, err := generate.Lookup(*generatorName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	prefabs, err := prefab.Builtin()
+	if err != nil {
+		log.Fatalf("failed to load prefabs: %v", err)
+	}
+	generateOpts := []generate.Option{
+		generate.WithGenerator(generator),
+		generate.WithPrefabs(prefabsPerLevel, prefabs...),
+		generate.WithRepair(),
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			generateOpts = append(generateOpts, generate.WithSeed(*seed))
+		}
+	})
+	generated, err := generate.GenerateStack(tr, stairsPerLevel, generateOpts...)
+	mapSeed := generated.Seed
+	if err != nil {
+		log.Fatalf("failed to generate map with seed %d: %v", mapSeed, err)
+	}
+	for z, level := range generated.Levels {
+		if level.Repaired > 0 {
+			logger.Info("Connected unreachable pockets", slog.Int("level", z), slog.Int("pockets", level.Repaired))
+		}
+	}
+	logger.Info("Generated map", slog.String("generator", *generatorName), slog.Uint64("seed", mapSeed))
 
 	componentCollection := component.NewStore()
 	entityStore := entity.NewStore(componentCollection)
-	eventBus := event.NewBus(0)
 	componentFactory := factory.NewFactory(eventBus)
 
-	{
-		var x, y int
-		for range 1000 {
-			x = rand.IntN(tr.Width() - 1)
-			y = rand.IntN(tr.Height() - 1)
-			if !tr.Solid(x, y) {
-				break
-			}
+	// what is spawned on the map is seeded from the map seed too
+	spawnRand := generate.NewRand(mapSeed)
+	spawns, err := spawn.Place(tr, generated, spawnTable, spawnRand)
+	if err != nil {
+		log.Fatalf("failed to place the spawns of map seed %d: %v", mapSeed, err)
+	}
+	for _, s := range spawns {
+		if _, err := blueprint.New(s.Name, world.CellToCenterPX(s.P), entityStore, componentFactory); err != nil {
+			log.Fatalf("failed to spawn %s at %v: %v", s.Name, s.P, err)
 		}
-		blueprint.NewHuman(world.CellToCenterPX(point.P{
-			X: x,
-			Y: y,
-		}), entityStore, componentFactory)
 	}
-	{
-		var x, y int
-		for range 1000 {
-			x = rand.IntN(tr.Width() - 1)
-			y = rand.IntN(tr.Height() - 1)
-			if !tr.Solid(x, y) {
-				break
+	for z, level := range generated.Levels {
+		for _, s := range level.Spawns {
+			p := point.New3(s.P.X, s.P.Y, z)
+			if _, err := blueprint.New(s.Name, world.CellToCenterPX(p), entityStore, componentFactory); err != nil {
+				log.Fatalf("failed to spawn %s at %v: %v", s.Name, p, err)
 			}
 		}
-		blueprint.NewApple(world.CellToCenterPX(point.P{
-			X: x,
-			Y: y,
-		}), entityStore, componentFactory)
+	}
+	// what lives in the biomes of the map
+	for step := range tr.Walk() {
+		p := point.New3(step.X, step.Y, step.Z)
+		if !tr.Standable(p) {
+			continue
+		}
+		if _, err := blueprint.NewBiomeSpawns(world.CellToCenterPX(p), step.Biome, spawnRand, entityStore, componentFactory); err != nil {
+			log.Fatalf("failed to spawn the entities of %v: %v", p, err)
+		}
 	}
 
-	debugger := debugger.New(logger, entityStore, componentCollection)
-	w := world.New(logger, tr, entityStore, componentCollection, eventBus)
-	l := locomotion.New(logger, entityStore, componentCollection)
-	b := behavior.New(logger, tr, componentFactory, entityStore, componentCollection, astar.New(tr), eventBus)
+	paths := cache.New(astar.New(tr))
+	apples := flow.New(tr)
+	debugger := debugger.New(logger, entityStore, componentCollection, debugger.WithSeed(mapSeed), debugger.WithPathCache(paths), debugger.WithAppleField(apples))
+	f := fog.New(logger, tr, entityStore, componentCollection)
+	w := world.New(logger, tr, entityStore, componentCollection, eventBus, world.WithFog(f.Map(agent.PlayerFaction)))
+	l := locomotion.New(logger, tr, entityStore, componentCollection)
+	regions := region.New(tr)
+	c := construction.New(logger, tr, entityStore, componentCollection, componentFactory, regions, eventBus)
+	mn := mining.New(logger, tr, entityStore, componentCollection, componentFactory, eventBus, mining.WithStoneDrop())
+	b := behavior.New(logger, tr, componentFactory, entityStore, componentCollection, paths, regions, f, eventBus, behavior.WithAppleField(apples))
 
 	game := &Game{
 		drawers: []Drawer{
@@ -154,7 +215,11 @@ func main() {
 			debugger,
 		},
 		systems: []System{
+			w,
 			l,
+			f,
+			mn,
+			c,
 			b,
 			debugger,
 		},
@@ -0,0 +1,85 @@
+package astar_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/internal/gridtest"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func TestAStar_Find(t *testing.T) {
+	t.Run("straight line", func(t *testing.T) {
+		tr := terrain.New(5, 1)
+		path := astar.New(tr).Find(point.New(0, 0), point.New(4, 0))
+		if len(path) != 5 {
+			t.Fatalf("Find() returned %d cells, want 5: %v", len(path), path)
+		}
+	})
+
+	t.Run("no path", func(t *testing.T) {
+		tr := terrain.New(3, 1)
+		if err := tr.Fill(1, 0, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if path := astar.New(tr).Find(point.New(0, 0), point.New(2, 0)); path != nil {
+			t.Errorf("Find() = %v, want nil", path)
+		}
+	})
+
+	t.Run("avoids expensive ground", func(t *testing.T) {
+		// the direct route through the middle row is water, walking around is cheaper
+		tr := terrain.New(5, 3)
+		for x := 1; x < 4; x++ {
+			if err := tr.SetMaterial(x, 1, terrain.ShallowWater); err != nil {
+				t.Fatalf("SetMaterial() error = %v", err)
+			}
+		}
+		path := astar.New(tr).Find(point.New(0, 1), point.New(4, 1))
+		if len(path) == 0 {
+			t.Fatalf("Find() returned no path")
+		}
+		for _, p := range path {
+			if tr.Material(p.X, p.Y) == terrain.ShallowWater {
+				t.Errorf("Find() = %v, path crosses water at %v", path, p)
+			}
+		}
+	})
+
+	t.Run("across levels", func(t *testing.T) {
+		s, want := gridtest.SplitLevel(t)
+		got := astar.New(s).Find(want[0], want[len(want)-1])
+		if len(got) != len(want) {
+			t.Fatalf("Find() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if !got[i].Equal(want[i]) {
+				t.Errorf("Find()[%d] = %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("locked door", func(t *testing.T) {
+		// a wall splits the terrain, the only way through is a door
+		tr := terrain.New(2, 1)
+		if err := tr.Fill(0, 0, terrain.BorderEast); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		for _, tc := range []struct {
+			state terrain.DoorState
+			want  int
+		}{
+			{terrain.DoorClosed, 2},
+			{terrain.DoorLocked, 0},
+		} {
+			if err := tr.SetDoor(0, 0, direction.East, tc.state); err != nil {
+				t.Fatalf("SetDoor() error = %v", err)
+			}
+			if path := astar.New(tr).Find(point.New(0, 0), point.New(1, 0)); len(path) != tc.want {
+				t.Errorf("Find() through %v door = %v, want %d cells", tc.state, path, tc.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+// Package cache remembers the paths a PathFinder found, so agents that
+// search the same path again, such as several agents chasing the same
+// apple, do not repeat the search.
+package cache
+
+import (
+	"slices"
+
+	"github.com/dwethmar/apostle/point"
+)
+
+// PathFinder is the search whose paths are cached.
+type PathFinder interface {
+	Find(start, end point.P) []point.P
+}
+
+// DefaultMaxEntries is the number of paths a cache holds by default.
+const DefaultMaxEntries = 1024
+
+// Stats are the counters of a cache.
+type Stats struct {
+	Hits        uint64 // searches answered from the cache
+	Misses      uint64 // searches passed on to the path finder
+	Invalidated uint64 // paths dropped because the terrain changed
+	Entries     int    // paths in the cache
+	Version     uint64 // terrain version, see Cache.Invalidate
+}
+
+// key identifies a search at a terrain version. Any change may open a
+// shorter way, so a path is only valid at the version it was found at.
+type key struct {
+	start, end point.P
+	version    uint64
+}
+
+type entry struct {
+	path  []point.P
+	added uint64 // when the path was added, see Cache.order
+}
+
+// added is a key in the order the paths were added to the cache.
+type added struct {
+	key
+	at uint64
+}
+
+// Cache is a PathFinder that remembers the paths of another PathFinder. A
+// path is cached by its start, its end and the terrain version it was found
+// at, so it is only answered from the cache as long as the terrain did not
+// change. When cells change, Invalidate moves to the next version and drops
+// the paths of the previous one, even those that do not cross the changed
+// cells, because the change may have opened a shorter way.
+type Cache struct {
+	finder     PathFinder
+	maxEntries int
+	version    uint64
+	entries    map[key]entry
+	order      []added // paths in the order they were added, including removed ones
+	added      uint64
+	stats      Stats
+}
+
+type Option func(*Cache)
+
+// WithMaxEntries limits the number of paths in the cache. When it is full
+// the oldest path is dropped.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = max(n, 1)
+	}
+}
+
+func New(finder PathFinder, opts ...Option) *Cache {
+	c := &Cache{
+		finder:     finder,
+		maxEntries: DefaultMaxEntries,
+		entries:    make(map[key]entry),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Find returns the path from start to end, from the cache if it holds one.
+// The returned path may be modified by the caller.
+func (c *Cache) Find(start, end point.P) []point.P {
+	k := key{start, end, c.version}
+	if e, ok := c.entries[k]; ok {
+		c.stats.Hits++
+		return slices.Clone(e.path)
+	}
+	c.stats.Misses++
+
+	path := c.finder.Find(start, end)
+	if len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.added++
+	c.entries[k] = entry{path: slices.Clone(path), added: c.added}
+	c.order = append(c.order, added{k, c.added})
+	if len(c.order) > 2*c.maxEntries {
+		// forget the paths that were removed
+		c.order = slices.DeleteFunc(c.order, func(a added) bool { return !c.current(a) })
+	}
+	return path
+}
+
+// invalidator is implemented by path finders that keep state about the
+// terrain, such as hpa.HPA.
+type invalidator interface {
+	Invalidate(changed ...point.P)
+}
+
+// Invalidate moves to the next terrain version and drops the paths found at
+// the previous one. The changes are passed on to the PathFinder if
+// it keeps state about the terrain.
+func (c *Cache) Invalidate(changed ...point.P) {
+	if len(changed) == 0 {
+		return
+	}
+	if i, ok := c.finder.(invalidator); ok {
+		i.Invalidate(changed...)
+	}
+	c.version++
+	c.stats.Invalidated += uint64(len(c.entries))
+	clear(c.entries)
+	c.order = c.order[:0]
+}
+
+// Version returns the terrain version, the number of times Invalidate was
+// called with changed cells.
+func (c *Cache) Version() uint64 {
+	return c.version
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() Stats {
+	s := c.stats
+	s.Entries = len(c.entries)
+	s.Version = c.version
+	return s
+}
+
+// evict drops the oldest path in the cache.
+func (c *Cache) evict() {
+	for len(c.order) > 0 {
+		a := c.order[0]
+		c.order = c.order[1:]
+		if c.current(a) {
+			delete(c.entries, a.key)
+			return
+		}
+	}
+}
+
+// current reports whether the path that was added is still in the cache.
+func (c *Cache) current(a added) bool {
+	e, ok := c.entries[a.key]
+	return ok && e.added == a.at
+}
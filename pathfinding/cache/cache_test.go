@@ -0,0 +1,162 @@
+package cache_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/cache"
+	"github.com/dwethmar/apostle/pathfinding/hpa"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+)
+
+// counting counts the searches of a path finder.
+type counting struct {
+	cache.PathFinder
+	searches int
+}
+
+func (c *counting) Find(start, end point.P) []point.P {
+	c.searches++
+	return c.PathFinder.Find(start, end)
+}
+
+func TestCache_Find(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+#######
+#.....#
+#.###.#
+#.....#
+#######
+`)
+	finder := &counting{PathFinder: astar.New(tr)}
+	c := cache.New(finder)
+	start, end := point.New(1, 1), point.New(5, 1)
+
+	want := c.Find(start, end)
+	if len(want) == 0 {
+		t.Fatalf("Find() found no path")
+	}
+	got := c.Find(start, end)
+	if len(got) != len(want) || finder.searches != 1 {
+		t.Errorf("Find() searched %d times, want 1", finder.searches)
+	}
+	got[0] = point.New(0, 0)
+	if c.Find(start, end)[0] != start {
+		t.Errorf("Find() returned the cached path itself")
+	}
+
+	// a change away from the path drops it as well
+	c.Invalidate(point.New(3, 3))
+	c.Find(start, end)
+	if finder.searches != 2 {
+		t.Errorf("Find() searched %d times after a change away from the path, want 2", finder.searches)
+	}
+
+	// a change on the path drops it
+	if err := tr.Fill(3, 1, terrain.Solid); err != nil {
+		t.Fatal(err)
+	}
+	c.Invalidate(point.New(3, 1))
+	if got := c.Find(start, end); len(got) <= len(want) || finder.searches != 3 {
+		t.Errorf("Find() = %v after the path was blocked, searched %d times", got, finder.searches)
+	}
+
+	s := c.Stats()
+	if s.Hits != 2 || s.Misses != 3 || s.Invalidated != 2 || s.Entries != 1 || s.Version != 2 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestCache_Shortcut(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+#######
+#..#..#
+#..#..#
+#.....#
+#######
+`)
+	c := cache.New(astar.New(tr))
+	start, end := point.New(1, 1), point.New(5, 1)
+	if got := c.Find(start, end); len(got) != 7 {
+		t.Fatalf("Find() = %v, want 7 cells", got)
+	}
+	// the way through the wall is not on the cached path, but shorter
+	if err := tr.Fill(3, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	c.Invalidate(point.New(3, 1))
+	if got := c.Find(start, end); len(got) != 5 {
+		t.Errorf("Find() = %v after a shortcut was opened, want 5 cells", got)
+	}
+}
+
+func TestCache_NoPath(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+#####
+#.#.#
+#####
+`)
+	finder := &counting{PathFinder: astar.New(tr)}
+	c := cache.New(finder)
+	start, end := point.New(1, 1), point.New(3, 1)
+
+	c.Find(start, end)
+	c.Find(start, end)
+	if finder.searches != 1 {
+		t.Errorf("Find() searched %d times, want 1", finder.searches)
+	}
+	// any change may open a way
+	c.Invalidate(point.New(0, 0))
+	c.Find(start, end)
+	if finder.searches != 2 {
+		t.Errorf("Find() searched %d times after a change, want 2", finder.searches)
+	}
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+#####
+#...#
+#####
+`)
+	finder := &counting{PathFinder: astar.New(tr)}
+	c := cache.New(finder, cache.WithMaxEntries(2))
+	a, b, d := point.New(1, 1), point.New(2, 1), point.New(3, 1)
+
+	c.Find(a, b)
+	c.Find(a, d)
+	c.Find(b, d) // drops the path from a to b
+	if got := c.Stats().Entries; got != 2 {
+		t.Errorf("Stats().Entries = %d, want 2", got)
+	}
+	c.Find(a, d)
+	c.Find(a, b)
+	if finder.searches != 4 {
+		t.Errorf("Find() searched %d times, want 4", finder.searches)
+	}
+}
+
+func TestCache_InvalidateFinder(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+##########
+#........#
+#.######.#
+#........#
+##########
+`)
+	// the clusters of hpa need to hear of the change to find the way around
+	c := cache.New(hpa.New(tr, hpa.WithClusterSize(3)))
+	start, end := point.New(1, 1), point.New(8, 1)
+	if got := c.Find(start, end); len(got) != 8 {
+		t.Fatalf("Find() = %v, want 8 cells", got)
+	}
+	if err := tr.Fill(4, 1, terrain.Solid); err != nil {
+		t.Fatal(err)
+	}
+	c.Invalidate(point.New(4, 1))
+	if got := c.Find(start, end); len(got) != 12 {
+		t.Errorf("Find() = %v after the path was blocked, want 12 cells", got)
+	}
+}
@@ -0,0 +1,331 @@
+// Package flow keeps flow fields: Dijkstra maps that hold, for every cell
+// of a terrain, the cost of the cheapest way to the nearest of a set of
+// goals and the move to make to get there. Any number of agents that go
+// after the same goals can read their next step from the same field
+// without a search of their own.
+//
+// Goals are weighted: the cost of a goal is added to the cost of the way
+// to it, so a cheap goal a bit further away can be preferred over an
+// expensive one nearby. When goals or the terrain change, only the cells
+// whose way changed are computed again.
+//
+// Moves follow the same rules as package astar.
+package flow
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/internal/grid"
+	"github.com/dwethmar/apostle/point"
+)
+
+// Terrain is the part of a terrain that the field needs. It is satisfied by
+// terrain.Terrain and terrain.Stack. Traversable must return false for
+// moves that leave the terrain.
+type Terrain interface {
+	Width() int
+	Height() int
+	Traversable(p point.P, d direction.Direction) bool
+}
+
+// moves are the moves an agent can make from a cell.
+var moves = [...]direction.Direction{
+	direction.North,
+	direction.South,
+	direction.East,
+	direction.West,
+	direction.NorthEast,
+	direction.NorthWest,
+	direction.SouthEast,
+	direction.SouthWest,
+	direction.Up,
+	direction.Down,
+}
+
+// none is the move of cells without one: goals and cells that reach no goal.
+const none = -1
+
+// Field is a flow field over a terrain. It is not safe for concurrent use.
+type Field struct {
+	terrain      Terrain
+	width        int
+	height       int
+	levels       int
+	goals        map[point.P]float64
+	distances    []float64 // infinite for cells that reach no goal
+	next         []int8    // index into moves, or none
+	lastUpdated  int
+	totalUpdated int
+}
+
+func New(t Terrain) *Field {
+	f := &Field{
+		terrain: t,
+		width:   t.Width(),
+		height:  t.Height(),
+		levels:  grid.Levels(t),
+		goals:   make(map[point.P]float64),
+	}
+	n := f.width * f.height * f.levels
+	f.distances = make([]float64, n)
+	f.next = make([]int8, n)
+	for i := range n {
+		f.distances[i] = math.Inf(1)
+		f.next[i] = none
+	}
+	return f
+}
+
+// index returns the index of a cell, and false if it is not on the terrain.
+func (f *Field) index(p point.P) (int, bool) {
+	if p.X < 0 || p.Y < 0 || p.Z < 0 || p.X >= f.width || p.Y >= f.height || p.Z >= f.levels {
+		return 0, false
+	}
+	return (p.Z*f.height+p.Y)*f.width + p.X, true
+}
+
+// cell returns the cell at an index.
+func (f *Field) cell(i int) point.P {
+	return point.New3(i%f.width, i/f.width%f.height, i/(f.width*f.height))
+}
+
+// SetGoal adds a goal at p, or changes its cost if there already is one.
+// Cells off the terrain are ignored.
+func (f *Field) SetGoal(p point.P, cost float64) {
+	f.SetGoals(map[point.P]float64{p: cost})
+}
+
+// SetGoals adds the goals, or changes their cost where there already are
+// goals. The field is updated once for all of them.
+func (f *Field) SetGoals(goals map[point.P]float64) {
+	var affected []int
+	for p, cost := range goals {
+		i, ok := f.index(p)
+		if !ok {
+			continue
+		}
+		if c, ok := f.goals[p]; ok && c == cost {
+			continue
+		}
+		f.goals[p] = cost
+		affected = append(affected, i)
+	}
+	f.update(affected)
+}
+
+// RemoveGoal removes the goals at the given cells.
+func (f *Field) RemoveGoal(goals ...point.P) {
+	var affected []int
+	for _, p := range goals {
+		if _, ok := f.goals[p]; !ok {
+			continue
+		}
+		delete(f.goals, p)
+		i, _ := f.index(p)
+		affected = append(affected, i)
+	}
+	f.update(affected)
+}
+
+// ClearGoals removes every goal.
+func (f *Field) ClearGoals() {
+	goals := make([]point.P, 0, len(f.goals))
+	for p := range f.goals {
+		goals = append(goals, p)
+	}
+	f.RemoveGoal(goals...)
+}
+
+// Invalidate updates the field after cells of the terrain changed. Walls
+// and doors between two cells must be reported as changes of both cells.
+func (f *Field) Invalidate(changed ...point.P) {
+	seen := make(map[int]bool)
+	var affected []int
+	for _, c := range changed {
+		// the moves that a change depends on start at most one cell away,
+		// or on the level above or below for stairs
+		for dz := -1; dz <= 1; dz++ {
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if dz != 0 && (dx != 0 || dy != 0) {
+						continue
+					}
+					i, ok := f.index(point.New3(c.X+dx, c.Y+dy, c.Z+dz))
+					if ok && !seen[i] {
+						seen[i] = true
+						affected = append(affected, i)
+					}
+				}
+			}
+		}
+	}
+	f.update(affected)
+}
+
+// Next returns the cell to move to from p to get closer to the cheapest
+// goal, and false if p is that goal, reaches no goal or is not on the
+// terrain.
+func (f *Field) Next(p point.P) (point.P, bool) {
+	i, ok := f.index(p)
+	if !ok || f.next[i] == none {
+		return point.P{}, false
+	}
+	return grid.Add(p, moves[f.next[i]]), true
+}
+
+// Distance returns the cost of the way from p to the cheapest goal,
+// including the cost of the goal, and false if p reaches no goal.
+func (f *Field) Distance(p point.P) (float64, bool) {
+	i, ok := f.index(p)
+	if !ok || math.IsInf(f.distances[i], 1) {
+		return 0, false
+	}
+	return f.distances[i], true
+}
+
+// Path returns the cells from p to the cheapest goal, including both, or
+// nil if p reaches no goal.
+func (f *Field) Path(p point.P) []point.P {
+	if _, ok := f.Distance(p); !ok {
+		return nil
+	}
+	path := []point.P{p}
+	for {
+		next, ok := f.Next(p)
+		if !ok {
+			return path
+		}
+		path = append(path, next)
+		p = next
+	}
+}
+
+// update computes the cells again whose way may have changed because the
+// moves from the affected cells or their goals changed. Cells whose way
+// is broken are reset together with every cell whose way leads over them.
+// They and the affected cells then take the cheapest way over their
+// neighbours, and improvements spread to the cells that lead to them.
+func (f *Field) update(affected []int) {
+	if len(affected) == 0 {
+		return
+	}
+	f.lastUpdated = 0
+	var reset []int
+	for _, i := range affected {
+		if !f.intact(i) {
+			reset = f.reset(i, reset)
+		}
+	}
+
+	open := &grid.Queue[int]{}
+	for _, seeds := range [][]int{affected, reset} {
+		for _, i := range seeds {
+			if f.settle(i) {
+				heap.Push(open, grid.Item[int]{V: i, G: f.distances[i], F: f.distances[i]})
+			}
+		}
+	}
+	for open.Len() > 0 {
+		current := heap.Pop(open).(grid.Item[int])
+		if current.G > f.distances[current.V] {
+			continue // reached cheaper after it was queued
+		}
+		q := f.cell(current.V)
+		for k, d := range moves {
+			p := grid.Add(q, d.Opposite())
+			j, ok := f.index(p)
+			if !ok {
+				continue
+			}
+			cost, ok := grid.Step(f.terrain, p, d)
+			if !ok {
+				continue
+			}
+			if g := current.G + cost; g < f.distances[j] {
+				f.set(j, g, int8(k))
+				heap.Push(open, grid.Item[int]{V: j, G: g, F: g})
+			}
+		}
+	}
+	f.totalUpdated += f.lastUpdated
+}
+
+// intact reports whether the way of the cell still costs what it did or
+// less, in which case it is only lowered.
+func (f *Field) intact(i int) bool {
+	if math.IsInf(f.distances[i], 1) {
+		return true
+	}
+	p := f.cell(i)
+	k := f.next[i]
+	if k == none {
+		cost, ok := f.goals[p]
+		return ok && cost <= f.distances[i]
+	}
+	cost, ok := grid.Step(f.terrain, p, moves[k])
+	if !ok {
+		return false
+	}
+	j, _ := f.index(grid.Add(p, moves[k]))
+	return f.distances[j]+cost <= f.distances[i]
+}
+
+// reset clears the cell and every cell whose way leads over it, and
+// appends them to cells.
+func (f *Field) reset(i int, cells []int) []int {
+	stack := []int{i}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if math.IsInf(f.distances[i], 1) {
+			continue
+		}
+		f.set(i, math.Inf(1), none)
+		cells = append(cells, i)
+		q := f.cell(i)
+		for k, d := range moves {
+			if j, ok := f.index(grid.Add(q, d.Opposite())); ok && f.next[j] == int8(k) {
+				stack = append(stack, j)
+			}
+		}
+	}
+	return cells
+}
+
+// settle gives the cell its goal or the cheapest way over a neighbour if
+// that is cheaper than what it has, and reports whether it reaches a goal.
+func (f *Field) settle(i int) bool {
+	p := f.cell(i)
+	if cost, ok := f.goals[p]; ok && cost < f.distances[i] {
+		f.set(i, cost, none)
+	}
+	for k, d := range moves {
+		j, ok := f.index(grid.Add(p, d))
+		if !ok || math.IsInf(f.distances[j], 1) {
+			continue
+		}
+		if cost, ok := grid.Step(f.terrain, p, d); ok && f.distances[j]+cost < f.distances[i] {
+			f.set(i, f.distances[j]+cost, int8(k))
+		}
+	}
+	return !math.IsInf(f.distances[i], 1)
+}
+
+func (f *Field) set(i int, distance float64, next int8) {
+	f.distances[i] = distance
+	f.next[i] = next
+	f.lastUpdated++
+}
+
+// Stats describes a field.
+type Stats struct {
+	Goals        int
+	LastUpdated  int // cells whose way was set by the last update
+	TotalUpdated int // cells whose way was set by every update together
+}
+
+func (f *Field) Stats() Stats {
+	return Stats{Goals: len(f.goals), LastUpdated: f.lastUpdated, TotalUpdated: f.totalUpdated}
+}
@@ -0,0 +1,267 @@
+package flow_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/flow"
+	"github.com/dwethmar/apostle/pathfinding/internal/gridtest"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+func TestField_Next(t *testing.T) {
+	tests := []struct {
+		name  string
+		goals map[point.P]float64
+		from  point.P
+		want  point.P
+		ok    bool
+	}{
+		{"toward the goal", map[point.P]float64{point.New(8, 0): 0}, point.New(3, 0), point.New(4, 0), true},
+		{"nearest goal", map[point.P]float64{point.New(0, 0): 0, point.New(8, 0): 0}, point.New(5, 0), point.New(6, 0), true},
+		{"cheapest goal", map[point.P]float64{point.New(0, 0): 0, point.New(8, 0): 5}, point.New(5, 0), point.New(4, 0), true},
+		{"on the goal", map[point.P]float64{point.New(8, 0): 0}, point.New(8, 0), point.P{}, false},
+		{"cheaper goal from a goal", map[point.P]float64{point.New(0, 0): 0, point.New(2, 0): 5}, point.New(2, 0), point.New(1, 0), true},
+		{"no goals", nil, point.New(3, 0), point.P{}, false},
+		{"off the terrain", map[point.P]float64{point.New(8, 0): 0}, point.New(9, 0), point.P{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := flow.New(terrain.New(9, 1))
+			f.SetGoals(tt.goals)
+			got, ok := f.Next(tt.from)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Next(%v) = %v, %t, want %v, %t", tt.from, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestField_Path(t *testing.T) {
+	t.Run("no path", func(t *testing.T) {
+		tr := terrain.New(3, 1)
+		if err := tr.Fill(1, 0, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		f := flow.New(tr)
+		f.SetGoal(point.New(2, 0), 0)
+		if path := f.Path(point.New(0, 0)); path != nil {
+			t.Errorf("Path() = %v, want nil", path)
+		}
+		if _, ok := f.Distance(point.New(0, 0)); ok {
+			t.Error("Distance() reports a way, want none")
+		}
+	})
+
+	t.Run("across levels", func(t *testing.T) {
+		s, want := gridtest.SplitLevel(t)
+		f := flow.New(s)
+		f.SetGoal(want[len(want)-1], 0)
+		got := f.Path(want[0])
+		if len(got) != len(want) {
+			t.Fatalf("Path() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Path()[%d] = %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+}
+
+func TestField_Invalidate(t *testing.T) {
+	tr := terrain.New(20, 20)
+	f := flow.New(tr)
+	f.SetGoal(point.New(0, 0), 0)
+	if got := f.Stats().LastUpdated; got < 20*20 {
+		t.Fatalf("LastUpdated = %d, want every cell", got)
+	}
+
+	// a change in a corner no way leads over only updates the cells
+	// around it
+	corner := point.New(19, 19)
+	if err := tr.Fill(corner.X, corner.Y, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	f.Invalidate(corner)
+	if got := f.Stats().LastUpdated; got > 4 {
+		t.Errorf("LastUpdated = %d after a change in the corner, want at most 4", got)
+	}
+
+	// closing the goal in cuts every cell off
+	for _, p := range []point.P{point.New(1, 0), point.New(0, 1), point.New(1, 1)} {
+		if err := tr.Fill(p.X, p.Y, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+	}
+	f.Invalidate(point.New(1, 0), point.New(0, 1), point.New(1, 1))
+	if path := f.Path(point.New(10, 10)); path != nil {
+		t.Errorf("Path() = %v, want nil", path)
+	}
+
+	// and opening it again finds the way back
+	if err := tr.Fill(1, 0, 0); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	f.Invalidate(point.New(1, 0))
+	if path := f.Path(point.New(10, 10)); len(path) != 13 || path[len(path)-1] != point.New(0, 0) {
+		t.Errorf("Path() = %v, want 13 cells to the goal", path)
+	}
+}
+
+// TestField_UpdateGenerated changes the terrain and goals of generated maps
+// and compares the field after every change with a field built from
+// scratch, and its ways with the paths of astar.
+func TestField_UpdateGenerated(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		generator generate.Generator
+	}{
+		{"caves", generate.DefaultCaves},
+		{"rooms", generate.DefaultRooms},
+		{"bsp", generate.DefaultBSP},
+		{"outdoor", generate.DefaultOutdoor},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for seed := range uint64(3) {
+				s := terrain.NewStack(48, 32, 2)
+				if _, err := generate.GenerateStack(s, 3, generate.WithGenerator(tc.generator), generate.WithSeed(seed)); err != nil {
+					t.Fatalf("GenerateStack() error = %v", err)
+				}
+				cells := gridtest.Standable(s)
+				r := rand.New(rand.NewPCG(seed, 0))
+				random := func() point.P { return cells[r.IntN(len(cells))] }
+
+				goals := map[point.P]float64{random(): 0, random(): 10}
+				f := flow.New(s)
+				f.SetGoals(goals)
+				for i := range 30 {
+					switch i % 3 {
+					case 0:
+						p := random()
+						if err := s.Fill(p, terrain.Solid); err != nil {
+							t.Fatalf("Fill() error = %v", err)
+						}
+						f.Invalidate(p)
+					case 1:
+						p := random()
+						if err := s.Fill(p, 0); err != nil {
+							t.Fatalf("Fill() error = %v", err)
+						}
+						f.Invalidate(p)
+					case 2:
+						for p := range goals {
+							if r.IntN(2) == 0 {
+								delete(goals, p)
+								f.RemoveGoal(p)
+							}
+						}
+						p, c := random(), float64(r.IntN(20))
+						goals[p] = c
+						f.SetGoal(p, c)
+					}
+					if err := compare(s, f, goals, []point.P{random(), random(), random()}); err != nil {
+						t.Fatalf("seed %d, change %d: %v", seed, i, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// compare returns an error if the field differs from a field built from
+// scratch, or if the way from a sampled cell does not cost what astar says.
+func compare(s *terrain.Stack, f *flow.Field, goals map[point.P]float64, sample []point.P) error {
+	want := flow.New(s)
+	want.SetGoals(goals)
+	for step := range s.Walk() {
+		p := point.New3(step.X, step.Y, step.Z)
+		got, ok := f.Distance(p)
+		w, wok := want.Distance(p)
+		if ok != wok || math.Abs(got-w) > 1e-9 {
+			return fmt.Errorf("Distance(%v) = %.2f, %t, want %.2f, %t", p, got, ok, w, wok)
+		}
+		if !ok {
+			continue
+		}
+		path := f.Path(p)
+		if err := gridtest.Valid(s, path); err != nil {
+			return err
+		}
+		end := path[len(path)-1]
+		if c := gridtest.Cost(s, path) + goals[end]; math.Abs(c-got) > 1e-9 {
+			return fmt.Errorf("Path(%v) = %v costs %.2f, Distance() = %.2f", p, path, c, got)
+		}
+	}
+	// the way to the goal that was chosen is as cheap as the path of astar
+	a := astar.New(s)
+	for _, from := range sample {
+		path := f.Path(from)
+		if path == nil {
+			continue
+		}
+		if c, best := gridtest.Cost(s, path), gridtest.Cost(s, a.Find(from, path[len(path)-1])); math.Abs(c-best) > 1e-9 {
+			return fmt.Errorf("Path(%v) costs %.2f, astar %.2f", from, c, best)
+		}
+	}
+	return nil
+}
+
+// BenchmarkAgents compares 100 agents on a caves map that each search
+// their own way to the same goal with one field they all read from.
+func BenchmarkAgents(b *testing.B) {
+	tr := terrain.New(128, 128)
+	if _, err := generate.Generate(tr, generate.WithGenerator(generate.DefaultCaves), generate.WithSeed(1)); err != nil {
+		b.Fatalf("Generate() error = %v", err)
+	}
+	var cells []point.P
+	for step := range tr.Walk() {
+		if p := point.New(step.X, step.Y); tr.Standable(p) {
+			cells = append(cells, p)
+		}
+	}
+	goal := cells[len(cells)/2]
+	r := rand.New(rand.NewPCG(1, 0))
+	agents := make([]point.P, 100)
+	for i := range agents {
+		agents[i] = cells[r.IntN(len(cells))]
+	}
+
+	b.Run("astar", func(b *testing.B) {
+		a := astar.New(tr)
+		for b.Loop() {
+			for _, p := range agents {
+				a.Find(p, goal)
+			}
+		}
+	})
+	b.Run("flow", func(b *testing.B) {
+		for b.Loop() {
+			f := flow.New(tr)
+			f.SetGoal(goal, 0)
+			for _, p := range agents {
+				f.Next(p)
+			}
+		}
+	})
+	b.Run("invalidate", func(b *testing.B) {
+		f := flow.New(tr)
+		f.SetGoal(goal, 0)
+		p := cells[r.IntN(len(cells))]
+		cell, _ := tr.Cell(p.X, p.Y)
+		for b.Loop() {
+			// close the cell and open it again
+			for _, c := range []terrain.Cell{terrain.Solid, cell} {
+				if err := tr.Fill(p.X, p.Y, c); err != nil {
+					b.Fatalf("Fill() error = %v", err)
+				}
+				f.Invalidate(p)
+			}
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package hpa
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+
+	"github.com/dwethmar/apostle/pathfinding/internal/grid"
+	"github.com/dwethmar/apostle/point"
+)
+
+// area is a rectangle of a level that searches are bounded to.
+type area struct {
+	x, y, z, w, h int
+}
+
+func newArea(x, y, z, w, h int) *area {
+	return &area{x: x, y: y, z: z, w: w, h: h}
+}
+
+func (a *area) contains(p point.P) bool {
+	return p.Z == a.z && p.X >= a.x && p.X < a.x+a.w && p.Y >= a.y && p.Y < a.y+a.h
+}
+
+// index returns the index of a cell of the area.
+func (a *area) index(p point.P) int {
+	return (p.Y-a.y)*a.w + p.X - a.x
+}
+
+// cell returns the cell at an index of the area.
+func (a *area) cell(i int) point.P {
+	return point.New3(a.x+i%a.w, a.y+i/a.w, a.z)
+}
+
+// rect returns the area from (x0, y0) up to (x1, y1) on level z, cut off at
+// the sides of the terrain.
+func (h *HPA) rect(x0, y0, x1, y1, z int) *area {
+	x0, y0 = max(x0, 0), max(y0, 0)
+	x1, y1 = min(x1, h.terrain.Width()), min(y1, h.terrain.Height())
+	return newArea(x0, y0, z, x1-x0, y1-y0)
+}
+
+// move returns the index of the cell that move k leads to from the cell at
+// index i, with the cost of the move, and false if the move is not possible
+// or leaves the area. The cost is remembered, so the terrain is asked only
+// once however often the move is searched.
+func (h *HPA) move(a *area, i, k int) (int, float64, bool) {
+	p := a.cell(i)
+	q := grid.Add(p, moves[k])
+	if !a.contains(q) {
+		return 0, 0, false
+	}
+	cost := &h.costs[(p.Z*h.terrain.Height()+p.Y)*h.terrain.Width()+p.X][k]
+	if *cost == 0 {
+		*cost = -1
+		if c, ok := grid.Step(h.terrain, p, moves[k]); ok {
+			*cost = float32(c)
+		}
+	}
+	return a.index(q), float64(*cost), *cost > 0
+}
+
+// tree is the outcome of a search: the cost of the cheapest way to every
+// cell it reached and the cell each of them was reached from, by index.
+type tree struct {
+	area    *area
+	from    point.P
+	g       []float64 // infinite for cells that were not reached
+	parents []int
+}
+
+// cost returns the cost of the cheapest way to the cell, and false if the
+// search did not reach it.
+func (t *tree) cost(p point.P) (float64, bool) {
+	if !t.area.contains(p) {
+		return 0, false
+	}
+	g := t.g[t.area.index(p)]
+	return g, !math.IsInf(g, 1)
+}
+
+// path returns the way to the cell without the cell the search started
+// from, or nil if the search did not reach it.
+func (t *tree) path(to point.P) []point.P {
+	if _, ok := t.cost(to); !ok {
+		return nil
+	}
+	var path []point.P
+	start := t.area.index(t.from)
+	for i := t.area.index(to); i != start; i = t.parents[i] {
+		path = append(path, t.area.cell(i))
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// search explores the area from the given cell. With a goal it stops as
+// soon as the goal is reached, otherwise it explores every cell it can
+// reach. In reverse it follows the moves backwards, so the costs are of
+// the cheapest way from every cell to the given cell.
+func (h *HPA) search(a *area, from point.P, goal *point.P, reverse bool) *tree {
+	n := a.w * a.h
+	t := &tree{area: a, from: from, g: make([]float64, n), parents: make([]int, n)}
+	for i := range t.g {
+		t.g[i] = math.Inf(1)
+	}
+	estimate := func(int) float64 { return 0 }
+	target := -1
+	if goal != nil {
+		target = a.index(*goal)
+		estimate = func(i int) float64 { return grid.Heuristic(a.cell(i), *goal) }
+	}
+
+	closed := make([]bool, n)
+	s := a.index(from)
+	t.g[s] = 0
+	open := &grid.Queue[int]{}
+	heap.Push(open, grid.Item[int]{V: s, F: estimate(s)})
+	for open.Len() > 0 {
+		current := heap.Pop(open).(grid.Item[int])
+		if closed[current.V] {
+			continue
+		}
+		closed[current.V] = true
+		if current.V == target {
+			break
+		}
+		for k := range moves {
+			var (
+				j    int
+				cost float64
+				ok   bool
+			)
+			if reverse {
+				q := grid.Add(a.cell(current.V), moves[k].Opposite())
+				if !a.contains(q) {
+					continue
+				}
+				j = a.index(q)
+				_, cost, ok = h.move(a, j, k)
+			} else {
+				j, cost, ok = h.move(a, current.V, k)
+			}
+			if !ok || closed[j] {
+				continue
+			}
+			ng := t.g[current.V] + cost
+			if ng >= t.g[j] {
+				continue
+			}
+			t.g[j] = ng
+			t.parents[j] = current.V
+			heap.Push(open, grid.Item[int]{V: j, G: ng, F: ng + estimate(j)})
+		}
+	}
+	return t
+}
@@ -0,0 +1,520 @@
+// Package hpa finds paths with hierarchical path-finding A* (HPA*). The
+// terrain is cut into square clusters. Where two clusters touch, the cells
+// that connect them are grouped into entrances, and the cost of moving
+// between the entrances of a cluster is computed up front. A search first
+// finds a route over the entrances and then refines only the segments of
+// that route into cells, which is much cheaper than a search over every
+// cell of a large map. The paths are close to, but not always, the
+// cheapest.
+package hpa
+
+import (
+	"container/heap"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/internal/grid"
+	"github.com/dwethmar/apostle/point"
+)
+
+// DefaultClusterSize is the width and height of a cluster in cells.
+const DefaultClusterSize = 16
+
+// Terrain is the part of a terrain that the search needs. It is satisfied by
+// terrain.Terrain and terrain.Stack. Traversable must return false for
+// moves that leave the terrain.
+type Terrain interface {
+	Width() int
+	Height() int
+	Traversable(p point.P, d direction.Direction) bool
+}
+
+// moves are the moves within a level.
+var moves = [...]direction.Direction{
+	direction.North,
+	direction.South,
+	direction.East,
+	direction.West,
+	direction.NorthEast,
+	direction.NorthWest,
+	direction.SouthEast,
+	direction.SouthWest,
+}
+
+// cluster is a part of a level. Its entrances are the cells where paths
+// enter and leave it.
+type cluster struct {
+	*area
+	entrances []point.P
+	links     map[point.P][]link // from an entrance to the entrances it can reach inside the cluster
+}
+
+// link is the cost of the cheapest way to a cell.
+type link struct {
+	to   point.P
+	cost float64
+}
+
+// transition is a move between two clusters: a is in the cluster with the
+// lower index, b in the other one.
+type transition struct {
+	a, b point.P
+}
+
+// border is a pair of clusters that touch, by index, lowest first.
+type border [2]int
+
+// HPA implements the PathFinder interface using HPA*. It keeps the
+// entrances and the moves of the terrain, so every change to the terrain
+// must be passed to Invalidate.
+type HPA struct {
+	terrain            Terrain
+	size               int
+	cols, rows, levels int
+	clusters           []*cluster
+	borders            map[border][]transition
+	crossings          map[point.P][]point.P // cells across a border from an entrance
+	costs              [][len(moves)]float32 // of the moves by cell: 0 if not looked up yet, -1 if not possible
+	rebuilt            int
+}
+
+type Option func(*HPA)
+
+// WithClusterSize cuts the terrain into clusters of n by n cells.
+func WithClusterSize(n int) Option {
+	return func(h *HPA) {
+		h.size = max(n, 2)
+	}
+}
+
+// New cuts the terrain into clusters and computes the entrances and the
+// links between them.
+func New(t Terrain, opts ...Option) *HPA {
+	h := &HPA{
+		terrain:   t,
+		size:      DefaultClusterSize,
+		levels:    grid.Levels(t),
+		borders:   make(map[border][]transition),
+		crossings: make(map[point.P][]point.P),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.costs = make([][len(moves)]float32, t.Width()*t.Height()*h.levels)
+	h.cols = (t.Width() + h.size - 1) / h.size
+	h.rows = (t.Height() + h.size - 1) / h.size
+	for z := range h.levels {
+		for cy := range h.rows {
+			for cx := range h.cols {
+				x, y := cx*h.size, cy*h.size
+				h.clusters = append(h.clusters, &cluster{
+					area: newArea(x, y, z, min(h.size, t.Width()-x), min(h.size, t.Height()-y)),
+				})
+			}
+		}
+	}
+	for i := range h.clusters {
+		for _, j := range h.neighbors(i) {
+			if i < j {
+				h.connect(border{i, j})
+			}
+		}
+	}
+	for _, c := range h.clusters {
+		h.link(c)
+	}
+	return h
+}
+
+// index returns the index of the cluster that holds p, or -1 if p is out
+// of bounds.
+func (h *HPA) index(p point.P) int {
+	if p.X < 0 || p.Y < 0 || p.Z < 0 || p.X >= h.terrain.Width() || p.Y >= h.terrain.Height() || p.Z >= h.levels {
+		return -1
+	}
+	return (p.Z*h.rows+p.Y/h.size)*h.cols + p.X/h.size
+}
+
+// neighbors returns the indexes of the clusters next to, above and below
+// cluster i.
+func (h *HPA) neighbors(i int) []int {
+	cx, cy, z := i%h.cols, i/h.cols%h.rows, i/(h.cols*h.rows)
+	var n []int
+	if cx > 0 {
+		n = append(n, i-1)
+	}
+	if cx+1 < h.cols {
+		n = append(n, i+1)
+	}
+	if cy > 0 {
+		n = append(n, i-h.cols)
+	}
+	if cy+1 < h.rows {
+		n = append(n, i+h.cols)
+	}
+	if z > 0 {
+		n = append(n, i-h.cols*h.rows)
+	}
+	if z+1 < h.levels {
+		n = append(n, i+h.cols*h.rows)
+	}
+	return n
+}
+
+// connect computes the transitions of the border and reports whether they
+// changed.
+func (h *HPA) connect(b border) bool {
+	lo, hi := h.clusters[b[0]], h.clusters[b[1]]
+	var transitions []transition
+	switch {
+	case lo.z != hi.z:
+		// every stairs is a transition of its own
+		for y := lo.y; y < lo.y+lo.h; y++ {
+			for x := lo.x; x < lo.x+lo.w; x++ {
+				a, b := point.New3(x, y, lo.z), point.New3(x, y, hi.z)
+				if h.open(a, direction.Up) {
+					transitions = append(transitions, transition{a, b})
+				}
+			}
+		}
+	case lo.y == hi.y:
+		x := lo.x + lo.w - 1
+		transitions = h.entrances(lo.h, func(k int) point.P { return point.New3(x, lo.y+k, lo.z) }, direction.East, direction.South)
+	default:
+		y := lo.y + lo.h - 1
+		transitions = h.entrances(lo.w, func(k int) point.P { return point.New3(lo.x+k, y, lo.z) }, direction.South, direction.East)
+	}
+
+	old := h.borders[b]
+	if slices.Equal(old, transitions) {
+		return false
+	}
+	for _, t := range old {
+		h.crossings[t.a] = slices.DeleteFunc(h.crossings[t.a], func(p point.P) bool { return p == t.b })
+		h.crossings[t.b] = slices.DeleteFunc(h.crossings[t.b], func(p point.P) bool { return p == t.a })
+		for _, p := range []point.P{t.a, t.b} {
+			if len(h.crossings[p]) == 0 {
+				delete(h.crossings, p)
+			}
+		}
+	}
+	for _, t := range transitions {
+		h.crossings[t.a] = append(h.crossings[t.a], t.b)
+		h.crossings[t.b] = append(h.crossings[t.b], t.a)
+	}
+	h.borders[b] = transitions
+	return true
+}
+
+// longRun is the length of a run from which it gets a transition at both
+// ends instead of one in the middle.
+const longRun = 6
+
+// entrances returns the transitions of every run of cells along a border
+// that can be crossed. cell returns the k-th of n cells on the
+// near side of the border, across is the direction of the far side and
+// along the direction of the next cell on the border. A run ends where
+// the cells on either side of the border are not connected to each other,
+// so every crossing of a run can reach its transition.
+func (h *HPA) entrances(n int, cell func(k int) point.P, across, along direction.Direction) []transition {
+	var transitions []transition
+	start := -1
+	end := func(k int) {
+		switch {
+		case start < 0:
+		case k-start >= longRun:
+			for _, a := range []point.P{cell(start), cell(k - 1)} {
+				transitions = append(transitions, transition{a, grid.Add(a, across)})
+			}
+		default:
+			a := cell((start + k - 1) / 2)
+			transitions = append(transitions, transition{a, grid.Add(a, across)})
+		}
+		start = -1
+	}
+	for k := range n {
+		a := cell(k)
+		if !h.open(a, across) {
+			end(k)
+			continue
+		}
+		if start >= 0 {
+			prev := cell(k - 1)
+			if !h.open(prev, along) || !h.open(grid.Add(prev, across), along) {
+				end(k)
+			}
+		}
+		if start < 0 {
+			start = k
+		}
+	}
+	end(n)
+	return transitions
+}
+
+// open reports whether the move from p in direction d and back are possible.
+func (h *HPA) open(p point.P, d direction.Direction) bool {
+	return h.terrain.Traversable(p, d) && h.terrain.Traversable(grid.Add(p, d), d.Opposite())
+}
+
+// link collects the entrances of the cluster and computes the links
+// between them.
+func (h *HPA) link(c *cluster) {
+	h.rebuilt++
+	c.entrances = c.entrances[:0]
+	for y := c.y; y < c.y+c.h; y++ {
+		for x := c.x; x < c.x+c.w; x++ {
+			if p := point.New3(x, y, c.z); len(h.crossings[p]) > 0 {
+				c.entrances = append(c.entrances, p)
+			}
+		}
+	}
+	c.links = make(map[point.P][]link, len(c.entrances))
+	for _, e := range c.entrances {
+		t := h.search(c.area, e, nil, false)
+		for _, f := range c.entrances {
+			if cost, ok := t.cost(f); ok && f != e {
+				c.links[e] = append(c.links[e], link{f, cost})
+			}
+		}
+	}
+}
+
+// Invalidate recalculates the clusters around cells that changed. The
+// borders of the clusters that hold a changed cell are computed again, and
+// the links of every cluster whose entrances changed.
+func (h *HPA) Invalidate(changed ...point.P) {
+	dirty := make(map[int]bool)
+	for _, p := range changed {
+		i := h.index(p)
+		if i < 0 {
+			continue
+		}
+		dirty[i] = true
+		// the moves from the cell and from around it, where the cell can
+		// be the target or the corner of a move
+		for y := max(p.Y-1, 0); y <= min(p.Y+1, h.terrain.Height()-1); y++ {
+			for x := max(p.X-1, 0); x <= min(p.X+1, h.terrain.Width()-1); x++ {
+				h.costs[(p.Z*h.terrain.Height()+y)*h.terrain.Width()+x] = [len(moves)]float32{}
+			}
+		}
+	}
+	affected := make(map[int]bool, len(dirty))
+	for i := range dirty {
+		affected[i] = true
+		for _, j := range h.neighbors(i) {
+			b := border{min(i, j), max(i, j)}
+			if h.connect(b) {
+				affected[j] = true
+			}
+		}
+	}
+	for _, i := range slices.Sorted(func(yield func(int) bool) {
+		for i := range affected {
+			if !yield(i) {
+				return
+			}
+		}
+	}) {
+		h.link(h.clusters[i])
+	}
+}
+
+// Find returns the path from start to end, including both, or nil if there
+// is none.
+func (h *HPA) Find(start, end point.P) []point.P {
+	if start == end {
+		return []point.P{start}
+	}
+	si, ei := h.index(start), h.index(end)
+	if si < 0 || ei < 0 {
+		return nil
+	}
+	sc, ec := h.clusters[si], h.clusters[ei]
+	fromStart := h.search(sc.area, start, nil, false)
+	toEnd := h.search(ec.area, end, nil, true)
+
+	var direct []point.P
+	if sc.z == ec.z && abs(sc.x-ec.x) <= h.size && abs(sc.y-ec.y) <= h.size {
+		// the clusters touch, the cheapest path may not leave them
+		bounds := h.rect(min(sc.x, ec.x), min(sc.y, ec.y), max(sc.x+sc.w, ec.x+ec.w), max(sc.y+sc.h, ec.y+ec.h), sc.z)
+		direct = h.segment(bounds, start, end)
+	}
+
+	route := h.route(start, end, sc, ec, fromStart, toEnd, direct)
+	if route == nil {
+		return nil
+	}
+	path := []point.P{start}
+	for k := 1; k < len(route); k++ {
+		from, to := route[k-1], route[k]
+		c := h.clusters[h.index(from)]
+		switch {
+		case from == start && to == end && direct != nil:
+			path = append(path, direct...)
+		case !c.contains(to):
+			path = append(path, to) // a transition is a single move
+		default:
+			path = append(path, h.segment(c.area, from, to)...)
+		}
+	}
+	// the route passes the middle of the entrances, search again around
+	// the borders to cut the corners, first in windows that end on a
+	// border and then in windows that span one
+	path = h.smooth(path, 0)
+	return h.smooth(path, h.size/2)
+}
+
+// segment returns the cheapest path from one cell to the other inside the
+// area, without the cell it starts from, or nil if there is none.
+func (h *HPA) segment(a *area, from, to point.P) []point.P {
+	return h.search(a, from, &to, false).path(to)
+}
+
+// margin is the number of cells around a window of the path that smoothing
+// searches.
+const margin = 2
+
+// smooth searches the path again in windows of the size of a cluster, the
+// first window ending offset cells into the path. A window ends early
+// where the path changes level. Searches are bounded by the cells of the
+// window and a margin around them, so they are cheap, and a part of the
+// path is only replaced by a cheaper one.
+func (h *HPA) smooth(path []point.P, offset int) []point.P {
+	smooth := []point.P{path[0]}
+	for i := 0; i < len(path)-1; {
+		j := min(i+h.size, len(path)-1)
+		if i == 0 && offset > 0 {
+			j = min(offset, j)
+		}
+		for k := i + 1; k <= j; k++ {
+			if path[k].Z != path[i].Z {
+				j = k - 1
+				break
+			}
+		}
+		if j <= i+1 {
+			// a single move, or a move to another level
+			smooth = append(smooth, path[i+1])
+			i++
+			continue
+		}
+		window := path[i : j+1]
+		x0, y0, x1, y1 := window[0].X, window[0].Y, window[0].X, window[0].Y
+		for _, p := range window[1:] {
+			x0, y0, x1, y1 = min(x0, p.X), min(y0, p.Y), max(x1, p.X), max(y1, p.Y)
+		}
+		bounds := h.rect(x0-margin, y0-margin, x1+1+margin, y1+1+margin, window[0].Z)
+		if shorter := h.segment(bounds, path[i], path[j]); h.cost(path[i], shorter) < h.cost(path[i], window[1:]) {
+			smooth = append(smooth, shorter...)
+		} else {
+			smooth = append(smooth, window[1:]...)
+		}
+		i = j
+	}
+	return smooth
+}
+
+// cost returns the cost of the path that starts at from.
+func (h *HPA) cost(from point.P, path []point.P) float64 {
+	var total float64
+	for _, p := range path {
+		c, _ := grid.Step(h.terrain, from, direction.FromDelta(p.X-from.X, p.Y-from.Y, p.Z-from.Z))
+		total += c
+		from = p
+	}
+	return total
+}
+
+// route searches the entrances for the cheapest way from start to end. It
+// returns the cells the way passes, starting with start and ending with
+// end.
+func (h *HPA) route(start, end point.P, sc, ec *cluster, fromStart, toEnd *tree, direct []point.P) []point.P {
+	var directCost float64
+	if direct != nil {
+		directCost = h.cost(start, direct)
+	}
+	next := func(p point.P, yield func(point.P, float64)) {
+		if p == start {
+			for _, e := range sc.entrances {
+				if cost, ok := fromStart.cost(e); ok && e != start {
+					yield(e, cost)
+				}
+			}
+			if direct != nil {
+				yield(end, directCost)
+			} else if cost, ok := fromStart.cost(end); ok {
+				yield(end, cost)
+			}
+		} else if cost, ok := toEnd.cost(p); ok {
+			yield(end, cost)
+		}
+		c := h.clusters[h.index(p)]
+		for _, l := range c.links[p] {
+			yield(l.to, l.cost)
+		}
+		for _, q := range h.crossings[p] {
+			d := direction.FromDelta(q.X-p.X, q.Y-p.Y, q.Z-p.Z)
+			if cost, ok := grid.Step(h.terrain, p, d); ok {
+				yield(q, cost)
+			}
+		}
+	}
+
+	g := map[point.P]float64{start: 0}
+	parents := make(map[point.P]point.P)
+	closed := make(map[point.P]bool)
+	open := &grid.Queue[point.P]{}
+	heap.Push(open, grid.Item[point.P]{V: start, F: grid.Heuristic(start, end)})
+	for open.Len() > 0 {
+		current := heap.Pop(open).(grid.Item[point.P])
+		if closed[current.V] {
+			continue
+		}
+		if current.V == end {
+			route := []point.P{end}
+			for p := end; p != start; {
+				p = parents[p]
+				route = append(route, p)
+			}
+			slices.Reverse(route)
+			return route
+		}
+		closed[current.V] = true
+		next(current.V, func(q point.P, cost float64) {
+			if closed[q] {
+				return
+			}
+			ng := g[current.V] + cost
+			if prev, ok := g[q]; ok && ng >= prev {
+				return
+			}
+			g[q] = ng
+			parents[q] = current.V
+			heap.Push(open, grid.Item[point.P]{V: q, G: ng, F: ng + grid.Heuristic(q, end)})
+		})
+	}
+	return nil
+}
+
+// Stats describes the abstract graph of an HPA.
+type Stats struct {
+	Clusters  int
+	Entrances int
+	Rebuilt   int // number of times the links of a cluster were computed, the first time included
+}
+
+func (h *HPA) Stats() Stats {
+	s := Stats{Clusters: len(h.clusters), Rebuilt: h.rebuilt}
+	for _, c := range h.clusters {
+		s.Entrances += len(c.entrances)
+	}
+	return s
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
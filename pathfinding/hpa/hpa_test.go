@@ -0,0 +1,246 @@
+package hpa_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/hpa"
+	"github.com/dwethmar/apostle/pathfinding/internal/gridtest"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+func TestHPA_Find(t *testing.T) {
+	t.Run("straight line", func(t *testing.T) {
+		tr := terrain.New(20, 1)
+		path := hpa.New(tr, hpa.WithClusterSize(4)).Find(point.New(0, 0), point.New(19, 0))
+		if len(path) != 20 {
+			t.Fatalf("Find() returned %d cells, want 20: %v", len(path), path)
+		}
+	})
+
+	t.Run("no path", func(t *testing.T) {
+		tr := terrain.New(9, 1)
+		if err := tr.Fill(4, 0, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if path := hpa.New(tr, hpa.WithClusterSize(3)).Find(point.New(0, 0), point.New(8, 0)); path != nil {
+			t.Errorf("Find() = %v, want nil", path)
+		}
+	})
+
+	t.Run("around a wall", func(t *testing.T) {
+		// the border between the clusters can only be crossed at the bottom
+		tr, _ := ascii.MustParse(`
+########
+#..#...#
+#..#...#
+#......#
+########
+`)
+		path := hpa.New(tr, hpa.WithClusterSize(4)).Find(point.New(1, 1), point.New(6, 1))
+		if err := gridtest.Valid(tr, path); err != nil {
+			t.Fatal(err)
+		}
+		if want := astar.New(tr).Find(point.New(1, 1), point.New(6, 1)); gridtest.Cost(tr, path) != gridtest.Cost(tr, want) {
+			t.Errorf("Find() = %v, want %v", path, want)
+		}
+	})
+
+	t.Run("across levels", func(t *testing.T) {
+		s, want := gridtest.SplitLevel(t)
+		got := hpa.New(s, hpa.WithClusterSize(2)).Find(want[0], want[len(want)-1])
+		if len(got) != len(want) {
+			t.Fatalf("Find() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if !got[i].Equal(want[i]) {
+				t.Errorf("Find()[%d] = %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("locked door", func(t *testing.T) {
+		// a wall splits the terrain on the border of the clusters, the only way through is a door
+		tr := terrain.New(4, 1)
+		if err := tr.Fill(1, 0, terrain.BorderEast); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		for _, tc := range []struct {
+			state terrain.DoorState
+			want  int
+		}{
+			{terrain.DoorClosed, 4},
+			{terrain.DoorLocked, 0},
+		} {
+			if err := tr.SetDoor(1, 0, direction.East, tc.state); err != nil {
+				t.Fatalf("SetDoor() error = %v", err)
+			}
+			if path := hpa.New(tr, hpa.WithClusterSize(2)).Find(point.New(0, 0), point.New(3, 0)); len(path) != tc.want {
+				t.Errorf("Find() through %v door = %v, want %d cells", tc.state, path, tc.want)
+			}
+		}
+	})
+}
+
+// TestHPA_FindGenerated compares the paths on generated maps with the paths
+// of astar: a path is found whenever astar finds one, it only makes moves
+// that astar could make, and it is not much more expensive.
+func TestHPA_FindGenerated(t *testing.T) {
+	const maxDetour = 1.25
+	for _, tc := range []struct {
+		name      string
+		generator generate.Generator
+		size      int
+	}{
+		{"caves", generate.DefaultCaves, 8},
+		{"rooms", generate.DefaultRooms, 16},
+		{"bsp", generate.DefaultBSP, 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for seed := range uint64(3) {
+				tr := terrain.New(64, 48)
+				if _, err := generate.Generate(tr, generate.WithGenerator(tc.generator), generate.WithSeed(seed)); err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				h, a := hpa.New(tr, hpa.WithClusterSize(tc.size)), astar.New(tr)
+				cells := gridtest.Standable(tr)
+				r := rand.New(rand.NewPCG(seed, 0))
+				for range 40 {
+					start, end := cells[r.IntN(len(cells))], cells[r.IntN(len(cells))]
+					got, want := h.Find(start, end), a.Find(start, end)
+					if (got == nil) != (want == nil) {
+						t.Fatalf("seed %d: Find(%v, %v) = %v, astar found %v", seed, start, end, got, want)
+					}
+					if got == nil {
+						continue
+					}
+					if got[0] != start || got[len(got)-1] != end {
+						t.Fatalf("seed %d: Find(%v, %v) = %v, want a path from start to end", seed, start, end, got)
+					}
+					if err := gridtest.Valid(tr, got); err != nil {
+						t.Fatalf("seed %d: Find(%v, %v): %v", seed, start, end, err)
+					}
+					if c, best := gridtest.Cost(tr, got), gridtest.Cost(tr, want); c > best*maxDetour+1e-9 {
+						t.Errorf("seed %d: Find(%v, %v) costs %.2f, astar %.2f", seed, start, end, c, best)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHPA_Invalidate(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+################
+#..............#
+#.############.#
+#..............#
+################
+`)
+	h := hpa.New(tr, hpa.WithClusterSize(4))
+	start, end := point.New(1, 1), point.New(14, 1)
+	if path := h.Find(start, end); len(path) != 14 {
+		t.Fatalf("Find() returned %d cells, want 14: %v", len(path), path)
+	}
+
+	// block the top corridor, the way is now over the bottom one
+	before := h.Stats().Rebuilt
+	if err := tr.Fill(8, 1, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	h.Invalidate(point.New(8, 1))
+	path := h.Find(start, end)
+	if err := gridtest.Valid(tr, path); err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 18 {
+		t.Errorf("Find() returned %d cells, want 18: %v", len(path), path)
+	}
+	if rebuilt := h.Stats().Rebuilt - before; rebuilt > 3 {
+		t.Errorf("Invalidate() rebuilt %d clusters, want the cluster of the cell and at most its two neighbors", rebuilt)
+	}
+
+	// block the bottom corridor too
+	if err := tr.Fill(8, 3, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	h.Invalidate(point.New(8, 3))
+	if path := h.Find(start, end); path != nil {
+		t.Errorf("Find() = %v, want nil", path)
+	}
+
+	// and open the top one again
+	if err := tr.Fill(8, 1, 0); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	h.Invalidate(point.New(8, 1))
+	if path := h.Find(start, end); len(path) != 14 {
+		t.Errorf("Find() returned %d cells, want 14: %v", len(path), path)
+	}
+}
+
+// benchmarkMap is a large cave map with long routes from corner to corner.
+func benchmarkMap(b *testing.B) (*terrain.Terrain, [][2]point.P) {
+	b.Helper()
+	tr := terrain.New(256, 256)
+	if _, err := generate.Generate(tr, generate.WithGenerator(generate.DefaultCaves), generate.WithSeed(1)); err != nil {
+		b.Fatalf("Generate() error = %v", err)
+	}
+	cells := gridtest.Standable(tr)
+	r := rand.New(rand.NewPCG(1, 0))
+	var routes [][2]point.P
+	for len(routes) < 16 {
+		start, end := cells[r.IntN(len(cells))], cells[r.IntN(len(cells))]
+		if max(abs(start.X-end.X), abs(start.Y-end.Y)) >= 128 {
+			routes = append(routes, [2]point.P{start, end})
+		}
+	}
+	return tr, routes
+}
+
+func BenchmarkFind(b *testing.B) {
+	tr, routes := benchmarkMap(b)
+	for _, bc := range []struct {
+		name   string
+		finder interface {
+			Find(start, end point.P) []point.P
+		}
+	}{
+		{"astar", astar.New(tr)},
+		{"hpa", hpa.New(tr)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				route := routes[i%len(routes)]
+				bc.finder.Find(route[0], route[1])
+			}
+		})
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	tr, _ := benchmarkMap(b)
+	for b.Loop() {
+		hpa.New(tr)
+	}
+}
+
+func BenchmarkInvalidate(b *testing.B) {
+	tr, _ := benchmarkMap(b)
+	h := hpa.New(tr)
+	for i := 0; b.Loop(); i++ {
+		h.Invalidate(point.New(i*7%tr.Width(), i*13%tr.Height()))
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
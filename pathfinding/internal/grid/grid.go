@@ -0,0 +1,118 @@
+// Package grid holds the rules for moving over a terrain that the path
+// finders share, so that they agree on which moves are possible and on what
+// they cost.
+package grid
+
+import (
+	"cmp"
+	"math"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+)
+
+// Terrain is the part of a terrain that the rules need. Traversable must
+// return false for moves that leave the terrain.
+type Terrain interface {
+	Traversable(p point.P, d direction.Direction) bool
+}
+
+// Leveled is implemented by terrains with more than one level.
+type Leveled interface {
+	Levels() int
+}
+
+// Costed is implemented by terrains where some cells are more expensive to
+// move onto than others. Costs must not be below 1, otherwise Heuristic
+// overestimates and paths may not be the cheapest.
+type Costed interface {
+	MoveCost(p point.P) float64
+}
+
+// Doored is implemented by terrains with doors that take extra time to pass.
+type Doored interface {
+	DoorCost(p point.P, d direction.Direction) float64
+}
+
+// Levels returns the number of levels of the terrain, 1 if it is not
+// Leveled.
+func Levels(t Terrain) int {
+	if l, ok := t.(Leveled); ok {
+		return l.Levels()
+	}
+	return 1
+}
+
+// Step returns the cost of the move from p in direction d, and false if the
+// move is not possible. A diagonal move needs both orthogonal moves around
+// its corner to be possible, so it never cuts a corner past a wall, a Solid
+// cell or a door.
+func Step(t Terrain, p point.P, d direction.Direction) (float64, bool) {
+	if !t.Traversable(p, d) {
+		return 0, false
+	}
+	cost := 1.0
+	if d.Diagonal() {
+		vertical, horizontal := d.Split()
+		if !t.Traversable(p, vertical) || !t.Traversable(p, horizontal) {
+			return 0, false
+		}
+		if !t.Traversable(Add(p, vertical), horizontal) || !t.Traversable(Add(p, horizontal), vertical) {
+			return 0, false
+		}
+		cost = math.Sqrt2
+	}
+	if c, ok := t.(Costed); ok {
+		cost *= c.MoveCost(Add(p, d))
+	}
+	if dc, ok := t.(Doored); ok {
+		cost += dc.DoorCost(p, d)
+	}
+	return cost, true
+}
+
+// Add returns the cell next to p in direction d.
+func Add(p point.P, d direction.Direction) point.P {
+	dx, dy, dz := d.Delta()
+	return point.New3(p.X+dx, p.Y+dy, p.Z+dz)
+}
+
+// Heuristic is the octile distance, the cost of the path if every cell
+// costs 1.
+func Heuristic(a, b point.P) float64 {
+	dx := math.Abs(float64(a.X - b.X))
+	dy := math.Abs(float64(a.Y - b.Y))
+	dz := math.Abs(float64(a.Z - b.Z))
+	return dx + dy + (math.Sqrt2-2)*math.Min(dx, dy) + dz
+}
+
+// Item is a value in a Queue, with the cost of the way to it and the
+// estimated cost of the whole path over it.
+type Item[T any] struct {
+	V    T
+	G, F float64
+}
+
+// Queue is a priority queue for container/heap.
+type Queue[T any] []Item[T]
+
+func (q Queue[T]) Len() int { return len(q) }
+
+// Less prioritizes lower F, and uses G as a tiebreaker
+func (q Queue[T]) Less(i, j int) bool {
+	if q[i].F == q[j].F {
+		return cmp.Less(q[j].G, q[i].G)
+	}
+	return q[i].F < q[j].F
+}
+
+func (q Queue[T]) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *Queue[T]) Push(x any) { *q = append(*q, x.(Item[T])) }
+
+func (q *Queue[T]) Pop() any {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,104 @@
+// Package gridtest holds what the tests of the path finders share: checks
+// that a path follows the rules of astar, and terrains to search on.
+package gridtest
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// Terrain is the terrain paths are checked on. It is satisfied by
+// terrain.Terrain and terrain.Stack.
+type Terrain interface {
+	Traversable(p point.P, d direction.Direction) bool
+	MoveCost(p point.P) float64
+	DoorCost(p point.P, d direction.Direction) float64
+}
+
+// Valid returns an error if there is no path or it makes a move that astar
+// can not make.
+func Valid(t Terrain, path []point.P) error {
+	if len(path) == 0 {
+		return fmt.Errorf("no path")
+	}
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		d := direction.FromDelta(b.X-a.X, b.Y-a.Y, b.Z-a.Z)
+		if d == direction.None || !t.Traversable(a, d) {
+			return fmt.Errorf("path %v makes an impossible move from %v to %v", path, a, b)
+		}
+		if d.Diagonal() {
+			v, h := d.Split()
+			dvx, dvy, _ := v.Delta()
+			dhx, dhy, _ := h.Delta()
+			if !t.Traversable(a, v) || !t.Traversable(a, h) ||
+				!t.Traversable(point.New3(a.X+dvx, a.Y+dvy, a.Z), h) || !t.Traversable(point.New3(a.X+dhx, a.Y+dhy, a.Z), v) {
+				return fmt.Errorf("path %v cuts the corner from %v to %v", path, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// Cost returns the cost of the path the way astar counts it.
+func Cost(t Terrain, path []point.P) float64 {
+	var c float64
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		d := direction.FromDelta(b.X-a.X, b.Y-a.Y, b.Z-a.Z)
+		step := 1.0
+		if d.Diagonal() {
+			step = math.Sqrt2
+		}
+		c += step*t.MoveCost(b) + t.DoorCost(a, d)
+	}
+	return c
+}
+
+// Standable returns the cells that can be stood on, in the order of Walk.
+func Standable(t interface {
+	Walk() iter.Seq[terrain.Step]
+	Standable(p point.P) bool
+}) []point.P {
+	var cells []point.P
+	for step := range t.Walk() {
+		if p := point.New3(step.X, step.Y, step.Z); t.Standable(p) {
+			cells = append(cells, p)
+		}
+	}
+	return cells
+}
+
+// SplitLevel returns a stack of two levels whose level 0 is split by a wall,
+// so the only way around is over level 1, and that path from one end of
+// level 0 to the other.
+func SplitLevel(t testing.TB) (*terrain.Stack, []point.P) {
+	t.Helper()
+	s := terrain.NewStack(4, 1, 2)
+	for _, c := range []struct {
+		p    point.P
+		cell terrain.Cell
+	}{
+		{point.New3(1, 0, 0), terrain.Stairs},
+		{point.New3(2, 0, 0), terrain.Solid},
+		{point.New3(3, 0, 0), terrain.Stairs},
+	} {
+		if err := s.Fill(c.p, c.cell); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+	}
+	return s, []point.P{
+		point.New3(0, 0, 0),
+		point.New3(1, 0, 0),
+		point.New3(1, 0, 1),
+		point.New3(2, 0, 1),
+		point.New3(3, 0, 1),
+		point.New3(3, 0, 0),
+	}
+}
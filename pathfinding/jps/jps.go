@@ -0,0 +1,284 @@
+// Package jps finds paths with jump point search. On open ground A* adds
+// every cell it passes to its queue. Jump point search instead jumps in a
+// straight line until something forces it to turn, such as a wall that
+// ends, and only queues the cells where it stopped.
+//
+// It follows the same rules as package astar: a diagonal move needs both
+// orthogonal moves around its corner to be possible. The paths are the
+// cheapest on terrain where every move onto a cell costs the same and no
+// closed doors are in the way. Where moves cost differently a path is still
+// found whenever there is one, but it may not be the cheapest.
+package jps
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/internal/grid"
+	"github.com/dwethmar/apostle/point"
+)
+
+// Terrain is the part of a terrain that the search needs. It is satisfied by
+// terrain.Terrain, terrain.Chunked and terrain.Stack. Traversable must
+// return false for moves that leave the terrain.
+type Terrain interface {
+	Traversable(p point.P, d direction.Direction) bool
+}
+
+// move is a move within a level.
+type move struct {
+	dx, dy int
+	d      direction.Direction
+}
+
+var (
+	north = move{0, -1, direction.North}
+	south = move{0, 1, direction.South}
+	east  = move{1, 0, direction.East}
+	west  = move{-1, 0, direction.West}
+
+	moves = []move{
+		north, south, east, west,
+		{1, -1, direction.NorthEast},
+		{-1, -1, direction.NorthWest},
+		{1, 1, direction.SouthEast},
+		{-1, 1, direction.SouthWest},
+	}
+)
+
+// toward returns the move from a to b, which are on a straight or diagonal
+// line on the same level.
+func toward(a, b point.P) move {
+	dx, dy := cmp.Compare(b.X, a.X), cmp.Compare(b.Y, a.Y)
+	for _, m := range moves {
+		if m.dx == dx && m.dy == dy {
+			return m
+		}
+	}
+	return move{}
+}
+
+func (m move) diagonal() bool {
+	return m.dx != 0 && m.dy != 0
+}
+
+// split returns the orthogonal moves that a diagonal move is made of.
+func (m move) split() (horizontal, vertical move) {
+	horizontal, vertical = east, south
+	if m.dx < 0 {
+		horizontal = west
+	}
+	if m.dy < 0 {
+		vertical = north
+	}
+	return horizontal, vertical
+}
+
+// JPS implements the PathFinder interface using jump point search.
+type JPS struct {
+	terrain Terrain
+	levels  bool // whether the terrain has stairs to look for
+}
+
+func New(t Terrain) *JPS {
+	return &JPS{terrain: t, levels: grid.Levels(t) > 1}
+}
+
+// node is a cell where a jump stopped, with the move that led to it. The
+// move is the zero move for the start and for cells reached over stairs.
+type node struct {
+	p    point.P
+	from move
+}
+
+// Find returns the path from start to end, including both and every cell in
+// between, or nil if there is none.
+func (j *JPS) Find(start, end point.P) []point.P {
+	if start == end {
+		return []point.P{start}
+	}
+	g := map[point.P]float64{start: 0}
+	parents := make(map[point.P]point.P)
+	closed := make(map[point.P]bool)
+	open := &grid.Queue[node]{}
+	heap.Push(open, grid.Item[node]{V: node{p: start}, F: grid.Heuristic(start, end)})
+	for open.Len() > 0 {
+		current := heap.Pop(open).(grid.Item[node])
+		if closed[current.V.p] {
+			continue
+		}
+		closed[current.V.p] = true
+		if current.V.p == end {
+			return path(parents, start, end)
+		}
+		for _, next := range j.successors(current.V, end) {
+			if closed[next.V.p] {
+				continue
+			}
+			ng := g[current.V.p] + next.G
+			if prev, ok := g[next.V.p]; ok && ng >= prev {
+				continue
+			}
+			g[next.V.p] = ng
+			parents[next.V.p] = current.V.p
+			heap.Push(open, grid.Item[node]{V: next.V, G: ng, F: ng + grid.Heuristic(next.V.p, end)})
+		}
+	}
+	return nil
+}
+
+// successors returns the cells where the jumps from the node stop, with the
+// cost of each jump.
+func (j *JPS) successors(n node, end point.P) []grid.Item[node] {
+	var successors []grid.Item[node]
+	for _, m := range j.directions(n) {
+		if p, cost, ok := j.jump(n.p, m, end); ok {
+			successors = append(successors, grid.Item[node]{V: node{p: p, from: m}, G: cost})
+		}
+	}
+	for _, d := range []direction.Direction{direction.Up, direction.Down} {
+		if cost, ok := grid.Step(j.terrain, n.p, d); ok {
+			_, _, dz := d.Delta()
+			successors = append(successors, grid.Item[node]{V: node{p: point.New3(n.p.X, n.p.Y, n.p.Z+dz)}, G: cost})
+		}
+	}
+	return successors
+}
+
+// directions returns the moves to jump in from the node. Every move is
+// tried from the start and after stairs. After a diagonal move only the
+// moves that keep going the same way are tried, after an orthogonal move
+// also the turns to the sides, which are only needed where the jump was
+// forced to stop.
+func (j *JPS) directions(n node) []move {
+	if n.from == (move{}) {
+		return moves
+	}
+	if n.from.diagonal() {
+		horizontal, vertical := n.from.split()
+		return []move{horizontal, vertical, n.from}
+	}
+	var directions []move
+	directions = append(directions, n.from)
+	for _, side := range sides(n.from) {
+		directions = append(directions, side, move{n.from.dx + side.dx, n.from.dy + side.dy, diagonal(n.from, side)})
+	}
+	return directions
+}
+
+// sides returns the orthogonal moves at a right angle to an orthogonal move.
+func sides(m move) []move {
+	if m.dx != 0 {
+		return []move{north, south}
+	}
+	return []move{east, west}
+}
+
+// diagonal returns the direction of the diagonal move made of two
+// orthogonal moves.
+func diagonal(a, b move) direction.Direction {
+	for _, m := range moves {
+		if m.dx == a.dx+b.dx && m.dy == a.dy+b.dy {
+			return m.d
+		}
+	}
+	return direction.None
+}
+
+// jump moves from p in the direction of m until it reaches the end, stairs
+// or a cell where it is forced to turn. It returns that cell with the cost
+// of getting there, and false if the jump runs into something first.
+func (j *JPS) jump(p point.P, m move, end point.P) (point.P, float64, bool) {
+	if !m.diagonal() {
+		return j.straight(p, m, end)
+	}
+	horizontal, vertical := m.split()
+	var total float64
+	for {
+		cost, ok := grid.Step(j.terrain, p, m.d)
+		if !ok {
+			return point.P{}, 0, false
+		}
+		p = point.New3(p.X+m.dx, p.Y+m.dy, p.Z)
+		total += cost
+		if p == end || j.stairs(p) {
+			return p, total, true
+		}
+		// a diagonal jump stops where one of its orthogonal parts would
+		if _, _, ok := j.straight(p, horizontal, end); ok {
+			return p, total, true
+		}
+		if _, _, ok := j.straight(p, vertical, end); ok {
+			return p, total, true
+		}
+	}
+}
+
+// straight is jump for orthogonal moves. A cell forces the jump to stop if
+// it can move to a side while the cell before it can not move diagonally
+// to the same cell, so the side can only be reached cheapest over the
+// cell. Whether a cell can move to the sides is kept for the next cell.
+func (j *JPS) straight(p point.P, m move, end point.P) (point.P, float64, bool) {
+	sides := sides(m)
+	var open [2]bool
+	for k, side := range sides {
+		open[k] = j.terrain.Traversable(p, side.d)
+	}
+	var total float64
+	for {
+		cost, ok := grid.Step(j.terrain, p, m.d)
+		if !ok {
+			return point.P{}, 0, false
+		}
+		prev := p
+		p = point.New3(p.X+m.dx, p.Y+m.dy, p.Z)
+		total += cost
+		if p == end || j.stairs(p) {
+			return p, total, true
+		}
+		for k, side := range sides {
+			next := j.terrain.Traversable(p, side.d)
+			// the move from prev to p and from p to the side are possible,
+			// the diagonal needs the other two around its corner
+			cut := open[k] &&
+				j.terrain.Traversable(point.New3(prev.X+side.dx, prev.Y+side.dy, prev.Z), m.d) &&
+				j.terrain.Traversable(prev, diagonal(m, side))
+			if next && !cut {
+				return p, total, true
+			}
+			open[k] = next
+		}
+	}
+}
+
+// stairs reports whether p is a cell where the search can change level.
+func (j *JPS) stairs(p point.P) bool {
+	return j.levels && (j.terrain.Traversable(p, direction.Up) || j.terrain.Traversable(p, direction.Down))
+}
+
+// path fills in the cells between the jump points from start to end.
+func path(parents map[point.P]point.P, start, end point.P) []point.P {
+	jumps := []point.P{end}
+	for p := end; p != start; {
+		p = parents[p]
+		jumps = append(jumps, p)
+	}
+	slices.Reverse(jumps)
+
+	path := []point.P{start}
+	for i := 1; i < len(jumps); i++ {
+		from, to := jumps[i-1], jumps[i]
+		if from.Z != to.Z {
+			path = append(path, to)
+			continue
+		}
+		m := toward(from, to)
+		for p := from; p != to; {
+			p = point.New3(p.X+m.dx, p.Y+m.dy, p.Z)
+			path = append(path, p)
+		}
+	}
+	return path
+}
@@ -0,0 +1,220 @@
+package jps_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/internal/gridtest"
+	"github.com/dwethmar/apostle/pathfinding/jps"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+func TestJPS_Find(t *testing.T) {
+	t.Run("straight line", func(t *testing.T) {
+		tr := terrain.New(5, 1)
+		path := jps.New(tr).Find(point.New(0, 0), point.New(4, 0))
+		if len(path) != 5 {
+			t.Fatalf("Find() returned %d cells, want 5: %v", len(path), path)
+		}
+	})
+
+	t.Run("no path", func(t *testing.T) {
+		tr := terrain.New(3, 1)
+		if err := tr.Fill(1, 0, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if path := jps.New(tr).Find(point.New(0, 0), point.New(2, 0)); path != nil {
+			t.Errorf("Find() = %v, want nil", path)
+		}
+	})
+
+	t.Run("around walls", func(t *testing.T) {
+		tr, _ := ascii.MustParse(`
+#########
+#.......#
+#.#####.#
+#...#...#
+###.#.###
+#.......#
+#########
+`)
+		start, end := point.New(1, 1), point.New(5, 3)
+		got, want := jps.New(tr).Find(start, end), astar.New(tr).Find(start, end)
+		if err := gridtest.Valid(tr, got); err != nil {
+			t.Fatal(err)
+		}
+		if gridtest.Cost(tr, got) != gridtest.Cost(tr, want) {
+			t.Errorf("Find() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("across levels", func(t *testing.T) {
+		s, want := gridtest.SplitLevel(t)
+		got := jps.New(s).Find(want[0], want[len(want)-1])
+		if len(got) != len(want) {
+			t.Fatalf("Find() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if !got[i].Equal(want[i]) {
+				t.Errorf("Find()[%d] = %v, want %v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("locked door", func(t *testing.T) {
+		// a wall splits the terrain, the only way through is a door
+		tr := terrain.New(2, 1)
+		if err := tr.Fill(0, 0, terrain.BorderEast); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		for _, tc := range []struct {
+			state terrain.DoorState
+			want  int
+		}{
+			{terrain.DoorClosed, 2},
+			{terrain.DoorLocked, 0},
+		} {
+			if err := tr.SetDoor(0, 0, direction.East, tc.state); err != nil {
+				t.Fatalf("SetDoor() error = %v", err)
+			}
+			if path := jps.New(tr).Find(point.New(0, 0), point.New(1, 0)); len(path) != tc.want {
+				t.Errorf("Find() through %v door = %v, want %d cells", tc.state, path, tc.want)
+			}
+		}
+	})
+}
+
+// TestJPS_FindGenerated compares the paths on generated maps with the paths
+// of astar. A path is found whenever astar finds one and it only makes moves
+// that astar could make. Where every move onto a cell costs the same, it
+// costs the same as the path of astar.
+func TestJPS_FindGenerated(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		generator generate.Generator
+	}{
+		{"caves", generate.DefaultCaves},
+		{"rooms", generate.DefaultRooms},
+		{"bsp", generate.DefaultBSP},
+		{"field", generate.DefaultField},
+		{"outdoor", generate.DefaultOutdoor},
+	} {
+		for _, uniform := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s uniform=%t", tc.name, uniform), func(t *testing.T) {
+				for seed := range uint64(4) {
+					s := terrain.NewStack(48, 32, 2)
+					if _, err := generate.GenerateStack(s, 3, generate.WithGenerator(tc.generator), generate.WithSeed(seed)); err != nil {
+						t.Fatalf("GenerateStack() error = %v", err)
+					}
+					if uniform {
+						flatten(t, s)
+					}
+					j, a := jps.New(s), astar.New(s)
+					cells := gridtest.Standable(s)
+					r := rand.New(rand.NewPCG(seed, 0))
+					for range 40 {
+						start, end := cells[r.IntN(len(cells))], cells[r.IntN(len(cells))]
+						got, want := j.Find(start, end), a.Find(start, end)
+						if (got == nil) != (want == nil) {
+							t.Fatalf("seed %d: Find(%v, %v) = %v, astar found %v", seed, start, end, got, want)
+						}
+						if got == nil {
+							continue
+						}
+						if got[0] != start || got[len(got)-1] != end {
+							t.Fatalf("seed %d: Find(%v, %v) = %v, want a path from start to end", seed, start, end, got)
+						}
+						if err := gridtest.Valid(s, got); err != nil {
+							t.Fatalf("seed %d: Find(%v, %v): %v", seed, start, end, err)
+						}
+						if c, best := gridtest.Cost(s, got), gridtest.Cost(s, want); uniform && math.Abs(c-best) > 1e-9 {
+							t.Errorf("seed %d: Find(%v, %v) costs %.2f, astar %.2f", seed, start, end, c, best)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// flatten makes every move onto a cell cost the same: walkable cells are
+// turned into stone and closed doors are opened.
+func flatten(t *testing.T, s *terrain.Stack) {
+	t.Helper()
+	for step := range s.Walk() {
+		p := point.New3(step.X, step.Y, step.Z)
+		if step.Material.Walkable() {
+			if err := s.SetMaterial(p, terrain.Stone); err != nil {
+				t.Fatalf("SetMaterial() error = %v", err)
+			}
+		}
+		for _, side := range []direction.Direction{direction.North, direction.West} {
+			if err := s.OpenDoor(p, side); err != nil {
+				t.Fatalf("OpenDoor() error = %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkFind(b *testing.B) {
+	open := terrain.New(128, 128)
+	// a wall between start and end, which astar floods the space in front of
+	wall := terrain.New(128, 128)
+	for y := 10; y < 118; y++ {
+		if err := wall.Fill(64, y, terrain.Solid); err != nil {
+			b.Fatalf("Fill() error = %v", err)
+		}
+	}
+	caves := terrain.New(128, 128)
+	if _, err := generate.Generate(caves, generate.WithGenerator(generate.DefaultCaves), generate.WithSeed(1)); err != nil {
+		b.Fatalf("Generate() error = %v", err)
+	}
+	for _, m := range []struct {
+		name  string
+		t     *terrain.Terrain
+		start point.P
+		end   point.P
+	}{
+		{"open", open, point.New(0, 0), point.New(127, 100)},
+		{"wall", wall, point.New(40, 64), point.New(100, 64)},
+		{"caves", caves, farthest(caves, false), farthest(caves, true)},
+	} {
+		for _, f := range []struct {
+			name   string
+			finder interface {
+				Find(start, end point.P) []point.P
+			}
+		}{
+			{"astar", astar.New(m.t)},
+			{"jps", jps.New(m.t)},
+		} {
+			b.Run(m.name+"/"+f.name, func(b *testing.B) {
+				for b.Loop() {
+					f.finder.Find(m.start, m.end)
+				}
+			})
+		}
+	}
+}
+
+// farthest returns the first cell that can be stood on from the top left,
+// or from the bottom right if last is true.
+func farthest(t *terrain.Terrain, last bool) point.P {
+	var cell point.P
+	for step := range t.Walk() {
+		if p := point.New(step.X, step.Y); t.Standable(p) {
+			cell = p
+			if !last {
+				break
+			}
+		}
+	}
+	return cell
+}
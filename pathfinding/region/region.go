@@ -0,0 +1,258 @@
+// Package region groups the cells of a terrain into regions of cells that
+// can reach each other, so reachability can be answered without a search.
+package region
+
+import (
+	"iter"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// None is returned as the region of cells that can not be stood on.
+const None = 0
+
+// Terrain is the part of a terrain that the index needs. It is satisfied by
+// terrain.Terrain and terrain.Stack.
+type Terrain interface {
+	Walk() iter.Seq[terrain.Step]
+	Standable(p point.P) bool
+	Traversable(p point.P, d direction.Direction) bool
+}
+
+// Diagonal moves are left out: A* only moves diagonally when both
+// orthogonal moves are possible, so they never connect extra cells.
+var directions = []direction.Direction{
+	direction.North,
+	direction.South,
+	direction.East,
+	direction.West,
+	direction.Up,
+	direction.Down,
+}
+
+var offsets = map[direction.Direction]point.P{
+	direction.North: {X: 0, Y: -1},
+	direction.South: {X: 0, Y: 1},
+	direction.East:  {X: 1, Y: 0},
+	direction.West:  {X: -1, Y: 0},
+	direction.Up:    {Z: 1},
+	direction.Down:  {Z: -1},
+}
+
+// Index assigns a region ID to every cell that can be stood on. Two cells
+// with the same region ID can reach each other.
+type Index struct {
+	terrain Terrain
+	regions map[point.P]int
+	members map[int][]point.P
+	nextID  int
+}
+
+// New builds the index for the terrain.
+func New(t Terrain) *Index {
+	i := &Index{terrain: t}
+	i.Rebuild()
+	return i
+}
+
+// Rebuild recalculates all regions from scratch.
+func (i *Index) Rebuild() {
+	i.regions = make(map[point.P]int)
+	i.members = make(map[int][]point.P)
+	i.nextID = None + 1
+	for s := range i.terrain.Walk() {
+		p := point.New3(s.X, s.Y, s.Z)
+		if _, ok := i.regions[p]; !ok && i.terrain.Standable(p) {
+			i.flood(p)
+		}
+	}
+}
+
+// Region returns the region of the cell at p, or None if it can not be stood on.
+func (i *Index) Region(p point.P) int {
+	return i.regions[p]
+}
+
+// Regions returns the number of regions.
+func (i *Index) Regions() int {
+	return len(i.members)
+}
+
+// Cells returns the cells of the region in the order they were flooded.
+func (i *Index) Cells(region int) []point.P {
+	return slices.Clone(i.members[region])
+}
+
+// Reachable reports whether b can be reached from a.
+func (i *Index) Reachable(a, b point.P) bool {
+	ra := i.regions[a]
+	return ra != None && ra == i.regions[b]
+}
+
+// Update recalculates the regions around cells that changed. Only the
+// regions that touch a changed cell are flooded again, so regions that
+// were split or joined by the change are updated.
+func (i *Index) Update(changed ...point.P) {
+	if len(changed) == 0 {
+		return
+	}
+
+	// collect the cells of every region that touches a changed cell
+	affected := make(map[int]struct{})
+	var seeds []point.P
+	for _, c := range changed {
+		seeds = append(seeds, c)
+		for _, p := range append([]point.P{c}, neighbors(c)...) {
+			if r := i.regions[p]; r != None {
+				affected[r] = struct{}{}
+			}
+		}
+	}
+	for r := range affected {
+		for _, p := range i.members[r] {
+			delete(i.regions, p)
+			seeds = append(seeds, p)
+		}
+		delete(i.members, r)
+	}
+
+	for _, p := range seeds {
+		if _, ok := i.regions[p]; ok {
+			continue
+		}
+		if i.terrain.Standable(p) {
+			i.flood(p)
+		}
+	}
+}
+
+// Splits returns the regions that would fall apart if the moves for which
+// blocked returns true were no longer possible, such as when a wall is
+// built. around are the cells next to the change; only their regions are
+// checked.
+func (i *Index) Splits(blocked func(p point.P, d direction.Direction) bool, around ...point.P) []int {
+	groups := make(map[int][]point.P)
+	var order []int
+	for _, p := range around {
+		r := i.regions[p]
+		if r == None {
+			continue
+		}
+		if _, ok := groups[r]; !ok {
+			order = append(order, r)
+		}
+		groups[r] = append(groups[r], p)
+	}
+
+	var split []int
+	for _, r := range order {
+		if cells := groups[r]; len(cells) > 1 && !i.connected(blocked, cells[0], cells[1:]) {
+			split = append(split, r)
+		}
+	}
+	return split
+}
+
+// Parts returns the parts that the regions Splits returns would fall apart
+// in: for each of them the cells that can still reach each other without the
+// blocked moves. Parts of different regions are returned together.
+func (i *Index) Parts(blocked func(p point.P, d direction.Direction) bool, around ...point.P) [][]point.P {
+	split := i.Splits(blocked, around...)
+	if len(split) == 0 {
+		return nil
+	}
+	seen := make(map[point.P]struct{})
+	var parts [][]point.P
+	for _, p := range around {
+		if _, ok := seen[p]; ok || !slices.Contains(split, i.regions[p]) {
+			continue
+		}
+		seen[p] = struct{}{}
+		part := []point.P{p}
+		for k := 0; k < len(part); k++ {
+			for _, d := range directions {
+				n := add(part[k], offsets[d])
+				if _, ok := seen[n]; ok {
+					continue
+				}
+				if blocked(part[k], d) || !i.terrain.Traversable(part[k], d) {
+					continue
+				}
+				seen[n] = struct{}{}
+				part = append(part, n)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// connected reports whether every target can be reached from start without
+// the blocked moves. The search stops as soon as all targets are found.
+func (i *Index) connected(blocked func(p point.P, d direction.Direction) bool, start point.P, targets []point.P) bool {
+	left := make(map[point.P]struct{}, len(targets))
+	for _, t := range targets {
+		left[t] = struct{}{}
+	}
+	delete(left, start)
+
+	seen := map[point.P]struct{}{start: {}}
+	queue := []point.P{start}
+	for len(queue) > 0 && len(left) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, d := range directions {
+			n := add(p, offsets[d])
+			if _, ok := seen[n]; ok {
+				continue
+			}
+			if blocked(p, d) || !i.terrain.Traversable(p, d) {
+				continue
+			}
+			seen[n] = struct{}{}
+			delete(left, n)
+			queue = append(queue, n)
+		}
+	}
+	return len(left) == 0
+}
+
+// flood assigns a new region to every cell that can be reached from start.
+func (i *Index) flood(start point.P) {
+	id := i.nextID
+	i.nextID++
+
+	i.regions[start] = id
+	queue := []point.P{start}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		i.members[id] = append(i.members[id], p)
+		for _, d := range directions {
+			n := add(p, offsets[d])
+			if _, ok := i.regions[n]; ok {
+				continue
+			}
+			if !i.terrain.Traversable(p, d) {
+				continue
+			}
+			i.regions[n] = id
+			queue = append(queue, n)
+		}
+	}
+}
+
+func neighbors(p point.P) []point.P {
+	n := make([]point.P, 0, len(directions))
+	for _, d := range directions {
+		n = append(n, add(p, offsets[d]))
+	}
+	return n
+}
+
+func add(a, b point.P) point.P {
+	return point.New3(a.X+b.X, a.Y+b.Y, a.Z+b.Z)
+}
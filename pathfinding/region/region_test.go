@@ -0,0 +1,173 @@
+package region_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+)
+
+func TestIndex_Reachable(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+A = border-east
+B = border-west
+#########
+#..#....#
+#..#.AB.#
+#..#....#
+#########
+`)
+	// borders on both sides of an edge only block that edge, not the whole column
+	i := region.New(tr)
+
+	tests := []struct {
+		name string
+		a, b point.P
+		want bool
+	}{
+		{name: "same room", a: point.New(1, 1), b: point.New(2, 3), want: true},
+		{name: "separated by solid", a: point.New(1, 1), b: point.New(4, 1), want: false},
+		{name: "around a border", a: point.New(5, 2), b: point.New(6, 2), want: true},
+		{name: "solid cell", a: point.New(0, 0), b: point.New(0, 0), want: false},
+		{name: "out of bounds", a: point.New(-1, 0), b: point.New(1, 1), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := i.Reachable(tt.a, tt.b); got != tt.want {
+				t.Errorf("Reachable(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+	if i.Regions() != 2 {
+		t.Errorf("Regions() = %d, want 2", i.Regions())
+	}
+	if got := len(i.Cells(i.Region(point.New(1, 1)))); got != 6 {
+		t.Errorf("Cells() has %d cells, want 6", got)
+	}
+}
+
+func TestIndex_Update(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+#######
+#..#..#
+#######
+`)
+	i := region.New(tr)
+	left, right := point.New(1, 1), point.New(5, 1)
+	if i.Reachable(left, right) {
+		t.Fatalf("rooms should start out separated")
+	}
+
+	// dig through the wall, joining both rooms
+	if err := tr.Fill(3, 1, 0); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	i.Update(point.New(3, 1))
+	if !i.Reachable(left, right) {
+		t.Errorf("Reachable() after opening the wall = false, want true")
+	}
+	if i.Regions() != 1 {
+		t.Errorf("Regions() = %d, want 1", i.Regions())
+	}
+
+	// put a border in the opening, splitting them again
+	if err := tr.Fill(3, 1, terrain.BorderEast); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	i.Update(point.New(3, 1))
+	if i.Reachable(left, right) {
+		t.Errorf("Reachable() after placing a border = true, want false")
+	}
+	if !i.Reachable(left, point.New(3, 1)) {
+		t.Errorf("the opening should be part of the left room")
+	}
+}
+
+func TestIndex_Levels(t *testing.T) {
+	s := terrain.NewStack(3, 1, 2)
+	if err := s.Fill(point.New3(1, 0, 0), terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	i := region.New(s)
+	a, b := point.New3(0, 0, 0), point.New3(2, 0, 0)
+	if i.Reachable(a, b) {
+		t.Fatalf("cells should start out separated")
+	}
+
+	// stairs on both sides connect them over the level above
+	for _, p := range []point.P{a, b} {
+		if err := s.Fill(p, terrain.Stairs); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+	}
+	i.Update(a, b)
+	if !i.Reachable(a, b) {
+		t.Errorf("Reachable() over the level above = false, want true")
+	}
+}
+
+func TestIndex_Splits(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+#######
+#..#..#
+#.....#
+#..#..#
+#######
+`)
+	i := region.New(tr)
+	door := point.New(3, 2)
+	// a wall in the opening between the two rooms
+	wall := func(p point.P, d direction.Direction) bool {
+		dx, dy, _ := d.Delta()
+		return p.Equal(door) || point.New(p.X+dx, p.Y+dy).Equal(door)
+	}
+	if got := i.Splits(wall, point.New(2, 2), point.New(4, 2)); len(got) != 1 || got[0] != i.Region(door) {
+		t.Errorf("Splits() = %v, want [%d]", got, i.Region(door))
+	}
+
+	// a wall in a corner of a room keeps it together
+	corner := point.New(1, 1)
+	pillar := func(p point.P, d direction.Direction) bool {
+		dx, dy, _ := d.Delta()
+		return p.Equal(corner) || point.New(p.X+dx, p.Y+dy).Equal(corner)
+	}
+	if got := i.Splits(pillar, point.New(2, 1), point.New(1, 2)); len(got) != 0 {
+		t.Errorf("Splits() = %v, want none", got)
+	}
+}
+
+func TestIndex_Parts(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+########
+#..#...#
+#......#
+#..#...#
+########
+`)
+	i := region.New(tr)
+	door := point.New(3, 2)
+	wall := func(p point.P, d direction.Direction) bool {
+		dx, dy, _ := d.Delta()
+		return p.Equal(door) || point.New(p.X+dx, p.Y+dy).Equal(door)
+	}
+	parts := i.Parts(wall, point.New(2, 2), point.New(4, 2))
+	if len(parts) != 2 || len(parts[0]) != 6 || len(parts[1]) != 9 {
+		t.Fatalf("Parts() = %v, want the 6 cells of the left room and the 9 of the right one", parts)
+	}
+	if !slices.Contains(parts[0], point.New(1, 1)) || !slices.Contains(parts[1], point.New(6, 3)) {
+		t.Errorf("Parts() = %v, want the left room first", parts)
+	}
+
+	corner := point.New(1, 1)
+	pillar := func(p point.P, d direction.Direction) bool {
+		dx, dy, _ := d.Delta()
+		return p.Equal(corner) || point.New(p.X+dx, p.Y+dy).Equal(corner)
+	}
+	if parts := i.Parts(pillar, point.New(2, 1), point.New(1, 2)); parts != nil {
+		t.Errorf("Parts() = %v, want nil when nothing splits", parts)
+	}
+}
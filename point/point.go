@@ -1,26 +1,38 @@
 package point
 
-// P represents a point in 2D space.
+// P represents a point in 2D space on a level. Z is the level and is zero
+// for maps that only have a single level.
 type P struct {
-	X, Y int
+	X, Y, Z int
 }
 
-// New creates a new point with the given coordinates.
+// New creates a new point with the given coordinates on level zero.
 func New(x, y int) P {
 	return P{X: x, Y: y}
 }
 
+// New3 creates a new point with the given coordinates on level z.
+func New3(x, y, z int) P {
+	return P{X: x, Y: y, Z: z}
+}
+
 func (p P) Equal(other P) bool {
-	return p.X == other.X && p.Y == other.Y
+	return p.X == other.X && p.Y == other.Y && p.Z == other.Z
 }
 
-// Neighboring checks if two points are adjacent (horizontally, vertically and diagonally).
+// Neighboring checks if two points are adjacent (horizontally, vertically and diagonally)
+// on the same level, or directly above or below each other on adjacent levels.
 func (p P) Neighboring(other P) bool {
 	dx := p.X - other.X
 	dy := p.Y - other.Y
+	dz := p.Z - other.Z
+	if dz != 0 {
+		return dx == 0 && dy == 0 && (dz == 1 || dz == -1)
+	}
 	return (dx == 0 && (dy == 1 || dy == -1)) || (dy == 0 && (dx == 1 || dx == -1)) || (dx == 1 && (dy == 1 || dy == -1)) || (dx == -1 && (dy == 1 || dy == -1))
 }
 
+// Divide divides the X and Y coordinates by the scalar. The level is kept.
 func (p P) Divide(scalar int) P {
-	return P{X: p.X / scalar, Y: p.Y / scalar}
+	return P{X: p.X / scalar, Y: p.Y / scalar, Z: p.Z}
 }
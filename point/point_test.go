@@ -35,6 +35,12 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew3(t *testing.T) {
+	if got, want := New3(3, 4, 2), (P{X: 3, Y: 4, Z: 2}); !reflect.DeepEqual(got, want) {
+		t.Errorf("New3() = %v, want %v", got, want)
+	}
+}
+
 func TestP_Equal(t *testing.T) {
 	type args struct {
 		other P
@@ -57,6 +63,12 @@ func TestP_Equal(t *testing.T) {
 			args: args{other: P{X: 2, Y: 3}},
 			want: false,
 		},
+		{
+			name: "Same position on different levels",
+			p:    P{X: 1, Y: 2, Z: 0},
+			args: args{other: P{X: 1, Y: 2, Z: 1}},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -107,6 +119,30 @@ func TestP_Neighboring(t *testing.T) {
 			args: args{other: P{X: 1, Y: 2}},
 			want: false,
 		},
+		{
+			name: "Neighboring points (level above)",
+			p:    P{X: 1, Y: 2, Z: 0},
+			args: args{other: P{X: 1, Y: 2, Z: 1}},
+			want: true,
+		},
+		{
+			name: "Neighboring points (level below)",
+			p:    P{X: 1, Y: 2, Z: 1},
+			args: args{other: P{X: 1, Y: 2, Z: 0}},
+			want: true,
+		},
+		{
+			name: "Diagonal on another level",
+			p:    P{X: 1, Y: 2, Z: 0},
+			args: args{other: P{X: 2, Y: 3, Z: 1}},
+			want: false,
+		},
+		{
+			name: "Two levels apart",
+			p:    P{X: 1, Y: 2, Z: 0},
+			args: args{other: P{X: 1, Y: 2, Z: 2}},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -3,16 +3,23 @@ package behavior
 import (
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
 
 	"github.com/dwethmar/apostle/component"
 	"github.com/dwethmar/apostle/component/agent"
 	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/component/job"
 	"github.com/dwethmar/apostle/component/kind"
+	"github.com/dwethmar/apostle/direction"
 	"github.com/dwethmar/apostle/entity"
 	"github.com/dwethmar/apostle/entity/blueprint"
 	"github.com/dwethmar/apostle/event"
 	"github.com/dwethmar/apostle/input"
+	"github.com/dwethmar/apostle/pathfinding/flow"
+	"github.com/dwethmar/apostle/pathfinding/region"
 	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/fog"
 	"github.com/dwethmar/apostle/system/world"
 	"github.com/dwethmar/apostle/terrain"
 )
@@ -22,21 +29,44 @@ type PathFinder interface {
 	Find(start, end point.P) []point.P
 }
 
+// invalidator is implemented by path finders that remember paths or keep
+// state about the terrain, which need to know what cells of the terrain
+// changed.
+type invalidator interface {
+	Invalidate(changed ...point.P)
+}
+
 type Behavior struct {
 	logger           *slog.Logger
-	tr               *terrain.Terrain
+	tr               *terrain.Stack
 	componentFactory *factory.Factory
 	entityStore      *entity.Store
 	componentStore   *component.Store
 	pathfinder       PathFinder // Interface for pathfinding algorithms
+	regions          *region.Index
+	fog              *fog.Fog // agents only target what their faction has seen
 	eventBus         *event.Bus
+	apples           *flow.Field          // ways to the apples, shared by every agent that chases one
+	appleCells       map[point.P]struct{} // cells of the apples that are goals of the apple field
 
 	// events
 	subscriptions []int
 	click         *point.P
+	changedCells  map[point.P]struct{} // terrain cells that changed since the last update
+}
+
+type Option func(*Behavior)
+
+// WithAppleField lets agents that chase an apple read their way from a flow
+// field toward every apple instead of searching a path of their own. The
+// behavior keeps the goals of the field and its terrain up to date.
+func WithAppleField(f *flow.Field) Option {
+	return func(b *Behavior) {
+		b.apples = f
+	}
 }
 
-func New(logger *slog.Logger, tr *terrain.Terrain, componentFactory *factory.Factory, entityStore *entity.Store, componentStore *component.Store, pathfinder PathFinder, eventBus *event.Bus) *Behavior {
+func New(logger *slog.Logger, tr *terrain.Stack, componentFactory *factory.Factory, entityStore *entity.Store, componentStore *component.Store, pathfinder PathFinder, regions *region.Index, fogOfWar *fog.Fog, eventBus *event.Bus, opts ...Option) *Behavior {
 	b := &Behavior{
 		logger:           logger.With(slog.String("system", "behavior")),
 		tr:               tr,
@@ -44,7 +74,14 @@ func New(logger *slog.Logger, tr *terrain.Terrain, componentFactory *factory.Fac
 		entityStore:      entityStore,
 		componentStore:   componentStore,
 		pathfinder:       pathfinder,
+		regions:          regions,
+		fog:              fogOfWar,
 		eventBus:         eventBus,
+		changedCells:     make(map[point.P]struct{}),
+		appleCells:       make(map[point.P]struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
 	b.subscriptions = []int{
 		b.eventBus.Subscribe(event.MatcherFunc(func(e event.Event) bool {
@@ -52,28 +89,51 @@ func New(logger *slog.Logger, tr *terrain.Terrain, componentFactory *factory.Fac
 			return ok
 		}), func(e event.Event) error {
 			clickEvent := e.(*input.Click)
-			p := point.P{X: clickEvent.X, Y: clickEvent.Y}
+			p := point.P{X: clickEvent.X, Y: clickEvent.Y, Z: clickEvent.Z}
 			b.click = &p
 			return nil
 		}),
+		b.eventBus.Subscribe(event.MatchAny(terrain.CellChangedEventName, terrain.CellsChangedEventName, terrain.DoorChangedEventName), func(e event.Event) error {
+			switch e := e.(type) {
+			case *terrain.CellChangedEvent:
+				b.changedCells[point.New3(e.X, e.Y, e.Z)] = struct{}{}
+			case *terrain.CellsChangedEvent:
+				for _, c := range e.Changes {
+					b.changedCells[point.New3(c.X, c.Y, c.Z)] = struct{}{}
+				}
+			case *terrain.DoorChangedEvent:
+				// a door lies between two cells and changes the cost of the
+				// way through it as well as whether it can be passed
+				dx, dy, _ := e.Side.Delta()
+				b.changedCells[point.New3(e.X, e.Y, e.Z)] = struct{}{}
+				b.changedCells[point.New3(e.X+dx, e.Y+dy, e.Z)] = struct{}{}
+			}
+			return nil
+		}),
 	}
 	return b
 }
 
+// chased are the kinds of entities that agents go after when they have
+// nothing else to do. Dig sites and ghosts are worked on as jobs instead.
+var chased = map[kind.Value]bool{
+	kind.Human: true,
+	kind.Apple: true,
+}
+
 func (b *Behavior) Update() error {
+	b.applyTerrainChanges()
+
 	var newTargetEntity *entity.Entity
 	if b.click != nil {
 		defer func() { b.click = nil }()
 
 		cell := world.PXToCell(*b.click)
-		if !b.tr.InBounds(cell.X, cell.Y) || b.tr.Solid(cell.X, cell.Y) {
+		if !b.tr.InBounds(cell) || b.tr.Solid(cell) {
 			b.logger.Info("Clicked on solid terrain, no apple created", "cell", cell)
 			return nil
 		}
-		p := world.CellToCenterPX(point.P{
-			X: cell.X,
-			Y: cell.Y,
-		})
+		p := world.CellToCenterPX(cell)
 		e, err := blueprint.NewApple(p, b.entityStore, b.componentFactory)
 		if err != nil {
 			return fmt.Errorf("failed to create apple entity at %v: %w", p, err)
@@ -87,9 +147,11 @@ func (b *Behavior) Update() error {
 			}
 		}
 	}
+	b.updateApples()
 
 	for _, a := range b.componentStore.AgentEntries() {
-		if newTargetEntity != nil {
+		if newTargetEntity != nil && b.fog.Explored(a.Faction(), world.PXToCell(newTargetEntity.Pos())) {
+			b.leaveJob(a)
 			a.SetTargetEntity(newTargetEntity.ID())
 			a.SetGoal(agent.MoveAdjacentToTarget)
 			continue
@@ -104,11 +166,85 @@ func (b *Behavior) Update() error {
 			if err := b.moveToTarget(a); err != nil {
 				return fmt.Errorf("failed to move agent %d to target: %w", a.EntityID(), err)
 			}
+		case agent.WorkOnJob:
+			if err := b.workOnJob(a); err != nil {
+				return fmt.Errorf("failed to let agent %d work on job: %w", a.EntityID(), err)
+			}
 		}
 	}
 	return nil
 }
 
+// applyTerrainChanges updates the regions around terrain cells that changed
+// since the last update, drops the remembered paths and ways to the apples
+// that depend on them and clears every path that crosses one of them, so the
+// agent calculates a new one.
+func (b *Behavior) applyTerrainChanges() {
+	if len(b.changedCells) == 0 {
+		return
+	}
+	defer clear(b.changedCells)
+	changed := slices.Collect(maps.Keys(b.changedCells))
+	b.regions.Update(changed...)
+	if inv, ok := b.pathfinder.(invalidator); ok {
+		inv.Invalidate(changed...)
+	}
+	if b.apples != nil {
+		b.apples.Invalidate(changed...)
+	}
+	for _, p := range b.componentStore.PathEntries() {
+		for _, cell := range p.Cells() {
+			if _, ok := b.changedCells[cell]; ok {
+				b.logger.Debug("Terrain changed on path, recalculating", slog.Int("entityID", p.EntityID()), slog.Any("cell", cell))
+				p.Clear()
+				break
+			}
+		}
+	}
+}
+
+// updateApples makes the cells of the apples the goals of the apple field.
+func (b *Behavior) updateApples() {
+	if b.apples == nil {
+		return
+	}
+	cells := make(map[point.P]struct{})
+	for _, k := range b.componentStore.KindEntries() {
+		if k.Value() != kind.Apple {
+			continue
+		}
+		if e, ok := b.entityStore.Entity(k.EntityID()); ok {
+			cells[world.PXToCell(e.Pos())] = struct{}{}
+		}
+	}
+	var gone []point.P
+	for c := range b.appleCells {
+		if _, ok := cells[c]; !ok {
+			gone = append(gone, c)
+		}
+	}
+	b.apples.RemoveGoal(gone...)
+	added := make(map[point.P]float64)
+	for c := range cells {
+		if _, ok := b.appleCells[c]; !ok {
+			added[c] = 0
+		}
+	}
+	b.apples.SetGoals(added)
+	b.appleCells = cells
+}
+
+// findPath returns the path from start to end. The way to an apple is read
+// from the apple field if that apple is the nearest one.
+func (b *Behavior) findPath(start, end point.P) []point.P {
+	if _, ok := b.appleCells[end]; ok && b.apples != nil {
+		if path := b.apples.Path(start); len(path) > 0 && path[len(path)-1] == end {
+			return path
+		}
+	}
+	return b.pathfinder.Find(start, end)
+}
+
 // clearTargetIfEntityRemoved checks if the agent's target is removed and clears it if so.
 func (b *Behavior) clearTargetIfEntityRemoved(a *agent.Agent) {
 	if !a.HasTargetEntity() {
@@ -120,13 +256,30 @@ func (b *Behavior) clearTargetIfEntityRemoved(a *agent.Agent) {
 	}
 }
 
+// lookForTargets lets an agent without a target take a job, or otherwise
+// target an entity that its faction has seen and that it can reach.
 func (b *Behavior) lookForTargets(a *agent.Agent) error {
 	if !a.HasTargetEntity() {
+		self, ok := b.entityStore.Entity(a.EntityID())
+		if !ok {
+			return fmt.Errorf("entity with ID %d does not exist", a.EntityID())
+		}
+		selfCell := world.PXToCell(self.Pos())
+		if b.takeJob(a, selfCell) {
+			return nil // work comes before chasing entities
+		}
 		for _, k := range b.componentStore.KindEntries() {
-			if k.EntityID() == a.EntityID() { // don't target self
+			if k.EntityID() == a.EntityID() || !chased[k.Value()] { // don't target self or what is not chased
 				continue
 			}
 			if e, ok := b.entityStore.Entity(k.EntityID()); ok {
+				cell := world.PXToCell(e.Pos())
+				if !b.fog.Explored(a.Faction(), cell) {
+					continue // its faction does not know it is there
+				}
+				if !b.regions.Reachable(selfCell, cell) {
+					continue // no path exists, don't bother searching for one
+				}
 				a.SetTargetEntity(e.ID())
 				a.SetGoal(agent.MoveAdjacentToTarget)
 				break
@@ -166,7 +319,7 @@ func (b *Behavior) moveToTarget(a *agent.Agent) error {
 		// Also clear the movement destination to stop the entity from continuing on the old path
 		m := e.Components().Movement()
 		// Immediately recalculate the path from current position
-		steps := b.pathfinder.Find(m.DestinationCell(), targetEntityCell)
+		steps := b.findPath(m.DestinationCell(), targetEntityCell)
 		if len(steps) == 0 {
 			b.logger.Warn("No path found to target after recalculation", slog.Int("targetID", targetEntity.ID()), slog.Int("entityID", a.EntityID()))
 			a.Reset()
@@ -179,3 +332,108 @@ func (b *Behavior) moveToTarget(a *agent.Agent) error {
 	}
 	return nil
 }
+
+// takeJob lets the agent take a job nobody works on yet, that its faction
+// knows about and that it can reach. It reports whether a job was taken.
+func (b *Behavior) takeJob(a *agent.Agent, self point.P) bool {
+	for _, j := range b.componentStore.JobEntries() {
+		if j.HasWorker() || !b.fog.Explored(a.Faction(), j.Cell()) {
+			continue
+		}
+		if _, ok := b.workCell(self, j.Cell()); !ok {
+			continue
+		}
+		b.logger.Info("Agent takes job", slog.Int("entityID", a.EntityID()), slog.String("job", j.Kind().String()), slog.Any("cell", j.Cell()))
+		j.SetWorker(a.EntityID())
+		a.SetTargetEntity(j.EntityID())
+		a.SetGoal(agent.WorkOnJob)
+		return true
+	}
+	return false
+}
+
+// leaveJob gives up the job the agent works on, so another agent can take it.
+func (b *Behavior) leaveJob(a *agent.Agent) {
+	if a.Goal() != agent.WorkOnJob {
+		return
+	}
+	if e, ok := b.entityStore.Entity(a.TargetEntityID()); ok {
+		if j := e.Components().Job(); j != nil && j.WorkerID() == a.EntityID() {
+			j.SetWorker(job.NoWorker)
+		}
+	}
+	a.Reset()
+}
+
+// workCell returns the cell next to the job cell, on the same level, that is
+// closest to self and can be reached from it.
+func (b *Behavior) workCell(self, cell point.P) (point.P, bool) {
+	var (
+		best  point.P
+		found bool
+	)
+	for _, d := range []direction.Direction{direction.North, direction.South, direction.East, direction.West} {
+		dx, dy, _ := d.Delta()
+		n := point.New3(cell.X+dx, cell.Y+dy, cell.Z)
+		if !b.tr.Standable(n) || !b.regions.Reachable(self, n) {
+			continue
+		}
+		if !found || distance(self, n) < distance(self, best) {
+			best, found = n, true
+		}
+	}
+	return best, found
+}
+
+func distance(a, b point.P) int {
+	dx, dy, dz := a.X-b.X, a.Y-b.Y, a.Z-b.Z
+	return dx*dx + dy*dy + dz*dz
+}
+
+// workOnJob moves the agent next to the cell of its job and works on it once
+// it is there.
+func (b *Behavior) workOnJob(a *agent.Agent) error {
+	e, ok := b.entityStore.Entity(a.EntityID())
+	if !ok {
+		return fmt.Errorf("entity with ID %d does not exist", a.EntityID())
+	}
+	target, ok := b.entityStore.Entity(a.TargetEntityID())
+	if !ok || target.Components().Job() == nil {
+		a.Reset()
+		return nil
+	}
+	j := target.Components().Job()
+
+	m := e.Components().Movement()
+	at, ok := b.workCell(m.DestinationCell(), j.Cell())
+	if !ok {
+		b.logger.Warn("Agent can not reach its job", slog.Int("entityID", a.EntityID()), slog.Any("cell", j.Cell()))
+		b.leaveJob(a)
+		return nil
+	}
+
+	if m.AtDestination() && m.DestinationCell().Equal(at) {
+		j.Work()
+		return nil
+	}
+
+	p := e.Components().Path()
+	if p == nil {
+		p = b.componentFactory.NewPathComponent(a.EntityID())
+		if err := e.Components().SetPath(p); err != nil {
+			return fmt.Errorf("failed to add path component to entity %d: %w", a.EntityID(), err)
+		}
+	}
+	if dest, hasDest := p.Destination(); hasDest && dest.Equal(at) {
+		return nil // on its way
+	}
+	p.Clear()
+	steps := b.pathfinder.Find(m.DestinationCell(), at)
+	if len(steps) == 0 {
+		b.logger.Warn("No path found to job", slog.Int("entityID", a.EntityID()), slog.Any("cell", j.Cell()))
+		b.leaveJob(a)
+		return nil
+	}
+	p.AddCells(steps...)
+	return nil
+}
@@ -0,0 +1,255 @@
+package behavior_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/agent"
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/entity/blueprint"
+	"github.com/dwethmar/apostle/event"
+	"github.com/dwethmar/apostle/input"
+	"github.com/dwethmar/apostle/pathfinding/astar"
+	"github.com/dwethmar/apostle/pathfinding/cache"
+	"github.com/dwethmar/apostle/pathfinding/flow"
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/behavior"
+	"github.com/dwethmar/apostle/system/construction"
+	"github.com/dwethmar/apostle/system/fog"
+	"github.com/dwethmar/apostle/system/locomotion"
+	"github.com/dwethmar/apostle/system/mining"
+	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// game holds the stores and systems a behavior test runs.
+type game struct {
+	tr         *terrain.Stack
+	bus        *event.Bus
+	entities   *entity.Store
+	components *component.Store
+	factory    *factory.Factory
+	regions    *region.Index
+	paths      *cache.Cache
+	apples     *flow.Field
+	fog        *fog.Fog
+	behavior   *behavior.Behavior
+	systems    []interface{ Update() error } // in the order of main
+}
+
+// newGame returns a game on an open terrain of the given size, whose
+// changes are published like in main.
+func newGame(t *testing.T, w, h, sightRadius int) *game {
+	logger := slog.New(slog.DiscardHandler)
+	bus := event.NewBus(0)
+	publish := func(e event.Event) {
+		if err := bus.Publish(e); err != nil {
+			t.Errorf("Publish() error = %v", err)
+		}
+	}
+	tr := terrain.NewStack(w, h, 1,
+		terrain.WithEmitCellChangedEvent(func(e *terrain.CellChangedEvent) { publish(e) }),
+		terrain.WithEmitCellsChangedEvent(func(e *terrain.CellsChangedEvent) { publish(e) }),
+		terrain.WithEmitDoorChangedEvent(func(e *terrain.DoorChangedEvent) { publish(e) }),
+	)
+	g := &game{
+		tr:         tr,
+		bus:        bus,
+		components: component.NewStore(),
+		regions:    region.New(tr),
+		paths:      cache.New(astar.New(tr)),
+		apples:     flow.New(tr),
+	}
+	g.entities = entity.NewStore(g.components)
+	g.factory = factory.NewFactory(g.bus)
+	g.fog = fog.New(logger, tr, g.entities, g.components, fog.WithSightRadius(sightRadius))
+	g.behavior = behavior.New(logger, tr, g.factory, g.entities, g.components, g.paths, g.regions, g.fog, g.bus, behavior.WithAppleField(g.apples))
+	g.systems = []interface{ Update() error }{
+		locomotion.New(logger, tr, g.entities, g.components),
+		g.fog,
+		mining.New(logger, tr, g.entities, g.components, g.factory, g.bus, mining.WithDigWork(5)),
+		construction.New(logger, tr, g.entities, g.components, g.factory, g.regions, g.bus, construction.WithBuildWork(5)),
+		g.behavior,
+	}
+	return g
+}
+
+// run updates every system until done reports true, and fails the test if
+// that takes more than the given number of ticks.
+func (g *game) run(t *testing.T, ticks int, done func() bool) {
+	t.Helper()
+	for range ticks {
+		for _, s := range g.systems {
+			if err := s.Update(); err != nil {
+				t.Fatalf("%T Update() error = %v", s, err)
+			}
+		}
+		if done() {
+			return
+		}
+	}
+	t.Fatalf("not done after %d ticks", ticks)
+}
+
+// publish publishes an input event for the center of the cell.
+func (g *game) publish(t *testing.T, e event.Event) {
+	t.Helper()
+	if err := g.bus.Publish(e); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+}
+
+// agent returns the agent of the human at the cell.
+func (g *game) agent(t *testing.T, cell point.P) *agent.Agent {
+	t.Helper()
+	e, err := blueprint.NewHuman(world.CellToCenterPX(cell), g.entities, g.factory)
+	if err != nil {
+		t.Fatalf("NewHuman() error = %v", err)
+	}
+	return e.Components().Agent()
+}
+
+func TestBehavior_LookForTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		sightRadius int
+		spawn       func(p point.P, s *entity.Store, f *factory.Factory) (*entity.Entity, error)
+		want        bool
+	}{
+		{"unexplored", 3, blueprint.NewApple, false},
+		{"explored", 20, blueprint.NewApple, true},
+		{"not chased", 20, blueprint.NewStone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGame(t, 20, 3, tt.sightRadius)
+			a := g.agent(t, point.New(1, 1))
+			target, err := tt.spawn(world.CellToCenterPX(point.New(15, 1)), g.entities, g.factory)
+			if err != nil {
+				t.Fatalf("spawn error = %v", err)
+			}
+			if err := g.fog.Update(); err != nil {
+				t.Fatalf("fog Update() error = %v", err)
+			}
+			if err := g.behavior.Update(); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			if got := a.HasTargetEntity() && a.TargetEntityID() == target.ID(); got != tt.want {
+				t.Errorf("targets the entity = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBehavior_Dig(t *testing.T) {
+	g := newGame(t, 10, 3, 20)
+	tr := g.tr
+	cell := point.New(6, 1)
+	if err := tr.Fill(cell, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	a := g.agent(t, point.New(1, 1))
+
+	px := world.CellToCenterPX(cell)
+	g.publish(t, &input.Dig{X: px.X, Y: px.Y, Z: px.Z})
+	g.run(t, 1000, func() bool { return !tr.Solid(cell) })
+	if len(g.components.JobEntries()) != 0 {
+		t.Errorf("jobs = %d after the cell was dug out, want 0", len(g.components.JobEntries()))
+	}
+	if a.Goal() == agent.WorkOnJob {
+		t.Errorf("agent still works on a job after the cell was dug out")
+	}
+}
+
+func TestBehavior_Build(t *testing.T) {
+	tests := []struct {
+		name  string
+		side  direction.Direction
+		built func(tr *terrain.Stack, cell point.P) bool
+	}{
+		{"wall", direction.None, func(tr *terrain.Stack, cell point.P) bool { return tr.Solid(cell) }},
+		{"border", direction.East, func(tr *terrain.Stack, cell point.P) bool {
+			return !tr.Traversable(cell, direction.East) && !tr.Traversable(point.New(cell.X+1, cell.Y), direction.West)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGame(t, 10, 3, 20)
+			g.agent(t, point.New(1, 1))
+			var built []*construction.BuiltEvent
+			g.bus.Subscribe(event.MatchAny(construction.BuiltEventName), func(e event.Event) error {
+				built = append(built, e.(*construction.BuiltEvent))
+				return nil
+			})
+
+			cell := point.New(6, 0)
+			px := world.CellToCenterPX(cell)
+			g.publish(t, &input.Build{X: px.X, Y: px.Y, Z: px.Z, Side: tt.side})
+			g.run(t, 1000, func() bool { return len(built) > 0 })
+			if !tt.built(g.tr, cell) {
+				t.Errorf("%s is not in the terrain after it was built", tt.name)
+			}
+			if got := built[0]; !got.Cell.Equal(cell) || got.Side != tt.side {
+				t.Errorf("BuiltEvent = %+v, want cell %v side %d", got, cell, tt.side)
+			}
+		})
+	}
+}
+
+func TestBehavior_DoorChanged(t *testing.T) {
+	g := newGame(t, 4, 1, 3)
+	for i, state := range []terrain.DoorState{terrain.DoorClosed, terrain.DoorOpen, terrain.DoorLocked} {
+		if err := g.tr.SetDoor(point.New(1, 0), direction.East, state); err != nil {
+			t.Fatalf("SetDoor() error = %v", err)
+		}
+		if err := g.behavior.Update(); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		// every door change reaches the path finder, also between states
+		// that can both be passed
+		if got, want := g.paths.Version(), uint64(i+1); got != want {
+			t.Errorf("path cache version after the door is %v = %d, want %d", state, got, want)
+		}
+	}
+}
+
+func TestBehavior_AppleField(t *testing.T) {
+	g := newGame(t, 20, 3, 20)
+	a := g.agent(t, point.New(1, 1))
+	self, _ := g.entities.Entity(a.EntityID())
+	cell := point.New(15, 1)
+	apple, err := blueprint.NewApple(world.CellToCenterPX(cell), g.entities, g.factory)
+	if err != nil {
+		t.Fatalf("NewApple() error = %v", err)
+	}
+
+	// a wall is put in the way once the agent is on its way
+	g.run(t, 100, func() bool { return a.Goal() == agent.MoveAdjacentToTarget })
+	for _, y := range []int{0, 1} {
+		if err := g.tr.Fill(point.New(8, y), terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+	}
+	g.run(t, 2000, func() bool {
+		at := world.PXToCell(self.Pos())
+		if g.tr.Solid(at) {
+			t.Fatalf("agent walks through the wall at %v", at)
+		}
+		return at.Neighboring(cell)
+	})
+	if s := g.paths.Stats(); s.Misses != 0 {
+		t.Errorf("path cache misses = %d, want the way to the apple read from the field", s.Misses)
+	}
+
+	g.entities.RemoveEntity(apple.ID())
+	if err := g.behavior.Update(); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if s := g.apples.Stats(); s.Goals != 0 {
+		t.Errorf("apple field goals = %d after the apple was removed, want 0", s.Goals)
+	}
+}
@@ -0,0 +1,295 @@
+// Package construction turns walls placed by the player into ghosts that
+// agents build, and puts the walls in the terrain once they are built.
+package construction
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/agent"
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/component/job"
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/entity/blueprint"
+	"github.com/dwethmar/apostle/event"
+	"github.com/dwethmar/apostle/input"
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+const defaultBuildWork = 180 // ticks of work it takes to build a wall
+
+const (
+	BuiltEventName   = "Built"
+	RefusedEventName = "BuildRefused"
+)
+
+// BuiltEvent is published when a wall is built.
+type BuiltEvent struct {
+	Cell point.P
+	Side direction.Direction // edge of the cell with the new border, None for a Solid cell
+}
+
+func (e *BuiltEvent) Event() string { return BuiltEventName }
+
+// RefusedEvent is published when a wall can not be placed or finished.
+type RefusedEvent struct {
+	Cell   point.P
+	Side   direction.Direction
+	Reason error
+}
+
+func (e *RefusedEvent) Event() string { return RefusedEventName }
+
+var (
+	ErrOccupied = errors.New("an entity stands in the cell")
+	ErrSeals    = errors.New("the wall would cut an agent off from where it needs to be")
+	ErrInvalid  = errors.New("nothing to build there")
+)
+
+type Construction struct {
+	logger           *slog.Logger
+	tr               *terrain.Stack
+	entityStore      *entity.Store
+	componentStore   *component.Store
+	componentFactory *factory.Factory
+	regions          *region.Index
+	eventBus         *event.Bus
+	buildWork        int
+
+	// events
+	subscriptions []int
+	placed        []*input.Build       // walls placed since the last update
+	changedCells  map[point.P]struct{} // terrain cells that changed since the regions were last updated
+}
+
+type Option func(*Construction)
+
+// WithBuildWork sets the ticks of work it takes to build a wall.
+func WithBuildWork(ticks int) Option {
+	return func(c *Construction) {
+		c.buildWork = ticks
+	}
+}
+
+func New(logger *slog.Logger, tr *terrain.Stack, entityStore *entity.Store, componentStore *component.Store, componentFactory *factory.Factory, regions *region.Index, eventBus *event.Bus, opts ...Option) *Construction {
+	c := &Construction{
+		logger:           logger.With(slog.String("system", "construction")),
+		tr:               tr,
+		entityStore:      entityStore,
+		componentStore:   componentStore,
+		componentFactory: componentFactory,
+		regions:          regions,
+		eventBus:         eventBus,
+		buildWork:        defaultBuildWork,
+		changedCells:     make(map[point.P]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.subscriptions = []int{
+		c.eventBus.Subscribe(event.MatchAny(input.BuildEvent), func(e event.Event) error {
+			c.placed = append(c.placed, e.(*input.Build))
+			return nil
+		}),
+		c.eventBus.Subscribe(event.MatchAny(terrain.CellChangedEventName, terrain.CellsChangedEventName, terrain.DoorChangedEventName), func(e event.Event) error {
+			switch e := e.(type) {
+			case *terrain.CellChangedEvent:
+				c.changedCells[point.New3(e.X, e.Y, e.Z)] = struct{}{}
+			case *terrain.CellsChangedEvent:
+				for _, ch := range e.Changes {
+					c.changedCells[point.New3(ch.X, ch.Y, ch.Z)] = struct{}{}
+				}
+			case *terrain.DoorChangedEvent:
+				dx, dy, _ := e.Side.Delta()
+				c.changedCells[point.New3(e.X, e.Y, e.Z)] = struct{}{}
+				c.changedCells[point.New3(e.X+dx, e.Y+dy, e.Z)] = struct{}{}
+			}
+			return nil
+		}),
+	}
+	return c
+}
+
+func (c *Construction) Update() error {
+	for _, b := range c.placed {
+		cell := world.PXToCell(point.New3(b.X, b.Y, b.Z))
+		if c.placedAt(cell, b.Side) {
+			continue
+		}
+		if err := c.check(cell, b.Side, job.NoWorker); err != nil {
+			c.refuse(cell, b.Side, err)
+			continue
+		}
+		if _, err := blueprint.NewGhost(world.CellToCenterPX(cell), cell, b.Side, c.buildWork, c.entityStore, c.componentFactory); err != nil {
+			return fmt.Errorf("failed to place wall at %v: %w", cell, err)
+		}
+	}
+	c.placed = c.placed[:0]
+
+	for _, j := range c.componentStore.JobEntries() {
+		if j.Kind() != job.Build || !j.Done() {
+			continue
+		}
+		cell, side := j.Cell(), j.Side()
+		c.entityStore.RemoveEntity(j.EntityID())
+		// things may have changed since the wall was placed
+		if err := c.check(cell, side, j.EntityID()); err != nil {
+			c.refuse(cell, side, err)
+			continue
+		}
+		if err := c.build(cell, side); err != nil {
+			return fmt.Errorf("failed to build wall at %v: %w", cell, err)
+		}
+		c.logger.Info("Built wall", slog.Any("cell", cell), slog.Int("side", int(side)))
+		if err := c.eventBus.Publish(&BuiltEvent{Cell: cell, Side: side}); err != nil {
+			return fmt.Errorf("failed to publish built event: %w", err)
+		}
+	}
+	return nil
+}
+
+// placedAt reports whether a wall is already waiting to be built there.
+func (c *Construction) placedAt(cell point.P, side direction.Direction) bool {
+	for _, j := range c.componentStore.JobEntries() {
+		if j.Kind() == job.Build && j.Cell().Equal(cell) && j.Side() == side {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Construction) refuse(cell point.P, side direction.Direction, reason error) {
+	c.logger.Info("Refused to build wall", slog.Any("cell", cell), slog.Int("side", int(side)), slog.Any("reason", reason))
+	if err := c.eventBus.Publish(&RefusedEvent{Cell: cell, Side: side, Reason: reason}); err != nil {
+		c.logger.Error("failed to publish refused event", slog.Any("error", err))
+	}
+}
+
+// check returns why the wall can not be built, or nil if it can. ghostID is
+// the entity of the ghost of the wall, which is ignored.
+func (c *Construction) check(cell point.P, side direction.Direction, ghostID int) error {
+	if !c.tr.InBounds(cell) {
+		return ErrInvalid
+	}
+	if side == direction.None {
+		if c.tr.Solid(cell) {
+			return ErrInvalid
+		}
+		for _, e := range c.entityStore.Entities() {
+			if e.ID() == ghostID || e.Components().Job() != nil {
+				continue
+			}
+			if world.PXToCell(e.Pos()).Equal(cell) {
+				return ErrOccupied
+			}
+			if m := e.Components().Movement(); m != nil && m.HasDestination() && m.DestinationCell().Equal(cell) {
+				return ErrOccupied
+			}
+		}
+	} else {
+		dx, dy, _ := side.Delta()
+		if !c.tr.InBounds(point.New3(cell.X+dx, cell.Y+dy, cell.Z)) {
+			return ErrInvalid
+		}
+	}
+
+	// the terrain may have changed this tick, before the behavior updated
+	// the regions
+	if len(c.changedCells) > 0 {
+		c.regions.Update(slices.Collect(maps.Keys(c.changedCells))...)
+		clear(c.changedCells)
+	}
+	blocked, around := walled(cell, side)
+	parts := c.regions.Parts(blocked, around...)
+	if len(parts) == 0 {
+		return nil
+	}
+	part := make(map[point.P]int) // the part of every cell of a region the wall splits
+	largest := 0
+	for k, cells := range parts {
+		for _, p := range cells {
+			part[p] = k
+		}
+		if len(cells) > len(parts[largest]) {
+			largest = k
+		}
+	}
+	for _, a := range c.componentStore.AgentEntries() {
+		e, ok := c.entityStore.Entity(a.EntityID())
+		if !ok {
+			continue
+		}
+		k, ok := part[world.PXToCell(e.Pos())]
+		if !ok {
+			continue // the wall does not split its region
+		}
+		if !slices.Contains(c.needed(a, ghostID, part, largest), k) {
+			return ErrSeals
+		}
+	}
+	return nil
+}
+
+// needed returns the parts of a split that the agent needs to be in: those
+// next to its target, or the largest part, where the rest of the map is, if
+// it has no target in a part.
+func (c *Construction) needed(a *agent.Agent, ghostID int, part map[point.P]int, largest int) []int {
+	if !a.HasTargetEntity() || a.TargetEntityID() == ghostID {
+		return []int{largest}
+	}
+	target, ok := c.entityStore.Entity(a.TargetEntityID())
+	if !ok {
+		return []int{largest}
+	}
+	// agents work on or pick up their target from a cell next to it
+	cell := world.PXToCell(target.Pos())
+	var needed []int
+	for _, d := range []direction.Direction{direction.None, direction.North, direction.South, direction.East, direction.West} {
+		dx, dy, _ := d.Delta()
+		if k, ok := part[point.New3(cell.X+dx, cell.Y+dy, cell.Z)]; ok {
+			needed = append(needed, k)
+		}
+	}
+	if len(needed) == 0 {
+		return []int{largest}
+	}
+	return needed
+}
+
+// walled returns the moves that the wall blocks and the cells around it.
+func walled(cell point.P, side direction.Direction) (func(p point.P, d direction.Direction) bool, []point.P) {
+	if side != direction.None {
+		dx, dy, _ := side.Delta()
+		other := point.New3(cell.X+dx, cell.Y+dy, cell.Z)
+		return func(p point.P, d direction.Direction) bool {
+			return p.Equal(cell) && d == side || p.Equal(other) && d == side.Opposite()
+		}, []point.P{cell, other}
+	}
+
+	var around []point.P
+	for _, d := range []direction.Direction{direction.North, direction.South, direction.East, direction.West, direction.Up, direction.Down} {
+		dx, dy, dz := d.Delta()
+		around = append(around, point.New3(cell.X+dx, cell.Y+dy, cell.Z+dz))
+	}
+	return func(p point.P, d direction.Direction) bool {
+		dx, dy, dz := d.Delta()
+		return p.Equal(cell) || point.New3(p.X+dx, p.Y+dy, p.Z+dz).Equal(cell)
+	}, around
+}
+
+func (c *Construction) build(cell point.P, side direction.Direction) error {
+	level := c.tr.Level(cell.Z)
+	if side == direction.None {
+		return generate.Wall(level, cell.X, cell.Y)
+	}
+	return generate.Border(level, cell.X, cell.Y, side)
+}
@@ -0,0 +1,151 @@
+package construction_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/entity/blueprint"
+	"github.com/dwethmar/apostle/event"
+	"github.com/dwethmar/apostle/input"
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/construction"
+	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+// site holds the stores and the construction system a test builds on.
+type site struct {
+	tr           *terrain.Stack
+	bus          *event.Bus
+	entities     *entity.Store
+	factory      *factory.Factory
+	construction *construction.Construction
+	refused      []*construction.RefusedEvent
+}
+
+// newSite returns a site on a terrain drawn by the rows, with '#' for Solid
+// cells, whose changes are published like in main.
+func newSite(t *testing.T, rows ...string) *site {
+	bus := event.NewBus(0)
+	publish := func(e event.Event) {
+		if err := bus.Publish(e); err != nil {
+			t.Errorf("Publish() error = %v", err)
+		}
+	}
+	tr := terrain.NewStack(len(rows[0]), len(rows), 1,
+		terrain.WithEmitCellChangedEvent(func(e *terrain.CellChangedEvent) { publish(e) }),
+		terrain.WithEmitCellsChangedEvent(func(e *terrain.CellsChangedEvent) { publish(e) }),
+		terrain.WithEmitDoorChangedEvent(func(e *terrain.DoorChangedEvent) { publish(e) }),
+	)
+	for y, row := range rows {
+		for x, r := range row {
+			if r != '#' {
+				continue
+			}
+			if err := tr.Fill(point.New(x, y), terrain.Solid); err != nil {
+				t.Fatalf("Fill() error = %v", err)
+			}
+		}
+	}
+	components := component.NewStore()
+	s := &site{tr: tr, bus: bus, entities: entity.NewStore(components), factory: factory.NewFactory(bus)}
+	s.construction = construction.New(slog.New(slog.DiscardHandler), tr, s.entities, components, s.factory, region.New(tr), bus)
+	bus.Subscribe(event.MatchAny(construction.RefusedEventName), func(e event.Event) error {
+		s.refused = append(s.refused, e.(*construction.RefusedEvent))
+		return nil
+	})
+	return s
+}
+
+// human puts a human in the cell and returns its entity.
+func (s *site) human(t *testing.T, cell point.P) *entity.Entity {
+	t.Helper()
+	e, err := blueprint.NewHuman(world.CellToCenterPX(cell), s.entities, s.factory)
+	if err != nil {
+		t.Fatalf("NewHuman() error = %v", err)
+	}
+	return e
+}
+
+// build places a wall in the cell and updates the construction system.
+func (s *site) build(t *testing.T, cell point.P) {
+	t.Helper()
+	px := world.CellToCenterPX(cell)
+	if err := s.bus.Publish(&input.Build{X: px.X, Y: px.Y, Z: px.Z, Side: direction.None}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := s.construction.Update(); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+}
+
+func TestConstruction_Seals(t *testing.T) {
+	// a wall in the opening splits off the small room on the left
+	rows := []string{
+		"#########",
+		"#..#....#",
+		"#.......#",
+		"#..#....#",
+		"#########",
+	}
+	opening := point.New(3, 2)
+	tests := []struct {
+		name   string
+		agent  point.P
+		target *point.P // cell of an apple the agent goes after
+		want   error
+	}{
+		{"empty pocket", point.New(6, 2), nil, nil},
+		{"agent sealed in", point.New(1, 2), nil, construction.ErrSeals},
+		{"target in the pocket", point.New(1, 2), &point.P{X: 1, Y: 1}, nil},
+		{"cut off from the target", point.New(6, 2), &point.P{X: 1, Y: 1}, construction.ErrSeals},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSite(t, rows...)
+			a := s.human(t, tt.agent).Components().Agent()
+			if tt.target != nil {
+				apple, err := blueprint.NewApple(world.CellToCenterPX(*tt.target), s.entities, s.factory)
+				if err != nil {
+					t.Fatalf("NewApple() error = %v", err)
+				}
+				a.SetTargetEntity(apple.ID())
+			}
+			s.build(t, opening)
+			var got error
+			if len(s.refused) > 0 {
+				got = s.refused[0].Reason
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("refused = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstruction_DigThenBuild(t *testing.T) {
+	// the agent is in a small room next to a large one
+	s := newSite(t,
+		"#########",
+		"#..#....#",
+		"#..#....#",
+		"#########",
+	)
+	s.human(t, point.New(1, 1))
+	// digging the way between the rooms and walling it up again in the
+	// same tick, before anything else updated the regions
+	if err := generate.Dig(s.tr.Level(0), 3, 1); err != nil {
+		t.Fatalf("Dig() error = %v", err)
+	}
+	s.build(t, point.New(3, 1))
+	if len(s.refused) != 1 || !errors.Is(s.refused[0].Reason, construction.ErrSeals) {
+		t.Errorf("refused = %v, want the wall to seal the agent in", s.refused)
+	}
+}
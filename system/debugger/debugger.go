@@ -12,6 +12,8 @@ import (
 	"github.com/dwethmar/apostle/component/movement"
 	"github.com/dwethmar/apostle/component/path"
 	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/pathfinding/cache"
+	"github.com/dwethmar/apostle/pathfinding/flow"
 	"github.com/dwethmar/apostle/propagation"
 	"github.com/ebitengine/debugui"
 	"github.com/hajimehoshi/ebiten/v2"
@@ -31,14 +33,56 @@ type Debugger struct {
 	componentStore *component.Store
 	windowBounds   image.Rectangle
 	pointerPressed bool // whether the pointer is currently pressed within the debugger UI we dont want to propagate events outside the debugger UI
+	seed           uint64
+	hasSeed        bool
+	pathCache      PathCache
+	appleField     FlowField
 }
 
-func New(logger *slog.Logger, entityStore *entity.Store, componentStore *component.Store) *Debugger {
-	return &Debugger{
+// PathCache is a cache of paths whose counters are shown.
+type PathCache interface {
+	Stats() cache.Stats
+}
+
+// FlowField is a flow field whose counters are shown.
+type FlowField interface {
+	Stats() flow.Stats
+}
+
+type Option func(*Debugger)
+
+// WithSeed shows the seed the map was generated from.
+func WithSeed(seed uint64) Option {
+	return func(d *Debugger) {
+		d.seed, d.hasSeed = seed, true
+	}
+}
+
+// WithPathCache shows the hits and misses of the path cache.
+func WithPathCache(c PathCache) Option {
+	return func(d *Debugger) {
+		d.pathCache = c
+	}
+}
+
+// WithAppleField shows the goals and updates of the flow field toward the
+// apples.
+func WithAppleField(f FlowField) Option {
+	return func(d *Debugger) {
+		d.appleField = f
+	}
+}
+
+func New(logger *slog.Logger, entityStore *entity.Store, componentStore *component.Store, opts ...Option) *Debugger {
+	d := &Debugger{
 		logger:         logger.With(slog.String("system", "debugger")),
 		entityStore:    entityStore,
 		componentStore: componentStore,
 	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 func (d *Debugger) Update() error {
@@ -70,6 +114,17 @@ func (d *Debugger) Update() error {
 	if _, err := d.debugui.Update(func(ctx *debugui.Context) error {
 		ctx.Window("Test", image.Rect(x, y, x+width, y+height), func(layout debugui.ContainerLayout) {
 			d.windowBounds = layout.Bounds
+			if d.hasSeed {
+				ctx.Text(fmt.Sprintf("map seed: %d", d.seed))
+			}
+			if d.pathCache != nil {
+				s := d.pathCache.Stats()
+				ctx.Text(fmt.Sprintf("path cache: %d hits, %d misses, %d invalidated, %d paths", s.Hits, s.Misses, s.Invalidated, s.Entries))
+			}
+			if d.appleField != nil {
+				s := d.appleField.Stats()
+				ctx.Text(fmt.Sprintf("apple field: %d goals, %d cells last updated, %d in total", s.Goals, s.LastUpdated, s.TotalUpdated))
+			}
 			ctx.TreeNode("entities", func() {
 				ctx.Loop(len(entities), func(i int) {
 					entity := entities[i]
@@ -77,7 +132,7 @@ func (d *Debugger) Update() error {
 						ctx.Button("destroy").On(func() {
 							d.entityStore.RemoveEntity(entity.ID())
 						})
-						ctx.Text(fmt.Sprintf("Pos: %d, %d", entity.Pos().X, entity.Pos().Y))
+						ctx.Text(fmt.Sprintf("Pos: %d, %d, level %d", entity.Pos().X, entity.Pos().Y, entity.Pos().Z))
 						// components
 						if agemt := entity.Components().Agent(); agemt != nil {
 							ctx.TreeNode(agemt.ComponentType(), func() {
@@ -134,17 +189,17 @@ func (d *Debugger) DebugPathComponent(ctx *debugui.Context, p *path.Path) {
 	ctx.Loop(len(cells), func(i int) {
 		cell := cells[i]
 		if p.CurrentCell().Equal(cell) {
-			ctx.Text(fmt.Sprintf("cell %d: %d, %d (current)", i, cell.X, cell.Y))
+			ctx.Text(fmt.Sprintf("cell %d: %d, %d, %d (current)", i, cell.X, cell.Y, cell.Z))
 		} else {
-			ctx.Text(fmt.Sprintf("cell %d: %d, %d", i, cell.X, cell.Y))
+			ctx.Text(fmt.Sprintf("cell %d: %d, %d, %d", i, cell.X, cell.Y, cell.Z))
 		}
 	})
 }
 
 func (d *Debugger) DebugMovementComponent(ctx *debugui.Context, m *movement.Movement) {
 	ctx.Text(fmt.Sprintf("has destination: %t", m.HasDestination()))
-	ctx.Text(fmt.Sprintf("origin cell: %d, %d", m.OriginCell().X, m.OriginCell().Y))
-	ctx.Text(fmt.Sprintf("destination cell: %d, %d", m.DestinationCell().X, m.DestinationCell().Y))
+	ctx.Text(fmt.Sprintf("origin cell: %d, %d, %d", m.OriginCell().X, m.OriginCell().Y, m.OriginCell().Z))
+	ctx.Text(fmt.Sprintf("destination cell: %d, %d, %d", m.DestinationCell().X, m.DestinationCell().Y, m.DestinationCell().Z))
 	ctx.Text(fmt.Sprintf("at destination: %t", m.AtDestination()))
 	ctx.Text(fmt.Sprintf("steps: %d/%d", m.CurrentStep(), m.Steps()))
 }
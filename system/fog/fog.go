@@ -0,0 +1,145 @@
+// Package fog keeps track of what every faction can see and has seen of the
+// terrain.
+package fog
+
+import (
+	"log/slog"
+
+	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/agent"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+const defaultSightRadius = 8 // in cells
+
+// bitmap holds a bit for every cell of a stack.
+type bitmap []uint64
+
+func newBitmap(n int) bitmap {
+	return make(bitmap, (n+63)/64)
+}
+
+func (b bitmap) set(i int)      { b[i/64] |= 1 << (i % 64) }
+func (b bitmap) get(i int) bool { return b[i/64]&(1<<(i%64)) != 0 }
+
+// Map is what a single faction knows of the terrain. Cells that are visible
+// are seen right now, cells that are explored have been seen at some point.
+type Map struct {
+	width, height, levels int
+	explored              bitmap
+	visible               bitmap
+}
+
+func newMap(width, height, levels int) *Map {
+	n := width * height * levels
+	return &Map{
+		width:    width,
+		height:   height,
+		levels:   levels,
+		explored: newBitmap(n),
+		visible:  newBitmap(n),
+	}
+}
+
+// index returns the bit of the cell at p, and false if p is out of bounds.
+func (m *Map) index(p point.P) (int, bool) {
+	if p.X < 0 || p.Y < 0 || p.Z < 0 || p.X >= m.width || p.Y >= m.height || p.Z >= m.levels {
+		return 0, false
+	}
+	return (p.Z*m.height+p.Y)*m.width + p.X, true
+}
+
+// Explored reports whether the cell at p has ever been seen.
+func (m *Map) Explored(p point.P) bool {
+	i, ok := m.index(p)
+	return ok && m.explored.get(i)
+}
+
+// Visible reports whether the cell at p is seen right now.
+func (m *Map) Visible(p point.P) bool {
+	i, ok := m.index(p)
+	return ok && m.visible.get(i)
+}
+
+func (m *Map) see(p point.P) {
+	if i, ok := m.index(p); ok {
+		m.visible.set(i)
+		m.explored.set(i)
+	}
+}
+
+// Fog computes the visible and explored cells of every faction each update
+// from what its agents can see.
+type Fog struct {
+	logger         *slog.Logger
+	tr             *terrain.Stack
+	entityStore    *entity.Store
+	componentStore *component.Store
+	sightRadius    int
+	maps           map[agent.Faction]*Map
+}
+
+type Option func(*Fog)
+
+// WithSightRadius sets how many cells far agents can see.
+func WithSightRadius(r int) Option {
+	return func(f *Fog) {
+		f.sightRadius = r
+	}
+}
+
+func New(logger *slog.Logger, tr *terrain.Stack, entityStore *entity.Store, componentStore *component.Store, opts ...Option) *Fog {
+	f := &Fog{
+		logger:         logger.With(slog.String("system", "fog")),
+		tr:             tr,
+		entityStore:    entityStore,
+		componentStore: componentStore,
+		sightRadius:    defaultSightRadius,
+		maps:           make(map[agent.Faction]*Map),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Map returns what the faction knows of the terrain. Factions without agents
+// have not seen anything.
+func (f *Fog) Map(faction agent.Faction) *Map {
+	m, ok := f.maps[faction]
+	if !ok {
+		m = newMap(f.tr.Width(), f.tr.Height(), f.tr.Levels())
+		f.maps[faction] = m
+	}
+	return m
+}
+
+// Explored reports whether the faction has ever seen the cell at p.
+func (f *Fog) Explored(faction agent.Faction, p point.P) bool {
+	return f.Map(faction).Explored(p)
+}
+
+func (f *Fog) Update() error {
+	for _, m := range f.maps {
+		clear(m.visible)
+	}
+	for _, a := range f.componentStore.AgentEntries() {
+		e, ok := f.entityStore.Entity(a.EntityID())
+		if !ok {
+			continue
+		}
+		cell := world.PXToCell(e.Pos())
+		level := f.tr.Level(cell.Z)
+		if level == nil {
+			continue
+		}
+		m := f.Map(a.Faction())
+		for p := range level.FieldOfView(cell, f.sightRadius) {
+			m.see(point.New3(p.X, p.Y, cell.Z))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package fog_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/agent"
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/entity/blueprint"
+	"github.com/dwethmar/apostle/event"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/fog"
+	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func TestFog_Update(t *testing.T) {
+	// a single row with a door east of 2, a wall east of 8 and a Solid 12
+	tr := terrain.NewStack(16, 1, 1)
+	door := point.New(2, 0)
+	if err := tr.Level(0).SetWall(8, 0, direction.East, true); err != nil {
+		t.Fatalf("SetWall() error = %v", err)
+	}
+	if err := tr.Fill(point.New(12, 0), terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+
+	components := component.NewStore()
+	entities := entity.NewStore(components)
+	e, err := blueprint.NewHuman(point.P{}, entities, factory.NewFactory(event.NewBus(0)))
+	if err != nil {
+		t.Fatalf("NewHuman() error = %v", err)
+	}
+	f := fog.New(slog.New(slog.DiscardHandler), tr, entities, components, fog.WithSightRadius(3))
+	m := f.Map(e.Components().Agent().Faction())
+
+	// the agent walks east and back, the map keeps what it saw on the way
+	tests := []struct {
+		name       string
+		at         int
+		door       terrain.DoorState
+		visible    []int
+		hidden     []int
+		explored   []int
+		unexplored []int
+	}{
+		{"behind a closed door", 1, terrain.DoorClosed, []int{0, 1, 2}, []int{3}, []int{0, 1, 2}, []int{3}},
+		{"past the door", 5, terrain.DoorClosed, []int{3, 4, 5, 6, 7, 8}, []int{2, 9}, []int{0, 1, 2, 3, 8}, []int{9}},
+		{"past the wall", 10, terrain.DoorClosed, []int{9, 10, 11, 12}, []int{8, 13}, []int{1, 5, 8, 12}, []int{13}},
+		{"through an open door", 1, terrain.DoorOpen, []int{0, 1, 2, 3, 4}, []int{5, 12}, []int{12}, []int{13, 14, 15}},
+	}
+	for _, tt := range tests {
+		if err := tr.SetDoor(door, direction.East, tt.door); err != nil {
+			t.Fatalf("SetDoor() error = %v", err)
+		}
+		e.SetPos(world.CellToCenterPX(point.New(tt.at, 0)))
+		if err := f.Update(); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		for _, c := range []struct {
+			name  string
+			check func(point.P) bool
+			cells []int
+			want  bool
+		}{
+			{"Visible", m.Visible, tt.visible, true},
+			{"Visible", m.Visible, tt.hidden, false},
+			{"Explored", m.Explored, tt.explored, true},
+			{"Explored", m.Explored, tt.unexplored, false},
+		} {
+			for _, x := range c.cells {
+				if got := c.check(point.New(x, 0)); got != c.want {
+					t.Errorf("%s: %s(%d) = %t, want %t", tt.name, c.name, x, got, c.want)
+				}
+			}
+		}
+	}
+
+	if f.Explored(agent.Faction(99), point.New(1, 0)) {
+		t.Errorf("a faction without agents has explored a cell")
+	}
+}
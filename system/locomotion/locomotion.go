@@ -6,32 +6,49 @@ import (
 	"math"
 
 	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/direction"
 	"github.com/dwethmar/apostle/entity"
 	"github.com/dwethmar/apostle/point"
 	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
 )
 
-const defaultStepSize = 20 // Default step size for movement
+const (
+	defaultStepSize = 20 // Default step size for movement
+	doorOpenSteps   = 20 // extra steps it takes to open a closed door
+)
 
 // calculateSteps calculates the number of steps needed to move from start to end
-// Uses Euclidean distance to ensure diagonal movement isn't faster than axis-aligned movement
+// Uses Euclidean distance to ensure diagonal movement isn't faster than axis-aligned movement.
+// Moving a level up or down counts as one unit.
 func calculateSteps(start, end point.P, stepsPerUnit int) int {
 	dx := float64(end.X - start.X)
 	dy := float64(end.Y - start.Y)
-	distance := math.Sqrt(dx*dx + dy*dy)
+	dz := float64(end.Z - start.Z)
+	distance := math.Sqrt(dx*dx + dy*dy + dz*dz)
 	return int(math.Ceil(distance * float64(stepsPerUnit)))
 }
 
+// Terrain is the part of a terrain that locomotion needs to know how fast an
+// entity can move onto a cell and to open the doors on its way.
+type Terrain interface {
+	MoveCost(p point.P) float64
+	Door(p point.P, side direction.Direction) terrain.DoorState
+	OpenDoor(p point.P, side direction.Direction) error
+}
+
 // Locomotion handles the movement of entities based on their paths and movement components.
 type Locomotion struct {
 	logger         *slog.Logger
+	terrain        Terrain
 	entityStore    *entity.Store
 	componentStore *component.Store
 }
 
-func New(logger *slog.Logger, entityStore *entity.Store, componenStore *component.Store) *Locomotion {
+func New(logger *slog.Logger, t Terrain, entityStore *entity.Store, componenStore *component.Store) *Locomotion {
 	return &Locomotion{
 		logger:         logger.With(slog.String("system", "locomotion")),
+		terrain:        t,
 		entityStore:    entityStore,
 		componentStore: componenStore,
 	}
@@ -56,7 +73,16 @@ func (l *Locomotion) Update() error {
 
 			// If the entity is at its destination and the path has more cells, move to the next cell
 			if m.AtDestination() && p.Next() {
-				steps := calculateSteps(m.OriginCell(), m.DestinationCell(), defaultStepSize)
+				steps := calculateSteps(m.DestinationCell(), p.CurrentCell(), defaultStepSize)
+				// moving onto expensive ground such as mud or water takes longer
+				steps = int(math.Ceil(float64(steps) * l.terrain.MoveCost(p.CurrentCell())))
+				opened, err := l.openDoor(m.DestinationCell(), p.CurrentCell())
+				if err != nil {
+					return fmt.Errorf("failed to open door for entity %d: %w", m.EntityID(), err)
+				}
+				if opened {
+					steps += doorOpenSteps
+				}
 				m.SetDestinationCell(p.CurrentCell(), steps) // Set new destination with calculated steps
 			}
 		}
@@ -70,8 +96,21 @@ func (l *Locomotion) Update() error {
 			e.SetPos(point.P{
 				X: int(newX*cellSize) + world.CellSize/2,
 				Y: int(newY*cellSize) + world.CellSize/2,
+				Z: m.DestinationCell().Z, // the level changes as soon as the entity starts climbing
 			})
 		}
 	}
 	return nil
 }
+
+// openDoor opens a closed door between from and to, and reports whether it did.
+func (l *Locomotion) openDoor(from, to point.P) (bool, error) {
+	side := direction.FromDelta(to.X-from.X, to.Y-from.Y, to.Z-from.Z)
+	if l.terrain.Door(from, side) != terrain.DoorClosed {
+		return false, nil
+	}
+	if err := l.terrain.OpenDoor(from, side); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,119 @@
+// Package mining turns dig designations painted by the player into jobs and
+// digs out the cells of the jobs that are done.
+package mining
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/dwethmar/apostle/component"
+	"github.com/dwethmar/apostle/component/factory"
+	"github.com/dwethmar/apostle/component/job"
+	"github.com/dwethmar/apostle/entity"
+	"github.com/dwethmar/apostle/entity/blueprint"
+	"github.com/dwethmar/apostle/event"
+	"github.com/dwethmar/apostle/input"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/system/world"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+const defaultDigWork = 120 // ticks of work it takes to dig out a cell
+
+type Mining struct {
+	logger           *slog.Logger
+	tr               *terrain.Stack
+	entityStore      *entity.Store
+	componentStore   *component.Store
+	componentFactory *factory.Factory
+	eventBus         *event.Bus
+	digWork          int
+	dropStone        bool
+
+	// events
+	subscriptions []int
+	designated    []point.P // cells painted since the last update
+}
+
+type Option func(*Mining)
+
+// WithDigWork sets the ticks of work it takes to dig out a cell.
+func WithDigWork(ticks int) Option {
+	return func(m *Mining) {
+		m.digWork = ticks
+	}
+}
+
+// WithStoneDrop leaves a stone entity behind in every cell that is dug out.
+func WithStoneDrop() Option {
+	return func(m *Mining) {
+		m.dropStone = true
+	}
+}
+
+func New(logger *slog.Logger, tr *terrain.Stack, entityStore *entity.Store, componentStore *component.Store, componentFactory *factory.Factory, eventBus *event.Bus, opts ...Option) *Mining {
+	m := &Mining{
+		logger:           logger.With(slog.String("system", "mining")),
+		tr:               tr,
+		entityStore:      entityStore,
+		componentStore:   componentStore,
+		componentFactory: componentFactory,
+		eventBus:         eventBus,
+		digWork:          defaultDigWork,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.subscriptions = []int{
+		m.eventBus.Subscribe(event.MatchAny(input.DigEvent), func(e event.Event) error {
+			d := e.(*input.Dig)
+			m.designated = append(m.designated, world.PXToCell(point.New3(d.X, d.Y, d.Z)))
+			return nil
+		}),
+	}
+	return m
+}
+
+func (m *Mining) Update() error {
+	sites := make(map[point.P]*job.Job)
+	for _, j := range m.componentStore.JobEntries() {
+		if j.Kind() == job.Dig {
+			sites[j.Cell()] = j
+		}
+	}
+
+	for _, cell := range m.designated {
+		if _, ok := sites[cell]; ok || !m.tr.Solid(cell) {
+			continue
+		}
+		e, err := blueprint.NewDigSite(world.CellToCenterPX(cell), cell, m.digWork, m.entityStore, m.componentFactory)
+		if err != nil {
+			return fmt.Errorf("failed to designate %v to be dug out: %w", cell, err)
+		}
+		sites[cell] = e.Components().Job()
+	}
+	m.designated = m.designated[:0]
+
+	for cell, j := range sites {
+		if !m.tr.Solid(cell) {
+			m.logger.Debug("Dig site is no longer solid", slog.Any("cell", cell))
+			m.entityStore.RemoveEntity(j.EntityID())
+			continue
+		}
+		if !j.Done() {
+			continue
+		}
+		if err := generate.Dig(m.tr.Level(cell.Z), cell.X, cell.Y); err != nil {
+			return fmt.Errorf("failed to dig out %v: %w", cell, err)
+		}
+		m.entityStore.RemoveEntity(j.EntityID())
+		if m.dropStone {
+			if _, err := blueprint.NewStone(world.CellToCenterPX(cell), m.entityStore, m.componentFactory); err != nil {
+				return fmt.Errorf("failed to drop stone at %v: %w", cell, err)
+			}
+		}
+		m.logger.Info("Dug out cell", slog.Any("cell", cell))
+	}
+	return nil
+}
@@ -1,7 +1,11 @@
 package world
 
 import (
+	"image/color"
+
+	"github.com/dwethmar/apostle/direction"
 	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 )
@@ -41,8 +45,12 @@ func drawEntityDiamond(screen *ebiten.Image, x, y float32) {
 	}, dopt)
 }
 
-func drawPath(screen *ebiten.Image, points []point.P) {
+// drawPath draws the parts of the path that are on the given level.
+func drawPath(screen *ebiten.Image, points []point.P, level int) {
 	for i := 0; i < len(points)-1; i++ {
+		if points[i].Z != level || points[i+1].Z != level {
+			continue
+		}
 		vector.StrokeLine(screen, centerCellX(points[i].X), centerCellY(points[i].Y),
 			centerCellX(points[i+1].X), centerCellY(points[i+1].Y), 2, colorPath, false)
 	}
@@ -51,3 +59,79 @@ func drawPath(screen *ebiten.Image, points []point.P) {
 func drawApple(screen *ebiten.Image, x, y float32) {
 	vector.FillCircle(screen, x, y, float32(CellSize)*0.4, colorApple, true)
 }
+
+// drawDigSite draws a cross over a cell that is designated to be dug out.
+func drawDigSite(screen *ebiten.Image, x, y float32) {
+	r := float32(CellSize) * 0.35
+	vector.StrokeLine(screen, x-r, y-r, x+r, y+r, 2, colorDig, true)
+	vector.StrokeLine(screen, x-r, y+r, x+r, y-r, 2, colorDig, true)
+}
+
+func drawStone(screen *ebiten.Image, x, y float32) {
+	vector.FillCircle(screen, x, y, float32(CellSize)*0.25, colorStone, true)
+}
+
+// drawGhost draws a wall that is yet to be built, filling the cell or on
+// the given edge of it.
+func drawGhost(screen *ebiten.Image, cell point.P, side direction.Direction) {
+	x0, y0 := float32(cell.X*CellSize), float32(cell.Y*CellSize)
+	x1, y1 := x0+CellSize, y0+CellSize
+	switch side {
+	case direction.North:
+		vector.StrokeLine(screen, x0, y0, x1, y0, 4, colorGhost, false)
+	case direction.South:
+		vector.StrokeLine(screen, x0, y1, x1, y1, 4, colorGhost, false)
+	case direction.West:
+		vector.StrokeLine(screen, x0, y0, x0, y1, 4, colorGhost, false)
+	case direction.East:
+		vector.StrokeLine(screen, x1, y0, x1, y1, 4, colorGhost, false)
+	default:
+		vector.FillRect(screen, x0, y0, CellSize, CellSize, colorGhost, false)
+	}
+}
+
+// drawStairs draws stairs as a few steps in the cell. Stairs going up are
+// drawn across the full cell, stairs going down only in the lower half.
+func drawStairs(screen *ebiten.Image, x, y int, up bool) {
+	top := float32(y * CellSize)
+	if !up {
+		top += CellSize / 2
+	}
+	for sy := top + 2; sy < float32((y+1)*CellSize); sy += 4 {
+		vector.StrokeLine(screen, float32(x*CellSize)+2, sy, float32((x+1)*CellSize)-2, sy, 1, colorStairs, false)
+	}
+}
+
+// drawDoor draws a door on the north edge of the cell at (x, y), or on the
+// west edge if west is true. Open doors are drawn as a gap in the frame.
+func drawDoor(screen *ebiten.Image, x, y int, state terrain.DoorState, west bool) {
+	var clr color.Color
+	switch state {
+	case terrain.DoorOpen:
+		clr = colorDoorOpen
+	case terrain.DoorClosed:
+		clr = colorDoorClosed
+	case terrain.DoorLocked:
+		clr = colorDoorLocked
+	default:
+		return
+	}
+	x0, y0 := float32(x*CellSize), float32(y*CellSize)
+	x1, y1 := x0+CellSize, y0
+	if west {
+		x1, y1 = x0, y0+CellSize
+	}
+	if state == terrain.DoorOpen {
+		// only the ends of the frame
+		const frame = CellSize / 4
+		if west {
+			vector.StrokeLine(screen, x0, y0, x0, y0+frame, 4, clr, false)
+			vector.StrokeLine(screen, x1, y1-frame, x1, y1, 4, clr, false)
+		} else {
+			vector.StrokeLine(screen, x0, y0, x0+frame, y0, 4, clr, false)
+			vector.StrokeLine(screen, x1-frame, y1, x1, y1, 4, clr, false)
+		}
+		return
+	}
+	vector.StrokeLine(screen, x0, y0, x1, y1, 4, clr, false)
+}
@@ -0,0 +1,40 @@
+// Package palette holds the colors the world is drawn with. It does not
+// depend on ebiten, so tools that render maps to images use the same
+// colors as the game.
+package palette
+
+import "image/color"
+
+var (
+	Solid  = color.RGBA{0, 128, 0, 255}
+	Border = color.RGBA{255, 0, 0, 255}
+	Entity = color.RGBA{255, 255, 0, 255} // Yellow for entities
+	Path   = color.RGBA{0, 0, 255, 255}   // Blue for paths
+	Apple  = color.RGBA{255, 0, 0, 255}   // Red for apples
+	Dig    = color.RGBA{255, 165, 0, 255} // Orange for dig designations
+	Stone  = color.RGBA{128, 128, 128, 255}
+	Ghost  = color.RGBA{100, 160, 255, 120} // translucent blue for walls yet to be built
+	Stairs = color.RGBA{255, 255, 255, 255}
+	Forest = color.RGBA{0, 90, 0, 110} // translucent green over the ground of forests
+
+	DoorOpen   = color.RGBA{160, 110, 60, 255}
+	DoorClosed = color.RGBA{110, 60, 20, 255}
+	DoorLocked = color.RGBA{60, 30, 10, 255}
+
+	Unexplored = color.RGBA{0, 0, 0, 255}
+	Remembered = color.RGBA{0, 0, 0, 160} // drawn over cells that are explored but not visible
+)
+
+// spawns are the colors of the entities by the name of their blueprint.
+var spawns = map[string]color.RGBA{
+	"human": Entity,
+	"apple": Apple,
+	"stone": Stone,
+}
+
+// Spawn returns the color of the entity created by the named blueprint,
+// and false if entities of the blueprint are not drawn.
+func Spawn(name string) (color.RGBA, bool) {
+	c, ok := spawns[name]
+	return c, ok
+}
@@ -1,27 +1,40 @@
 package world
 
 import (
-	"image/color"
+	"fmt"
+	"iter"
 	"log/slog"
 
 	"github.com/dwethmar/apostle/component"
 	"github.com/dwethmar/apostle/component/kind"
+	"github.com/dwethmar/apostle/direction"
 	"github.com/dwethmar/apostle/entity"
 	"github.com/dwethmar/apostle/event"
 	"github.com/dwethmar/apostle/input"
 	"github.com/dwethmar/apostle/point"
 	"github.com/dwethmar/apostle/propagation"
+	"github.com/dwethmar/apostle/system/world/palette"
 	"github.com/dwethmar/apostle/terrain"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
 )
 
 const CellSize = 16 // Size of each cell in pixels
 
+// Keys to hold while clicking to give orders instead of placing an apple.
+const (
+	digKey    = ebiten.KeyD // paint dig designations
+	wallKey   = ebiten.KeyW // place a wall filling a cell
+	borderKey = ebiten.KeyB // place a border on the edge of a cell closest to the pointer
+)
+
 func CellToCenterPX(pos point.P) point.P {
 	return point.P{
 		X: pos.X*CellSize + CellSize/2,
 		Y: pos.Y*CellSize + CellSize/2,
+		Z: pos.Z,
 	}
 }
 
@@ -29,55 +42,212 @@ func PXToCell(pos point.P) point.P {
 	return point.P{
 		X: pos.X / CellSize,
 		Y: pos.Y / CellSize,
+		Z: pos.Z,
 	}
 }
 
+// The colors are shared with tools that render maps, see package palette.
 var (
-	colorSolid  = color.RGBA{0, 128, 0, 255}
-	colorBorder = color.RGBA{255, 0, 0, 255}
-	colorEntity = color.RGBA{255, 255, 0, 255} // Yellow for entities
-	colorPath   = color.RGBA{0, 0, 255, 255}   // Blue for paths
-	colorApple  = color.RGBA{255, 0, 0, 255}   // Red for apples
+	colorSolid  = palette.Solid
+	colorBorder = palette.Border
+	colorEntity = palette.Entity
+	colorPath   = palette.Path
+	colorApple  = palette.Apple
+	colorDig    = palette.Dig
+	colorStone  = palette.Stone
+	colorGhost  = palette.Ghost
+	colorStairs = palette.Stairs
+	colorForest = palette.Forest
+
+	colorDoorOpen   = palette.DoorOpen
+	colorDoorClosed = palette.DoorClosed
+	colorDoorLocked = palette.DoorLocked
+
+	colorUnexplored = palette.Unexplored
+	colorRemembered = palette.Remembered
 )
 
+// Terrain is the part of a terrain that the world needs to draw it. It is
+// satisfied by terrain.Terrain, terrain.Chunked and terrain.Stack.
+type Terrain interface {
+	Walk() iter.Seq[terrain.Step]
+}
+
+// Fog tells which cells the player has seen.
+type Fog interface {
+	Explored(p point.P) bool
+	Visible(p point.P) bool
+}
+
+// leveled is implemented by terrains with more than one level.
+type leveled interface {
+	Levels() int
+}
+
 type World struct {
 	logger         *slog.Logger
-	terrain        *terrain.Terrain
+	terrain        Terrain
 	entityStore    *entity.Store
 	componentStore *component.Store
 	eventBus       *event.Bus
+	fog            Fog // nil shows the whole terrain
+	level          int // level that is currently viewed
 }
 
-func New(logger *slog.Logger, t *terrain.Terrain, entityStore *entity.Store, componentStore *component.Store, eventBus *event.Bus) *World {
-	return &World{
+type Option func(*World)
+
+// WithFog hides the cells the player has not explored and dims the ones
+// that are explored but not visible.
+func WithFog(f Fog) Option {
+	return func(w *World) {
+		w.fog = f
+	}
+}
+
+func New(logger *slog.Logger, t Terrain, entityStore *entity.Store, componentStore *component.Store, eventBus *event.Bus, opts ...Option) *World {
+	w := &World{
 		logger:         logger.With(slog.String("system", "world")),
 		terrain:        t,
 		entityStore:    entityStore,
 		componentStore: componentStore,
 		eventBus:       eventBus,
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
 }
 
+func (d *World) explored(p point.P) bool {
+	return d.fog == nil || d.fog.Explored(p)
+}
+
+func (d *World) visible(p point.P) bool {
+	return d.fog == nil || d.fog.Visible(p)
+}
+
+// Level returns the level that is currently viewed.
+func (d *World) Level() int {
+	return d.level
+}
+
+// Update switches the viewed level with page up and page down.
+func (d *World) Update() error {
+	levels := 1
+	if l, ok := d.terrain.(leveled); ok {
+		levels = l.Levels()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageUp) && d.level+1 < levels {
+		d.level++
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyPageDown) && d.level > 0 {
+		d.level--
+	}
+	return nil
+}
+
+// OnPointerPressed publishes a click, or an order while one of the order
+// keys is held.
 func (d *World) OnPointerPressed(x, y int) propagation.Event {
-	if err := d.eventBus.Publish(&input.Click{X: x, Y: y}); err != nil {
+	switch {
+	case ebiten.IsKeyPressed(digKey):
+		d.publishDig(x, y)
+		return propagation.Propagate
+	case ebiten.IsKeyPressed(wallKey):
+		d.publishBuild(x, y, direction.None)
+		return propagation.Propagate
+	case ebiten.IsKeyPressed(borderKey):
+		d.publishBuild(x, y, closestEdge(x, y))
+		return propagation.Propagate
+	}
+	if err := d.eventBus.Publish(&input.Click{X: x, Y: y, Z: d.level}); err != nil {
 		d.logger.Error("failed to publish click event", slog.Int("x", x), slog.Int("y", y), slog.Any("error", err))
 	}
 	return propagation.Propagate
 }
 
-func (d *World) OnPointerReleased(x, y int) propagation.Event { return propagation.Propagate }
+// OnPointerReleased is called while the pointer is held down, so dig
+// designations can be painted by dragging.
+func (d *World) OnPointerReleased(x, y int) propagation.Event {
+	if ebiten.IsKeyPressed(digKey) {
+		d.publishDig(x, y)
+	}
+	return propagation.Propagate
+}
+
+func (d *World) publishBuild(x, y int, side direction.Direction) {
+	if err := d.eventBus.Publish(&input.Build{X: x, Y: y, Z: d.level, Side: side}); err != nil {
+		d.logger.Error("failed to publish build event", slog.Int("x", x), slog.Int("y", y), slog.Any("error", err))
+	}
+}
+
+// closestEdge returns the edge of the cell under the pixel position (x, y)
+// that is closest to it.
+func closestEdge(x, y int) direction.Direction {
+	cx, cy := x%CellSize, y%CellSize
+	edges := []struct {
+		side direction.Direction
+		dist int
+	}{
+		{direction.North, cy},
+		{direction.South, CellSize - 1 - cy},
+		{direction.West, cx},
+		{direction.East, CellSize - 1 - cx},
+	}
+	closest := edges[0]
+	for _, e := range edges[1:] {
+		if e.dist < closest.dist {
+			closest = e
+		}
+	}
+	return closest.side
+}
+
+func (d *World) publishDig(x, y int) {
+	if err := d.eventBus.Publish(&input.Dig{X: x, Y: y, Z: d.level}); err != nil {
+		d.logger.Error("failed to publish dig event", slog.Int("x", x), slog.Int("y", y), slog.Any("error", err))
+	}
+}
 
 func (d *World) Draw(screen *ebiten.Image) {
+	var stairsDown, remembered []point.P
 	for step := range d.terrain.Walk() {
 		x, y := step.X, step.Y
 		cell := step.Cell
 
+		// stairs on the level below lead down from the viewed level
+		if step.Z == d.level-1 && cell&terrain.Stairs != 0 {
+			stairsDown = append(stairsDown, point.New(x, y))
+		}
+		if step.Z != d.level {
+			continue
+		}
+
+		p := point.New3(x, y, d.level)
+		if !d.explored(p) {
+			vector.FillRect(screen, float32(x*CellSize), float32(y*CellSize), CellSize, CellSize, colorUnexplored, false)
+			continue
+		}
+		if !d.visible(p) {
+			remembered = append(remembered, p)
+		}
+
 		if cell&terrain.Solid != 0 {
 			// Draw solid cells as filled rectangles
 			vector.FillRect(screen, float32(x*CellSize), float32(y*CellSize), CellSize, CellSize, colorSolid, false)
+		} else {
+			// Draw the ground of open cells in the color of their material
+			vector.FillRect(screen, float32(x*CellSize), float32(y*CellSize), CellSize, CellSize, step.Material.Color(), false)
+			if step.Biome == terrain.Forest {
+				vector.FillRect(screen, float32(x*CellSize), float32(y*CellSize), CellSize, CellSize, colorForest, false)
+			}
+		}
+
+		if cell&terrain.Stairs != 0 {
+			drawStairs(screen, x, y, true)
 		}
 
-		for _, border := range d.terrain.Walls(x, y) {
+		for _, border := range cell.Walls() {
 			switch border {
 			case terrain.BorderNorth:
 				vector.StrokeLine(screen, float32(x*CellSize), float32(y*CellSize), float32((x+1)*CellSize), float32(y*CellSize), 2, colorBorder, false)
@@ -89,10 +259,33 @@ func (d *World) Draw(screen *ebiten.Image) {
 				vector.StrokeLine(screen, float32(x*CellSize), float32(y*CellSize), float32(x*CellSize), float32((y+1)*CellSize), 2, colorBorder, false)
 			}
 		}
+
+		drawDoor(screen, x, y, step.DoorNorth, false)
+		drawDoor(screen, x, y, step.DoorWest, true)
+	}
+
+	for _, p := range stairsDown {
+		if d.explored(point.New3(p.X, p.Y, d.level)) {
+			drawStairs(screen, p.X, p.Y, false)
+		}
+	}
+
+	for _, p := range remembered {
+		vector.FillRect(screen, float32(p.X*CellSize), float32(p.Y*CellSize), CellSize, CellSize, colorRemembered, false)
 	}
 
 	for _, e := range d.entityStore.Entities() {
 		pos := e.Pos()
+		if pos.Z != d.level {
+			continue
+		}
+		seen := d.visible(PXToCell(pos))
+		if e.Components().Job() != nil {
+			seen = d.explored(PXToCell(pos)) // the player remembers where work is to be done
+		}
+		if !seen {
+			continue
+		}
 		x := float32(pos.X)
 		y := float32(pos.Y)
 		if k := e.Components().Kind(); k != nil {
@@ -101,11 +294,20 @@ func (d *World) Draw(screen *ebiten.Image) {
 				drawEntityDiamond(screen, x, y)
 			case kind.Apple:
 				drawApple(screen, x, y)
+			case kind.DigSite:
+				drawDigSite(screen, x, y)
+			case kind.Stone:
+				drawStone(screen, x, y)
+			case kind.Ghost:
+				j := e.Components().Job()
+				drawGhost(screen, j.Cell(), j.Side())
 			}
 		}
 	}
 
 	for _, p := range d.componentStore.PathEntries() {
-		drawPath(screen, p.Cells())
+		drawPath(screen, p.Cells(), d.level)
 	}
+
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("level: %d", d.level), 0, 0)
 }
@@ -0,0 +1,390 @@
+// Package ascii reads and writes terrain as plain text grids, so maps for
+// tests and fixtures can be written by hand.
+//
+// Every character of a map row is one cell. The default glyphs are:
+//
+//	.  floor
+//	#  solid
+//	^  floor with BorderNorth
+//	v  floor with BorderSouth
+//	<  floor with BorderWest
+//	>  floor with BorderEast
+//	,  soil
+//	:  sand
+//	~  shallow water
+//	=  road
+//	W  deep water
+//	@  floor with a human spawn
+//	a  floor with an apple spawn
+//
+// A wall is shared by the cells on both sides of it, so a border on one side
+// of an edge is a border on the other side as well. Print writes both. The
+// same goes for doors.
+//
+// Other combinations are defined in legend lines before the map, for example
+//
+//	A = solid border-north border-west
+//	h = sand spawn=human
+//	D = border-east door-east=closed biome=forest
+//
+// A legend line lists the flags, the material, the doors, the biome and the
+// spawn of the glyph. Flags are solid, border-north, border-south,
+// border-west, border-east, ceiling, floor and stairs. Materials are stone,
+// soil, sand, shallow-water, road and deep-water. Doors are door-north,
+// door-south, door-west and door-east, set to open, closed or locked.
+// Biomes are grassland, forest, rock and water. Lines starting with // and
+// empty lines are ignored.
+package ascii
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// Spawn is an entity that should be created at a cell. Name is the name of
+// the blueprint, such as "human" or "apple".
+type Spawn struct {
+	Name string
+	P    point.P
+}
+
+// glyph is what a single character stands for.
+type glyph struct {
+	cell     terrain.Cell
+	material terrain.Material
+	doors    [len(doorSides)]terrain.DoorState // by the index of the side in doorSides
+	biome    terrain.Biome
+	spawn    string
+}
+
+var defaultGlyphs = map[rune]glyph{
+	'.': {},
+	'#': {cell: terrain.Solid},
+	'^': {cell: terrain.BorderNorth},
+	'v': {cell: terrain.BorderSouth},
+	'<': {cell: terrain.BorderWest},
+	'>': {cell: terrain.BorderEast},
+	',': {material: terrain.Soil},
+	':': {material: terrain.Sand},
+	'~': {material: terrain.ShallowWater},
+	'=': {material: terrain.Road},
+	'W': {material: terrain.DeepWater},
+	'@': {spawn: "human"},
+	'a': {spawn: "apple"},
+}
+
+// legendGlyphs are handed out by Print for combinations without a default
+// glyph. When they run out, letters from U+0100 on are handed out.
+const legendGlyphs = "ABCDEFGHIJKLMNOPQRSTUVXYZbcdefghijklmnopqrstuwxyz0123456789&*+?!$"
+
+// legendGlyph returns the glyph Print hands out after the first n.
+func legendGlyph(n int) rune {
+	ascii := []rune(legendGlyphs)
+	if n < len(ascii) {
+		return ascii[n]
+	}
+	n -= len(ascii)
+	for r := rune(0x100); ; r++ {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if n == 0 {
+			return r
+		}
+		n--
+	}
+}
+
+type flagName struct {
+	flag terrain.Cell
+	name string
+}
+
+var flagNames = []flagName{
+	{terrain.Solid, "solid"},
+	{terrain.BorderNorth, "border-north"},
+	{terrain.BorderSouth, "border-south"},
+	{terrain.BorderWest, "border-west"},
+	{terrain.BorderEast, "border-east"},
+	{terrain.Ceiling, "ceiling"},
+	{terrain.Floor, "floor"},
+	{terrain.Stairs, "stairs"},
+}
+
+var materialNames = map[terrain.Material]string{
+	terrain.Stone:        "stone",
+	terrain.Soil:         "soil",
+	terrain.Sand:         "sand",
+	terrain.ShallowWater: "shallow-water",
+	terrain.Road:         "road",
+	terrain.DeepWater:    "deep-water",
+}
+
+type doorSide struct {
+	side direction.Direction
+	name string
+}
+
+// doorSides are the sides of a cell a door can be on.
+var doorSides = [...]doorSide{
+	{direction.North, "door-north"},
+	{direction.South, "door-south"},
+	{direction.West, "door-west"},
+	{direction.East, "door-east"},
+}
+
+var doorStateNames = map[terrain.DoorState]string{
+	terrain.DoorOpen:   "open",
+	terrain.DoorClosed: "closed",
+	terrain.DoorLocked: "locked",
+}
+
+var biomeNames = map[terrain.Biome]string{
+	terrain.Grassland: "grassland",
+	terrain.Forest:    "forest",
+	terrain.Rock:      "rock",
+	terrain.Water:     "water",
+}
+
+const legendSeparator = " = "
+
+var ErrSyntax = errors.New("ascii map syntax error")
+
+// Parse reads a map from r and returns the terrain and the spawns in it.
+func Parse(r io.Reader) (*terrain.Terrain, []Spawn, error) {
+	glyphs := maps.Clone(defaultGlyphs)
+	var rows [][]rune
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		case strings.Contains(line, legendSeparator):
+			if len(rows) > 0 {
+				return nil, nil, fmt.Errorf("%w: line %d: legend after the map", ErrSyntax, n)
+			}
+			ch, g, err := parseLegend(line)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			glyphs[ch] = g
+		default:
+			row := []rune(line)
+			if len(rows) > 0 && len(row) != len(rows[0]) {
+				return nil, nil, fmt.Errorf("%w: line %d: row has %d cells, want %d", ErrSyntax, n, len(row), len(rows[0]))
+			}
+			rows = append(rows, row)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read map: %w", err)
+	}
+
+	var w int
+	if len(rows) > 0 {
+		w = len(rows[0])
+	}
+	t := terrain.New(w, len(rows))
+	var spawns []Spawn
+	for y, row := range rows {
+		for x, ch := range row {
+			g, ok := glyphs[ch]
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: unknown glyph %q at (%d, %d)", ErrSyntax, ch, x, y)
+			}
+			if err := t.Fill(x, y, g.cell&^terrain.Borders); err != nil {
+				return nil, nil, err
+			}
+			if err := t.SetMaterial(x, y, g.material); err != nil {
+				return nil, nil, err
+			}
+			if err := t.SetBiome(x, y, g.biome); err != nil {
+				return nil, nil, err
+			}
+			if g.spawn != "" {
+				spawns = append(spawns, Spawn{Name: g.spawn, P: point.New(x, y)})
+			}
+		}
+	}
+	// a border or door on either side of an edge puts it on the edge
+	for y, row := range rows {
+		for x, ch := range row {
+			g := glyphs[ch]
+			if err := t.AddWalls(x, y, g.cell); err != nil {
+				return nil, nil, err
+			}
+			for i, d := range doorSides {
+				if g.doors[i] == terrain.NoDoor {
+					continue
+				}
+				if err := t.SetDoor(x, y, d.side, g.doors[i]); err != nil {
+					return nil, nil, fmt.Errorf("%w: %v at (%d, %d)", ErrSyntax, err, x, y)
+				}
+			}
+		}
+	}
+	return t, spawns, nil
+}
+
+// MustParse parses the map in s and panics on error. It is meant for
+// fixtures in tests.
+func MustParse(s string) (*terrain.Terrain, []Spawn) {
+	t, spawns, err := Parse(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return t, spawns
+}
+
+func parseLegend(line string) (rune, glyph, error) {
+	key, def, _ := strings.Cut(line, legendSeparator)
+	key = strings.TrimSpace(key)
+	if len([]rune(key)) != 1 {
+		return 0, glyph{}, fmt.Errorf("%w: legend key %q must be a single character", ErrSyntax, key)
+	}
+
+	var g glyph
+	for _, token := range strings.Fields(def) {
+		if name, ok := strings.CutPrefix(token, "spawn="); ok {
+			g.spawn = name
+			continue
+		}
+		if name, ok := strings.CutPrefix(token, "biome="); ok {
+			b, ok := byName(biomeNames, name)
+			if !ok {
+				return 0, glyph{}, fmt.Errorf("%w: unknown biome %q", ErrSyntax, name)
+			}
+			g.biome = b
+			continue
+		}
+		if name, state, ok := strings.Cut(token, "="); ok {
+			i := slices.IndexFunc(doorSides[:], func(d doorSide) bool { return d.name == name })
+			s, found := byName(doorStateNames, state)
+			if i < 0 || !found {
+				return 0, glyph{}, fmt.Errorf("%w: unknown legend token %q", ErrSyntax, token)
+			}
+			g.doors[i] = s
+			continue
+		}
+		if f := slices.IndexFunc(flagNames, func(f flagName) bool { return f.name == token }); f >= 0 {
+			g.cell |= flagNames[f].flag
+			continue
+		}
+		m, ok := byName(materialNames, token)
+		if !ok {
+			return 0, glyph{}, fmt.Errorf("%w: unknown legend token %q", ErrSyntax, token)
+		}
+		g.material = m
+	}
+	return []rune(key)[0], g, nil
+}
+
+// byName returns the key with the given name.
+func byName[K comparable](names map[K]string, name string) (K, bool) {
+	for k, n := range names {
+		if n == name {
+			return k, true
+		}
+	}
+	var zero K
+	return zero, false
+}
+
+// Print writes the terrain and spawns to w. Cells that have no default glyph
+// get a glyph from a legend that is written before the map.
+func Print(w io.Writer, t *terrain.Terrain, spawns []Spawn) error {
+	spawnAt := make(map[point.P]string, len(spawns))
+	for _, s := range spawns {
+		if _, ok := spawnAt[s.P]; ok {
+			return fmt.Errorf("more than one spawn at %v", s.P)
+		}
+		spawnAt[s.P] = s.Name
+	}
+
+	byGlyph := make(map[glyph]rune, len(defaultGlyphs))
+	for ch, g := range defaultGlyphs {
+		byGlyph[g] = ch
+	}
+	var legend []rune // in the order the glyphs were handed out
+
+	rows := make([][]rune, t.Height())
+	for s := range t.Walk() {
+		g := glyph{cell: s.Cell, material: s.Material, biome: s.Biome, spawn: spawnAt[point.New(s.X, s.Y)]}
+		for i, d := range doorSides {
+			g.doors[i] = t.Door(s.X, s.Y, d.side)
+		}
+		ch, ok := byGlyph[g]
+		if !ok {
+			ch = legendGlyph(len(legend))
+			byGlyph[g] = ch
+			legend = append(legend, ch)
+		}
+		rows[s.Y] = append(rows[s.Y], ch)
+	}
+
+	glyphs := make(map[rune]glyph, len(byGlyph))
+	for g, ch := range byGlyph {
+		glyphs[ch] = g
+	}
+	bw := bufio.NewWriter(w)
+	for _, ch := range legend {
+		fmt.Fprintf(bw, "%c%s%s\n", ch, legendSeparator, glyphs[ch].String())
+	}
+	if len(legend) > 0 {
+		bw.WriteString("\n")
+	}
+	for _, row := range rows {
+		bw.WriteString(string(row))
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// String returns the printed terrain and spawns.
+func String(t *terrain.Terrain, spawns []Spawn) (string, error) {
+	var sb strings.Builder
+	if err := Print(&sb, t, spawns); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// String returns the legend definition of the glyph.
+func (g glyph) String() string {
+	var tokens []string
+	for _, f := range flagNames {
+		if g.cell&f.flag != 0 {
+			tokens = append(tokens, f.name)
+		}
+	}
+	if g.material != terrain.Stone {
+		tokens = append(tokens, materialNames[g.material])
+	}
+	for i, d := range doorSides {
+		if g.doors[i] != terrain.NoDoor {
+			tokens = append(tokens, d.name+"="+doorStateNames[g.doors[i]])
+		}
+	}
+	if g.biome != terrain.NoBiome {
+		tokens = append(tokens, "biome="+biomeNames[g.biome])
+	}
+	if g.spawn != "" {
+		tokens = append(tokens, "spawn="+g.spawn)
+	}
+	if len(tokens) == 0 {
+		return "stone"
+	}
+	return strings.Join(tokens, " ")
+}
@@ -0,0 +1,140 @@
+package ascii_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+func TestParse(t *testing.T) {
+	tr, spawns := ascii.MustParse(`
+// a room with a wall segment and a puddle
+A = border-north border-west
+D = border-east door-east=closed biome=forest
+#######
+#A..>a#
+#.~~.<#
+#@..D.#
+#######
+`)
+
+	if tr.Width() != 7 || tr.Height() != 5 {
+		t.Fatalf("size = %dx%d, want 7x5", tr.Width(), tr.Height())
+	}
+	if !tr.Solid(0, 0) || tr.Solid(1, 1) {
+		t.Errorf("unexpected solidity")
+	}
+	if !tr.HasFlag(1, 1, terrain.BorderNorth) || !tr.HasFlag(1, 1, terrain.BorderWest) {
+		t.Errorf("legend glyph A did not set its borders")
+	}
+	if tr.Traversable(point.New(4, 1), direction.East) {
+		t.Errorf("Traversable() through the east border = true, want false")
+	}
+	if tr.Traversable(point.New(4, 2), direction.East) {
+		t.Errorf("Traversable() through the west border = true, want false")
+	}
+	if got := tr.Material(2, 2); got != terrain.ShallowWater {
+		t.Errorf("Material(2, 2) = %v, want %v", got, terrain.ShallowWater)
+	}
+	if got := tr.Door(5, 3, direction.West); got != terrain.DoorClosed {
+		t.Errorf("Door(5, 3, West) = %v, want %v", got, terrain.DoorClosed)
+	}
+	if got := tr.Biome(4, 3); got != terrain.Forest {
+		t.Errorf("Biome(4, 3) = %v, want %v", got, terrain.Forest)
+	}
+
+	want := []ascii.Spawn{
+		{Name: "apple", P: point.New(5, 1)},
+		{Name: "human", P: point.New(1, 3)},
+	}
+	if len(spawns) != len(want) {
+		t.Fatalf("spawns = %v, want %v", spawns, want)
+	}
+	for i := range want {
+		if spawns[i] != want[i] {
+			t.Errorf("spawns[%d] = %v, want %v", i, spawns[i], want[i])
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		m    string
+	}{
+		{name: "ragged rows", m: "###\n##\n"},
+		{name: "unknown glyph", m: "#?#\n"},
+		{name: "unknown legend token", m: "A = lava\nA\n"},
+		{name: "legend after map", m: "#\nA = solid\n"},
+		{name: "long legend key", m: "AB = solid\n"},
+		{name: "unknown door state", m: "A = door-north=ajar\nA\n"},
+		{name: "unknown biome", m: "A = biome=desert\nA\n"},
+		{name: "door on the outside", m: "A = door-north=open\nA\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ascii.Parse(strings.NewReader(tt.m)); !errors.Is(err, ascii.ErrSyntax) {
+				t.Errorf("Parse() error = %v, want %v", err, ascii.ErrSyntax)
+			}
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	t.Run("default glyphs", func(t *testing.T) {
+		m := "^v,:\n.^=~\n<a><\nW.@.\n####\n"
+		tr, spawns := ascii.MustParse(m)
+		got, err := ascii.String(tr, spawns)
+		if err != nil {
+			t.Fatalf("String() error = %v", err)
+		}
+		if got != m {
+			t.Errorf("String() =\n%s\nwant\n%s", got, m)
+		}
+	})
+
+	for _, g := range []struct {
+		name      string
+		generator generate.Generator
+	}{
+		{"caves", generate.DefaultCaves},
+		{"rooms", generate.DefaultRooms},
+		{"outdoor", generate.DefaultOutdoor},
+	} {
+		t.Run(g.name+" terrain round trips", func(t *testing.T) {
+			src := terrain.New(40, 30)
+			if _, err := generate.Generate(src, generate.WithGenerator(g.generator), generate.WithSeed(1)); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			spawns := []ascii.Spawn{{Name: "human", P: point.New(3, 4)}, {Name: "tree", P: point.New(5, 5)}}
+			s, err := ascii.String(src, spawns)
+			if err != nil {
+				t.Fatalf("String() error = %v", err)
+			}
+			dst, gotSpawns, err := ascii.Parse(strings.NewReader(s))
+			if err != nil {
+				t.Fatalf("Parse() error = %v\n%s", err, s)
+			}
+			for step := range src.Walk() {
+				cell, _ := dst.Cell(step.X, step.Y)
+				if cell != step.Cell || dst.Material(step.X, step.Y) != step.Material || dst.Biome(step.X, step.Y) != step.Biome {
+					t.Fatalf("cell (%d, %d) differs after round trip", step.X, step.Y)
+				}
+				for _, side := range []direction.Direction{direction.North, direction.South, direction.East, direction.West} {
+					if got, want := dst.Door(step.X, step.Y, side), src.Door(step.X, step.Y, side); got != want {
+						t.Fatalf("Door(%d, %d, %d) = %v after round trip, want %v", step.X, step.Y, side, got, want)
+					}
+				}
+			}
+			if len(gotSpawns) != len(spawns) {
+				t.Errorf("spawns = %v, want %v", gotSpawns, spawns)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package terrain
+
+import "fmt"
+
+// Biome is the kind of landscape a cell belongs to. It does not change how
+// agents move, that is up to the material and solidity of the cell, but
+// decides what grows and lives there.
+//
+//go:generate go tool stringer -type=Biome
+type Biome byte
+
+const (
+	NoBiome Biome = iota
+	Grassland
+	Forest
+	Rock
+	Water
+)
+
+// Biome returns the biome of the cell at (x, y). Cells out of bounds have no biome.
+func (t *Terrain) Biome(x, y int) Biome {
+	if !t.InBounds(x, y) {
+		return NoBiome
+	}
+	return t.biomes[t.index(x, y)]
+}
+
+// SetBiome sets the biome of the cell at (x, y). Biomes do not affect
+// movement, so no event is emitted.
+func (t *Terrain) SetBiome(x, y int, b Biome) error {
+	if !t.InBounds(x, y) {
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d) out of (%d, %d)", x, y, t.width, t.height)
+	}
+	t.biomes[t.index(x, y)] = b
+	return nil
+}
@@ -0,0 +1,449 @@
+package terrain
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+)
+
+// ChunkStore persists chunks that are evicted from memory.
+type ChunkStore interface {
+	// Load returns the cells of the chunk at chunk coordinate c and false if the chunk was never saved.
+	Load(c point.P) ([]Cell, bool, error)
+	// Save stores the cells of the chunk at chunk coordinate c.
+	Save(c point.P, cells []Cell) error
+}
+
+type chunk struct {
+	cells    []Cell
+	lastUsed uint64
+	dirty    bool // changed since it was last loaded from or saved to the store
+}
+
+// Chunked is a terrain that is split into square chunks of a fixed size.
+// Chunks are created the first time a cell in them is filled and can be
+// evicted to a ChunkStore when too many of them are held in memory.
+// It exposes the same queries as Terrain, so it can be used for very large
+// or unbounded maps.
+type Chunked struct {
+	chunkSize     int
+	bounded       bool
+	width, height int
+	fill          Cell // value of cells in chunks that were never created
+	store         ChunkStore
+	maxResident   int // maximum number of chunks held in memory, 0 means no limit
+	resident      map[point.P]*chunk
+	known         map[point.P]struct{} // every chunk that was ever created
+	clock         uint64
+	err           error
+}
+
+type ChunkedOption func(*Chunked)
+
+// WithBounds limits the chunked terrain to w by h cells. Without bounds the
+// terrain extends infinitely in every direction, including negative coordinates.
+func WithBounds(w, h int) ChunkedOption {
+	return func(t *Chunked) {
+		t.bounded = true
+		t.width, t.height = max(w, 0), max(h, 0)
+	}
+}
+
+// WithChunkFill sets the value of cells that have never been filled.
+func WithChunkFill(cell Cell) ChunkedOption {
+	return func(t *Chunked) {
+		t.fill = cell
+	}
+}
+
+// WithChunkStore evicts the least recently used chunks to the store once
+// more than maxResident chunks are held in memory.
+func WithChunkStore(store ChunkStore, maxResident int) ChunkedOption {
+	return func(t *Chunked) {
+		t.store = store
+		t.maxResident = max(maxResident, 1)
+	}
+}
+
+// NewChunked creates a chunked terrain with chunks of chunkSize by chunkSize cells.
+func NewChunked(chunkSize int, opts ...ChunkedOption) *Chunked {
+	t := &Chunked{
+		chunkSize: max(chunkSize, 1),
+		resident:  make(map[point.P]*chunk),
+		known:     make(map[point.P]struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Err returns the first error that occurred while loading or evicting a chunk
+// during a query. Queries treat chunks that fail to load as never filled.
+func (t *Chunked) Err() error {
+	return t.err
+}
+
+// Width returns the width of the terrain, or 0 if it is unbounded.
+func (t *Chunked) Width() int {
+	return t.width
+}
+
+// Height returns the height of the terrain, or 0 if it is unbounded.
+func (t *Chunked) Height() int {
+	return t.height
+}
+
+// ChunkSize returns the width and height of a single chunk.
+func (t *Chunked) ChunkSize() int {
+	return t.chunkSize
+}
+
+// Resident returns the number of chunks that are currently held in memory.
+func (t *Chunked) Resident() int {
+	return len(t.resident)
+}
+
+func (t *Chunked) InBounds(x, y int) bool {
+	if !t.bounded {
+		return true
+	}
+	return x >= 0 && x < t.width && y >= 0 && y < t.height
+}
+
+// ChunkCoord returns the coordinate of the chunk that contains the cell at (x, y).
+func (t *Chunked) ChunkCoord(x, y int) point.P {
+	return point.New(floorDiv(x, t.chunkSize), floorDiv(y, t.chunkSize))
+}
+
+// local returns the index of the cell at (x, y) within its chunk.
+func (t *Chunked) local(x, y int) int {
+	lx := x - floorDiv(x, t.chunkSize)*t.chunkSize
+	ly := y - floorDiv(y, t.chunkSize)*t.chunkSize
+	return ly*t.chunkSize + lx
+}
+
+// Cell returns the cell at (x, y) and false if the coordinates are out of bounds.
+// A wall is shared by the cells on both sides of it, so the Border flags of
+// the cell are set for the walls around it, whichever cell was filled with it.
+func (t *Chunked) Cell(x, y int) (Cell, bool) {
+	cell, ok := t.stored(x, y)
+	if !ok {
+		return 0, false
+	}
+	cell &^= Borders
+	for side, flag := range wallFlags {
+		if t.wall(x, y, side) {
+			cell |= flag
+		}
+	}
+	return cell, true
+}
+
+// stored returns the cell at (x, y) as it was filled.
+func (t *Chunked) stored(x, y int) (Cell, bool) {
+	if !t.InBounds(x, y) {
+		return 0, false
+	}
+	c, err := t.chunk(t.ChunkCoord(x, y), false)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	if c == nil {
+		return t.fill, true
+	}
+	return c.cells[t.local(x, y)], true
+}
+
+// Fill sets the cell at (x, y). Like Terrain.Fill, its Border flags put walls
+// on the edges around the cell and the walls on the other edges are kept; use
+// SetWall to remove a wall.
+func (t *Chunked) Fill(x, y int, cell Cell) error {
+	if !t.InBounds(x, y) {
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d) out of (%d, %d)", x, y, t.width, t.height)
+	}
+	c, err := t.chunk(t.ChunkCoord(x, y), true)
+	if err != nil {
+		return fmt.Errorf("failed to get chunk for (%d, %d): %w", x, y, err)
+	}
+	i := t.local(x, y)
+	c.cells[i] = cell | c.cells[i]&Borders
+	c.dirty = true
+	return nil
+}
+
+// Wall reports whether there is a wall on the given side (North, South, East
+// or West) of the cell at (x, y).
+func (t *Chunked) Wall(x, y int, side direction.Direction) bool {
+	if _, ok := wallFlags[side]; !ok || !t.InBounds(x, y) {
+		return false
+	}
+	return t.wall(x, y, side)
+}
+
+// SetWall puts or removes the wall on the given side of the cell at (x, y).
+// Removing a wall clears the Border flags on both sides of the edge.
+func (t *Chunked) SetWall(x, y int, side direction.Direction, wall bool) error {
+	flag, ok := wallFlags[side]
+	if !ok || !t.InBounds(x, y) {
+		return fmt.Errorf("no edge on side %d of (%d, %d)", side, x, y)
+	}
+	if wall {
+		cell, _ := t.stored(x, y)
+		return t.Fill(x, y, cell|flag)
+	}
+	if err := t.clearFlag(x, y, flag); err != nil {
+		return err
+	}
+	move := moves[side]
+	if nx, ny := x+move.dx, y+move.dy; t.InBounds(nx, ny) {
+		return t.clearFlag(nx, ny, wallFlags[side.Opposite()])
+	}
+	return nil
+}
+
+// clearFlag removes the flag from the cell at (x, y) as it is stored.
+func (t *Chunked) clearFlag(x, y int, flag Cell) error {
+	if cell, _ := t.stored(x, y); cell&flag == 0 {
+		return nil // nothing to clear, don't create a chunk for it
+	}
+	c, err := t.chunk(t.ChunkCoord(x, y), true)
+	if err != nil {
+		return fmt.Errorf("failed to get chunk for (%d, %d): %w", x, y, err)
+	}
+	c.cells[t.local(x, y)] &^= flag
+	c.dirty = true
+	return nil
+}
+
+func (t *Chunked) Solid(x, y int) bool {
+	return t.HasFlag(x, y, Solid)
+}
+
+func (t *Chunked) HasFlag(x, y int, flag Cell) bool {
+	cell, ok := t.Cell(x, y)
+	return ok && cell&flag != 0
+}
+
+func (t *Chunked) HasCeiling(x, y int) bool {
+	return t.HasFlag(x, y, Ceiling)
+}
+
+func (t *Chunked) HasFloor(x, y int) bool {
+	return t.HasFlag(x, y, Floor)
+}
+
+// Walls returns the Border flags of the walls around the cell at (x, y).
+func (t *Chunked) Walls(x, y int) []Cell {
+	cell, ok := t.Cell(x, y)
+	if !ok {
+		return nil
+	}
+	return cell.Walls()
+}
+
+// Traversable checks if a point is traversable in a given direction.
+func (t *Chunked) Traversable(p point.P, d direction.Direction) bool {
+	return traversable(t.Cell, t.wall, p, d)
+}
+
+// wall reports whether there is a wall on the given side of the cell at
+// (x, y). Chunks store the Border flags in every cell, so an edge has a wall
+// when the cell on either side of it has the flag.
+func (t *Chunked) wall(x, y int, side direction.Direction) bool {
+	move := moves[side]
+	own, _ := t.stored(x, y)
+	facing, _ := t.stored(x+move.dx, y+move.dy)
+	return own&wallFlags[side] != 0 || facing&wallFlags[side.Opposite()] != 0
+}
+
+// Walk yields every cell of every chunk that was ever created, chunk by chunk.
+// Evicted chunks are loaded back in while walking. Cells that were never
+// filled are not visited.
+func (t *Chunked) Walk() iter.Seq[Step] {
+	return func(yield func(Step) bool) {
+		coords := make([]point.P, 0, len(t.known))
+		for c := range t.known {
+			coords = append(coords, c)
+		}
+		slices.SortFunc(coords, func(a, b point.P) int {
+			return cmp.Or(cmp.Compare(a.Y, b.Y), cmp.Compare(a.X, b.X))
+		})
+
+		for _, coord := range coords {
+			c, err := t.chunk(coord, false)
+			if err != nil && t.err == nil {
+				t.err = err
+			}
+			if c == nil {
+				continue
+			}
+			originX, originY := coord.X*t.chunkSize, coord.Y*t.chunkSize
+			for ly := range t.chunkSize {
+				for lx := range t.chunkSize {
+					x, y := originX+lx, originY+ly
+					if !t.InBounds(x, y) {
+						continue
+					}
+					cell, _ := t.Cell(x, y)
+					if !yield(Step{X: x, Y: y, Cell: cell}) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// Flush saves the chunks held in memory that changed to the store.
+func (t *Chunked) Flush() error {
+	if t.store == nil {
+		return nil
+	}
+	for coord, c := range t.resident {
+		if err := t.save(coord, c); err != nil {
+			return fmt.Errorf("failed to save chunk %v: %w", coord, err)
+		}
+	}
+	return nil
+}
+
+// save writes the chunk to the store if it changed since it was last loaded
+// or saved.
+func (t *Chunked) save(coord point.P, c *chunk) error {
+	if !c.dirty {
+		return nil
+	}
+	if err := t.store.Save(coord, c.cells); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// chunk returns the chunk at the chunk coordinate, loading it from the store
+// if it was evicted. If create is true a missing chunk is created.
+func (t *Chunked) chunk(coord point.P, create bool) (*chunk, error) {
+	t.clock++
+	if c, ok := t.resident[coord]; ok {
+		c.lastUsed = t.clock
+		return c, nil
+	}
+
+	var (
+		cells []Cell
+		dirty bool // a new chunk is not in the store yet
+	)
+	if _, ok := t.known[coord]; ok && t.store != nil {
+		loaded, found, err := t.store.Load(coord)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chunk %v: %w", coord, err)
+		}
+		if found {
+			if len(loaded) != t.chunkSize*t.chunkSize {
+				return nil, fmt.Errorf("chunk %v has %d cells, expected %d", coord, len(loaded), t.chunkSize*t.chunkSize)
+			}
+			cells = loaded
+		}
+	}
+
+	if cells == nil {
+		if !create {
+			return nil, nil
+		}
+		cells = make([]Cell, t.chunkSize*t.chunkSize)
+		dirty = true
+		if t.fill != 0 {
+			for i := range cells {
+				cells[i] = t.fill
+			}
+		}
+	}
+
+	c := &chunk{cells: cells, lastUsed: t.clock, dirty: dirty}
+	t.resident[coord] = c
+	t.known[coord] = struct{}{}
+	if err := t.evict(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// evict drops the least recently used chunks until the number of resident
+// chunks is within the limit. Chunks that changed are saved first.
+func (t *Chunked) evict() error {
+	if t.store == nil || t.maxResident == 0 {
+		return nil
+	}
+	for len(t.resident) > t.maxResident {
+		var (
+			oldest      point.P
+			oldestChunk *chunk
+		)
+		for coord, c := range t.resident {
+			if oldestChunk == nil || c.lastUsed < oldestChunk.lastUsed {
+				oldest, oldestChunk = coord, c
+			}
+		}
+		if err := t.save(oldest, oldestChunk); err != nil {
+			return fmt.Errorf("failed to evict chunk %v: %w", oldest, err)
+		}
+		delete(t.resident, oldest)
+	}
+	return nil
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// DiskStore is a ChunkStore that writes every chunk to its own file in a directory.
+type DiskStore struct {
+	dir string
+}
+
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir}
+}
+
+func (s *DiskStore) path(c point.P) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d_%d.chunk", c.X, c.Y))
+}
+
+func (s *DiskStore) Load(c point.P) ([]Cell, bool, error) {
+	b, err := os.ReadFile(s.path(c))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	cells := make([]Cell, len(b))
+	for i, v := range b {
+		cells[i] = Cell(v)
+	}
+	return cells, true, nil
+}
+
+func (s *DiskStore) Save(c point.P, cells []Cell) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	b := make([]byte, len(cells))
+	for i, v := range cells {
+		b[i] = byte(v)
+	}
+	return os.WriteFile(s.path(c), b, 0o644)
+}
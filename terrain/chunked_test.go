@@ -0,0 +1,221 @@
+package terrain_test
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+var allDirections = []direction.Direction{
+	direction.North, direction.South, direction.East, direction.West,
+	direction.NorthEast, direction.NorthWest, direction.SouthEast, direction.SouthWest,
+}
+
+func TestChunked_MatchesTerrain(t *testing.T) {
+	const w, h = 23, 17
+	r := rand.New(rand.NewPCG(1, 2))
+	dense := terrain.New(w, h)
+	chunked := terrain.NewChunked(4, terrain.WithBounds(w, h), terrain.WithChunkStore(terrain.NewDiskStore(t.TempDir()), 3))
+
+	cells := make([]terrain.Cell, w*h)
+	for y := range h {
+		for x := range w {
+			cell := terrain.Cell(r.IntN(1 << 5))
+			cells[y*w+x] = cell
+			if err := dense.Fill(x, y, cell&^terrain.Borders); err != nil {
+				t.Fatalf("Terrain.Fill() error = %v", err)
+			}
+			if err := chunked.Fill(x, y, cell); err != nil {
+				t.Fatalf("Chunked.Fill() error = %v", err)
+			}
+		}
+	}
+	// a border on either side of an edge is a wall in both terrains
+	for y := range h {
+		for x := range w {
+			if err := dense.AddWalls(x, y, cells[y*w+x]); err != nil {
+				t.Fatalf("Terrain.AddWalls() error = %v", err)
+			}
+		}
+	}
+
+	compare := func(round string) {
+		t.Helper()
+		for y := -1; y <= h; y++ {
+			for x := -1; x <= w; x++ {
+				if dense.Solid(x, y) != chunked.Solid(x, y) {
+					t.Errorf("%s: Solid(%d, %d) differs", round, x, y)
+				}
+				if !slices.Equal(dense.Walls(x, y), chunked.Walls(x, y)) {
+					t.Errorf("%s: Walls(%d, %d) = %v, want %v", round, x, y, chunked.Walls(x, y), dense.Walls(x, y))
+				}
+				// every edge is checked from both of its sides
+				for _, d := range allDirections {
+					p := point.New(x, y)
+					if dense.Traversable(p, d) != chunked.Traversable(p, d) {
+						t.Errorf("%s: Traversable(%v, %v) differs", round, p, d)
+					}
+				}
+			}
+		}
+	}
+	compare("filled")
+
+	// filling cells again with other flags keeps the walls they do not name,
+	// SetWall removes them
+	sides := []direction.Direction{direction.North, direction.South, direction.East, direction.West}
+	for y := range h {
+		for x := range w {
+			switch r.IntN(3) {
+			case 0:
+				cell := terrain.Cell(r.IntN(1 << 5))
+				if err := dense.Fill(x, y, cell); err != nil {
+					t.Fatalf("Terrain.Fill() error = %v", err)
+				}
+				if err := chunked.Fill(x, y, cell); err != nil {
+					t.Fatalf("Chunked.Fill() error = %v", err)
+				}
+			case 1:
+				side := sides[r.IntN(len(sides))]
+				if err := dense.SetWall(x, y, side, false); err != nil {
+					t.Fatalf("Terrain.SetWall() error = %v", err)
+				}
+				if err := chunked.SetWall(x, y, side, false); err != nil {
+					t.Fatalf("Chunked.SetWall() error = %v", err)
+				}
+			}
+		}
+	}
+	compare("filled again")
+
+	if chunked.Resident() > 3 {
+		t.Errorf("Resident() = %d, want at most 3", chunked.Resident())
+	}
+
+	var count int
+	for s := range chunked.Walk() {
+		if cell, _ := dense.Cell(s.X, s.Y); cell != s.Cell {
+			t.Errorf("Walk() cell (%d, %d) = %08b, want %08b", s.X, s.Y, s.Cell, cell)
+		}
+		count++
+	}
+	if count != w*h {
+		t.Errorf("Walk() yielded %d cells, want %d", count, w*h)
+	}
+	if err := chunked.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+func TestChunked_Unbounded(t *testing.T) {
+	tr := terrain.NewChunked(8, terrain.WithChunkFill(terrain.Solid))
+
+	if !tr.Solid(-1000, 5000) {
+		t.Errorf("Solid() on an untouched chunk = false, want true")
+	}
+	if tr.Resident() != 0 {
+		t.Errorf("Resident() = %d, reading should not create chunks", tr.Resident())
+	}
+
+	if err := tr.Fill(-3, -9, 0); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	if tr.Solid(-3, -9) {
+		t.Errorf("Solid(-3, -9) = true, want false")
+	}
+	if got := tr.ChunkCoord(-3, -9); !got.Equal(point.New(-1, -2)) {
+		t.Errorf("ChunkCoord(-3, -9) = %v, want (-1, -2)", got)
+	}
+	if !tr.Solid(-4, -9) {
+		t.Errorf("Solid(-4, -9) = false, want true")
+	}
+}
+
+func TestChunked_EvictAndReload(t *testing.T) {
+	store := terrain.NewDiskStore(t.TempDir())
+	tr := terrain.NewChunked(2, terrain.WithChunkStore(store, 1))
+
+	if err := tr.Fill(0, 0, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	if err := tr.Fill(10, 10, terrain.BorderNorth); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	if tr.Resident() != 1 {
+		t.Fatalf("Resident() = %d, want 1", tr.Resident())
+	}
+	if _, found, err := store.Load(point.New(0, 0)); err != nil || !found {
+		t.Fatalf("expected chunk (0, 0) to be evicted to the store, found = %v, err = %v", found, err)
+	}
+
+	if !tr.Solid(0, 0) {
+		t.Errorf("Solid(0, 0) = false after reload, want true")
+	}
+	if !tr.HasFlag(10, 10, terrain.BorderNorth) {
+		t.Errorf("HasFlag(10, 10, BorderNorth) = false after reload, want true")
+	}
+	if err := tr.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+}
+
+// countingStore is a ChunkStore in memory that counts the chunks saved.
+type countingStore struct {
+	chunks map[point.P][]terrain.Cell
+	saves  int
+}
+
+func (s *countingStore) Load(c point.P) ([]terrain.Cell, bool, error) {
+	cells, ok := s.chunks[c]
+	return slices.Clone(cells), ok, nil
+}
+
+func (s *countingStore) Save(c point.P, cells []terrain.Cell) error {
+	s.chunks[c] = slices.Clone(cells)
+	s.saves++
+	return nil
+}
+
+func TestChunked_EvictSavesChanged(t *testing.T) {
+	store := &countingStore{chunks: make(map[point.P][]terrain.Cell)}
+	tr := terrain.NewChunked(2, terrain.WithChunkStore(store, 1))
+
+	for _, p := range []point.P{point.New(0, 0), point.New(10, 10)} {
+		if err := tr.Fill(p.X, p.Y, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+	}
+	if store.saves != 1 {
+		t.Fatalf("saves = %d after evicting a new chunk, want 1", store.saves)
+	}
+
+	// reading chunks back in does not change them, so evicting them again
+	// does not save them
+	for range 3 {
+		for _, p := range []point.P{point.New(0, 0), point.New(10, 10)} {
+			if !tr.Solid(p.X, p.Y) {
+				t.Fatalf("Solid(%d, %d) = false, want true", p.X, p.Y)
+			}
+		}
+	}
+	if store.saves != 2 {
+		t.Errorf("saves = %d after reading chunks, want 2", store.saves)
+	}
+
+	if err := tr.Fill(0, 1, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if err := tr.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if store.saves != 3 {
+		t.Errorf("saves = %d after flushing a changed chunk twice, want 3", store.saves)
+	}
+}
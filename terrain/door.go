@@ -0,0 +1,124 @@
+package terrain
+
+import (
+	"fmt"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+)
+
+// DoorState is the state of a door on the edge between two cells.
+//
+//go:generate go tool stringer -type=DoorState
+type DoorState byte
+
+const (
+	NoDoor DoorState = iota
+	DoorOpen
+	DoorClosed
+	DoorLocked
+)
+
+// closedDoorCost is the extra cost of passing a closed door, it has to be opened first.
+const closedDoorCost = 2
+
+const DoorChangedEventName = "DoorChanged"
+
+// DoorChangedEvent is emitted when a door is placed, removed, opened, closed or locked.
+type DoorChangedEvent struct {
+	X, Y, Z  int
+	Side     direction.Direction // side of the cell at (X, Y) that the door is on
+	Old, New DoorState
+}
+
+func (e *DoorChangedEvent) Event() string { return DoorChangedEventName }
+
+// WithEmitDoorChangedEvent sets the handler that is called every time a door
+// changes. Door changes are not part of a batch.
+func WithEmitDoorChangedEvent(handler func(*DoorChangedEvent)) Option {
+	return func(t *Terrain) {
+		t.emitDoorChangedEvent = handler
+	}
+}
+
+// edge returns where the door on the given side of the cell at (x, y) is
+// stored. Every edge between two cells is stored once, as the north or west
+// edge of the cell to the south or east. Edges on the outside of the
+// terrain have no storage.
+func (t *Terrain) edge(x, y int, side direction.Direction) (doors []DoorState, i int, ok bool) {
+	dx, dy, _ := side.Delta()
+	if side.Diagonal() || dx == 0 && dy == 0 || !t.InBounds(x, y) || !t.InBounds(x+dx, y+dy) {
+		return nil, 0, false
+	}
+	switch side {
+	case direction.North:
+		doors = t.northDoors
+	case direction.South:
+		doors, y = t.northDoors, y+1
+	case direction.West:
+		doors = t.westDoors
+	case direction.East:
+		doors, x = t.westDoors, x+1
+	}
+	return doors, t.index(x, y), true
+}
+
+// Door returns the state of the door on the given side (North, South, East
+// or West) of the cell at (x, y).
+func (t *Terrain) Door(x, y int, side direction.Direction) DoorState {
+	doors, i, ok := t.edge(x, y, side)
+	if !ok {
+		return NoDoor
+	}
+	return doors[i]
+}
+
+// SetDoor places a door in the given state on the given side of the cell at
+// (x, y). A door that is not locked lets agents through even if there are
+// borders on the edge. NoDoor removes the door.
+func (t *Terrain) SetDoor(x, y int, side direction.Direction, state DoorState) error {
+	doors, i, ok := t.edge(x, y, side)
+	if !ok {
+		return fmt.Errorf("no edge on side %d of (%d, %d) in (%d, %d)", side, x, y, t.width, t.height)
+	}
+	old := doors[i]
+	if old == state {
+		return nil
+	}
+	doors[i] = state
+	if t.emitDoorChangedEvent != nil {
+		t.emitDoorChangedEvent(&DoorChangedEvent{X: x, Y: y, Z: t.level, Side: side, Old: old, New: state})
+	}
+	return nil
+}
+
+// OpenDoor opens the closed door on the given side of the cell at p. Other
+// doors are left as they are.
+func (t *Terrain) OpenDoor(p point.P, side direction.Direction) error {
+	if t.Door(p.X, p.Y, side) != DoorClosed {
+		return nil
+	}
+	return t.SetDoor(p.X, p.Y, side, DoorOpen)
+}
+
+// DoorCost returns the extra cost of moving from p in direction d because of
+// a closed door on the way.
+func (t *Terrain) DoorCost(p point.P, d direction.Direction) float64 {
+	if t.Door(p.X, p.Y, d) == DoorClosed {
+		return closedDoorCost
+	}
+	return 0
+}
+
+// doorAtCorner reports whether a diagonal move from p in direction d passes
+// the corner of an edge with a door. Agents can not squeeze diagonally past
+// a door frame.
+func (t *Terrain) doorAtCorner(p point.P, d direction.Direction) bool {
+	vertical, horizontal := d.Split()
+	dx, dy, _ := d.Delta()
+	target := point.New(p.X+dx, p.Y+dy)
+	return t.Door(p.X, p.Y, vertical) != NoDoor ||
+		t.Door(p.X, p.Y, horizontal) != NoDoor ||
+		t.Door(target.X, target.Y, vertical.Opposite()) != NoDoor ||
+		t.Door(target.X, target.Y, horizontal.Opposite()) != NoDoor
+}
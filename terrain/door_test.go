@@ -0,0 +1,86 @@
+package terrain_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func TestTerrain_Door(t *testing.T) {
+	tr := terrain.New(2, 2)
+	if err := tr.SetDoor(0, 0, direction.East, terrain.DoorClosed); err != nil {
+		t.Fatalf("SetDoor() error = %v", err)
+	}
+	if got := tr.Door(1, 0, direction.West); got != terrain.DoorClosed {
+		t.Errorf("Door() from the other side = %v, want %v", got, terrain.DoorClosed)
+	}
+	if got := tr.Door(0, 0, direction.South); got != terrain.NoDoor {
+		t.Errorf("Door() = %v, want %v", got, terrain.NoDoor)
+	}
+	if err := tr.SetDoor(1, 0, direction.East, terrain.DoorOpen); err == nil {
+		t.Errorf("SetDoor() expected error for an edge on the border of the terrain")
+	}
+	if err := tr.OpenDoor(point.New(1, 0), direction.West); err != nil {
+		t.Fatalf("OpenDoor() error = %v", err)
+	}
+	if got := tr.Door(0, 0, direction.East); got != terrain.DoorOpen {
+		t.Errorf("Door() after OpenDoor() = %v, want %v", got, terrain.DoorOpen)
+	}
+}
+
+func TestTerrain_TraversableDoors(t *testing.T) {
+	tests := []struct {
+		name  string
+		state terrain.DoorState
+		cost  float64
+		want  bool
+	}{
+		{name: "open", state: terrain.DoorOpen, cost: 0, want: true},
+		{name: "closed", state: terrain.DoorClosed, cost: 2, want: true},
+		{name: "locked", state: terrain.DoorLocked, cost: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a wall with a door between the two cells of the top row
+			tr := terrain.New(2, 2)
+			if err := tr.Fill(0, 0, terrain.BorderEast); err != nil {
+				t.Fatalf("Fill() error = %v", err)
+			}
+			if err := tr.SetDoor(0, 0, direction.East, tt.state); err != nil {
+				t.Fatalf("SetDoor() error = %v", err)
+			}
+			p := point.New(0, 0)
+			if got := tr.Traversable(p, direction.East); got != tt.want {
+				t.Errorf("Traversable() = %v, want %v", got, tt.want)
+			}
+			if got := tr.Traversable(point.New(1, 0), direction.West); got != tt.want {
+				t.Errorf("Traversable() back = %v, want %v", got, tt.want)
+			}
+			if got := tr.DoorCost(p, direction.East); got != tt.cost {
+				t.Errorf("DoorCost() = %v, want %v", got, tt.cost)
+			}
+			if tr.Traversable(point.New(0, 1), direction.NorthEast) {
+				t.Errorf("Traversable() diagonally past a door = true, want false")
+			}
+		})
+	}
+}
+
+func TestTerrain_DoorChangedEvent(t *testing.T) {
+	var events []*terrain.DoorChangedEvent
+	tr := terrain.New(2, 1, terrain.WithEmitDoorChangedEvent(func(e *terrain.DoorChangedEvent) { events = append(events, e) }))
+	if err := tr.SetDoor(1, 0, direction.West, terrain.DoorLocked); err != nil {
+		t.Fatalf("SetDoor() error = %v", err)
+	}
+	if err := tr.SetDoor(1, 0, direction.West, terrain.DoorLocked); err != nil {
+		t.Fatalf("SetDoor() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if e := events[0]; e.X != 1 || e.Side != direction.West || e.Old != terrain.NoDoor || e.New != terrain.DoorLocked {
+		t.Errorf("event = %+v", e)
+	}
+}
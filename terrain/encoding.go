@@ -0,0 +1,257 @@
+package terrain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/dwethmar/apostle/direction"
+)
+
+// Binary format of a saved terrain, all integers are big endian:
+//
+//	magic    [4]byte "APTR"
+//	version  uint16
+//	width    uint32
+//	height   uint32
+//	cells    run length encoded cell bytes
+//	material run length encoded material bytes
+//	doors    run length encoded north doors, then west doors (version 2 and up)
+//	walls    run length encoded north walls, then west walls (version 3 and up)
+//	biomes   run length encoded biome bytes (version 4 and up)
+//	checksum uint32 CRC-32 (IEEE) of everything before it
+//
+// A run is a uvarint length followed by the byte that is repeated. From
+// version 3 on cells are saved without Border flags, the walls are saved
+// once per edge instead: width*(height+1) north walls and (width+1)*height
+// west walls, 1 for a wall and 0 for none. Before that every cell carried
+// the Border flags of its own sides.
+const (
+	encodingMagic   = "APTR"
+	encodingVersion = 4
+	headerSize      = len(encodingMagic) + 2 + 4 + 4
+	checksumSize    = 4
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid terrain format")
+	ErrVersion       = errors.New("unsupported terrain version")
+	ErrSize          = errors.New("terrain size mismatch")
+	ErrChecksum      = errors.New("terrain checksum mismatch")
+)
+
+// Save writes the terrain to w in a compact binary format.
+func (t *Terrain) Save(w io.Writer) error {
+	buf := make([]byte, 0, headerSize)
+	buf = append(buf, encodingMagic...)
+	buf = binary.BigEndian.AppendUint16(buf, encodingVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.width))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(t.height))
+
+	cells := make([]byte, len(t.cells))
+	for i, c := range t.cells {
+		cells[i] = byte(c)
+	}
+	buf = appendRuns(buf, cells)
+
+	materials := make([]byte, len(t.materials))
+	for i, m := range t.materials {
+		materials[i] = byte(m)
+	}
+	buf = appendRuns(buf, materials)
+
+	for _, doors := range [][]DoorState{t.northDoors, t.westDoors} {
+		b := make([]byte, len(doors))
+		for i, d := range doors {
+			b[i] = byte(d)
+		}
+		buf = appendRuns(buf, b)
+	}
+
+	for _, walls := range [][]bool{t.northWalls, t.westWalls} {
+		b := make([]byte, len(walls))
+		for i, wall := range walls {
+			if wall {
+				b[i] = 1
+			}
+		}
+		buf = appendRuns(buf, b)
+	}
+
+	biomes := make([]byte, len(t.biomes))
+	for i, b := range t.biomes {
+		biomes[i] = byte(b)
+	}
+	buf = appendRuns(buf, biomes)
+
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	_, err := w.Write(buf)
+	return err
+}
+
+// Load replaces the cells, materials, doors, walls and biomes of the terrain
+// with the ones read from r. The saved terrain must have the same size as t. The cell
+// changes are emitted as a single batch. Terrains saved before doors were
+// added are loaded without doors, the Border flags of terrains saved before
+// walls were stored per edge become walls on the edges and terrains saved
+// before biomes were added are loaded without biomes.
+func (t *Terrain) Load(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read terrain: %w", err)
+	}
+	if len(data) < headerSize+checksumSize || string(data[:len(encodingMagic)]) != encodingMagic {
+		return ErrInvalidFormat
+	}
+
+	body := data[:len(data)-checksumSize]
+	if want, got := binary.BigEndian.Uint32(data[len(body):]), crc32.ChecksumIEEE(body); want != got {
+		return fmt.Errorf("%w: got %08x, want %08x", ErrChecksum, got, want)
+	}
+
+	header := body[len(encodingMagic):headerSize]
+	version := binary.BigEndian.Uint16(header)
+	if version < 1 || version > encodingVersion {
+		return fmt.Errorf("%w: got %d, want at most %d", ErrVersion, version, encodingVersion)
+	}
+	w, h := int(binary.BigEndian.Uint32(header[2:])), int(binary.BigEndian.Uint32(header[6:]))
+	if w != t.width || h != t.height {
+		return fmt.Errorf("%w: got %dx%d, want %dx%d", ErrSize, w, h, t.width, t.height)
+	}
+
+	rd := bytes.NewReader(body[headerSize:])
+	cells, err := readRuns(rd, w*h)
+	if err != nil {
+		return fmt.Errorf("failed to decode cells: %w", err)
+	}
+	materials, err := readRuns(rd, w*h)
+	if err != nil {
+		return fmt.Errorf("failed to decode materials: %w", err)
+	}
+	northDoors, westDoors := make([]byte, w*h), make([]byte, w*h)
+	if version >= 2 {
+		if northDoors, err = readRuns(rd, w*h); err != nil {
+			return fmt.Errorf("failed to decode doors: %w", err)
+		}
+		if westDoors, err = readRuns(rd, w*h); err != nil {
+			return fmt.Errorf("failed to decode doors: %w", err)
+		}
+	}
+	var northWalls, westWalls []bool
+	if version >= 3 {
+		if northWalls, err = readWalls(rd, w*(h+1)); err != nil {
+			return fmt.Errorf("failed to decode walls: %w", err)
+		}
+		if westWalls, err = readWalls(rd, (w+1)*h); err != nil {
+			return fmt.Errorf("failed to decode walls: %w", err)
+		}
+	} else {
+		northWalls, westWalls = legacyWalls(cells, w, h)
+	}
+	biomes := make([]byte, w*h)
+	if version >= 4 {
+		if biomes, err = readRuns(rd, w*h); err != nil {
+			return fmt.Errorf("failed to decode biomes: %w", err)
+		}
+	}
+	if rd.Len() != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidFormat, rd.Len())
+	}
+
+	return t.Batch(func() error {
+		for i := range cells {
+			x, y := i%w, i/w
+			if y > 0 {
+				if err := t.SetDoor(x, y, direction.North, DoorState(northDoors[i])); err != nil {
+					return err
+				}
+			}
+			if x > 0 {
+				if err := t.SetDoor(x, y, direction.West, DoorState(westDoors[i])); err != nil {
+					return err
+				}
+			}
+			if err := t.Fill(x, y, Cell(cells[i])&^Borders); err != nil {
+				return err
+			}
+			if err := t.SetMaterial(x, y, Material(materials[i])); err != nil {
+				return err
+			}
+			if err := t.SetBiome(x, y, Biome(biomes[i])); err != nil {
+				return err
+			}
+		}
+		for i := range cells {
+			x, y := i%w, i/w
+			walls := map[direction.Direction]bool{
+				direction.North: northWalls[y*w+x],
+				direction.West:  westWalls[y*(w+1)+x],
+			}
+			if y == h-1 {
+				walls[direction.South] = northWalls[(y+1)*w+x]
+			}
+			if x == w-1 {
+				walls[direction.East] = westWalls[y*(w+1)+x+1]
+			}
+			for side, wall := range walls {
+				if err := t.SetWall(x, y, side, wall); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// appendRuns appends the run length encoding of data to buf.
+func appendRuns(buf, data []byte) []byte {
+	for i := 0; i < len(data); {
+		j := i + 1
+		for j < len(data) && data[j] == data[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i))
+		buf = append(buf, data[i])
+		i = j
+	}
+	return buf
+}
+
+// readWalls decodes n walls from r.
+func readWalls(r *bytes.Reader, n int) ([]bool, error) {
+	data, err := readRuns(r, n)
+	if err != nil {
+		return nil, err
+	}
+	walls := make([]bool, n)
+	for i, v := range data {
+		if v > 1 {
+			return nil, fmt.Errorf("%w: wall value %d", ErrInvalidFormat, v)
+		}
+		walls[i] = v == 1
+	}
+	return walls, nil
+}
+
+// readRuns decodes runs from r until n bytes are decoded.
+func readRuns(r *bytes.Reader, n int) ([]byte, error) {
+	data := make([]byte, 0, n)
+	for len(data) < n {
+		run, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+		}
+		v, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+		}
+		if run == 0 || run > uint64(n-len(data)) {
+			return nil, fmt.Errorf("%w: run of %d exceeds terrain size", ErrInvalidFormat, run)
+		}
+		data = append(data, bytes.Repeat([]byte{v}, int(run))...)
+	}
+	return data, nil
+}
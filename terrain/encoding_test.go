@@ -0,0 +1,175 @@
+package terrain_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func randomTerrain(t *testing.T, w, h int, seed uint64) *terrain.Terrain {
+	t.Helper()
+	r := rand.New(rand.NewPCG(seed, seed))
+	tr := terrain.New(w, h)
+	for s := range tr.Walk() {
+		// mostly empty cells, so runs are exercised
+		if r.IntN(4) != 0 {
+			continue
+		}
+		if err := tr.Fill(s.X, s.Y, terrain.Cell(r.IntN(256))); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if err := tr.SetMaterial(s.X, s.Y, terrain.Material(r.IntN(int(terrain.DeepWater)+1))); err != nil {
+			t.Fatalf("SetMaterial() error = %v", err)
+		}
+		if err := tr.SetBiome(s.X, s.Y, terrain.Biome(r.IntN(int(terrain.Water)+1))); err != nil {
+			t.Fatalf("SetBiome() error = %v", err)
+		}
+		if s.X > 0 {
+			if err := tr.SetDoor(s.X, s.Y, direction.West, terrain.DoorState(r.IntN(int(terrain.DoorLocked)+1))); err != nil {
+				t.Fatalf("SetDoor() error = %v", err)
+			}
+		}
+	}
+	return tr
+}
+
+func TestTerrain_SaveLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+	}{
+		{name: "empty", w: 0, h: 0},
+		{name: "single cell", w: 1, h: 1},
+		{name: "non square", w: 31, h: 7},
+		{name: "large", w: 200, h: 150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := randomTerrain(t, tt.w, tt.h, 42)
+			var buf bytes.Buffer
+			if err := src.Save(&buf); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			dst := terrain.New(tt.w, tt.h)
+			if err := dst.Load(&buf); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			for s := range src.Walk() {
+				cell, _ := dst.Cell(s.X, s.Y)
+				if cell != s.Cell || dst.Material(s.X, s.Y) != s.Material {
+					t.Fatalf("cell (%d, %d) = %08b %v, want %08b %v", s.X, s.Y, cell, dst.Material(s.X, s.Y), s.Cell, s.Material)
+				}
+				if got := dst.Biome(s.X, s.Y); got != s.Biome {
+					t.Fatalf("biome of (%d, %d) = %v, want %v", s.X, s.Y, got, s.Biome)
+				}
+				if got := dst.Door(s.X, s.Y, direction.West); got != s.DoorWest {
+					t.Fatalf("door west of (%d, %d) = %v, want %v", s.X, s.Y, got, s.DoorWest)
+				}
+			}
+		})
+	}
+
+	t.Run("version 1 without doors", func(t *testing.T) {
+		data := []byte("APTR")
+		data = binary.BigEndian.AppendUint16(data, 1)
+		data = binary.BigEndian.AppendUint32(data, 2)
+		data = binary.BigEndian.AppendUint32(data, 1)
+		data = append(data, 1, byte(terrain.Solid), 1, 0) // cells
+		data = append(data, 2, byte(terrain.Sand))        // materials
+		data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+		dst := terrain.New(2, 1)
+		if err := dst.Load(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !dst.Solid(0, 0) || dst.Material(1, 0) != terrain.Sand {
+			t.Errorf("Load() did not restore the cells of a version 1 terrain")
+		}
+	})
+
+	t.Run("version 2 with borders in the cells", func(t *testing.T) {
+		data := []byte("APTR")
+		data = binary.BigEndian.AppendUint16(data, 2)
+		data = binary.BigEndian.AppendUint32(data, 2)
+		data = binary.BigEndian.AppendUint32(data, 1)
+		data = append(data, 1, byte(terrain.BorderEast), 1, byte(terrain.BorderNorth)) // cells
+		data = append(data, 2, 0)                                                      // materials
+		data = append(data, 2, 0, 2, 0)                                                // doors
+		data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+		dst := terrain.New(2, 1)
+		if err := dst.Load(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		// the border on one side of the edge becomes a wall shared by both cells
+		if !dst.Wall(1, 0, direction.West) || !dst.HasFlag(1, 0, terrain.BorderWest) {
+			t.Errorf("Load() did not migrate the east border of (0, 0) to a wall")
+		}
+		if !dst.Wall(1, 0, direction.North) || dst.Wall(0, 0, direction.North) {
+			t.Errorf("Load() did not migrate the north border of (1, 0) to a wall")
+		}
+		if dst.Traversable(point.New(1, 0), direction.West) {
+			t.Errorf("Traversable() through a migrated wall = true, want false")
+		}
+	})
+
+	t.Run("runs are compressed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := terrain.New(100, 100, terrain.WithFill(terrain.Solid)).Save(&buf); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if buf.Len() > 64 {
+			t.Errorf("Save() wrote %d bytes for a uniform terrain", buf.Len())
+		}
+	})
+}
+
+func TestTerrain_LoadErrors(t *testing.T) {
+	save := func(t *testing.T, tr *terrain.Terrain) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := tr.Save(&buf); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("size mismatch", func(t *testing.T) {
+		data := save(t, terrain.New(4, 4))
+		if err := terrain.New(5, 4).Load(bytes.NewReader(data)); !errors.Is(err, terrain.ErrSize) {
+			t.Errorf("Load() error = %v, want %v", err, terrain.ErrSize)
+		}
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		data := save(t, terrain.New(4, 4))
+		data[5] = 99 // low byte of the version
+		body := data[:len(data)-4]
+		binary.BigEndian.PutUint32(data[len(body):], crc32.ChecksumIEEE(body))
+		if err := terrain.New(4, 4).Load(bytes.NewReader(data)); !errors.Is(err, terrain.ErrVersion) {
+			t.Errorf("Load() error = %v, want %v", err, terrain.ErrVersion)
+		}
+	})
+
+	t.Run("corrupted data", func(t *testing.T) {
+		data := save(t, randomTerrain(t, 8, 8, 1))
+		data[len(data)-6] ^= 0xff
+		if err := terrain.New(8, 8).Load(bytes.NewReader(data)); !errors.Is(err, terrain.ErrChecksum) {
+			t.Errorf("Load() error = %v, want %v", err, terrain.ErrChecksum)
+		}
+	})
+
+	t.Run("not a terrain", func(t *testing.T) {
+		if err := terrain.New(4, 4).Load(bytes.NewReader([]byte("hello world, this is not a map"))); !errors.Is(err, terrain.ErrInvalidFormat) {
+			t.Errorf("Load() error = %v, want %v", err, terrain.ErrInvalidFormat)
+		}
+	})
+}
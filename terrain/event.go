@@ -0,0 +1,23 @@
+package terrain
+
+const (
+	CellChangedEventName  = "CellChanged"
+	CellsChangedEventName = "CellsChanged"
+)
+
+// CellChangedEvent is emitted when a single cell or its material changes.
+type CellChangedEvent struct {
+	X, Y, Z     int
+	Old, New    Cell
+	OldMaterial Material
+	NewMaterial Material
+}
+
+func (e *CellChangedEvent) Event() string { return CellChangedEventName }
+
+// CellsChangedEvent is emitted once at the end of a batch of changes.
+type CellsChangedEvent struct {
+	Changes []CellChangedEvent
+}
+
+func (e *CellsChangedEvent) Event() string { return CellsChangedEventName }
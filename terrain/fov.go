@@ -0,0 +1,254 @@
+package terrain
+
+import (
+	"iter"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+)
+
+// Sight is calculated on a grid with twice the resolution of the terrain, so
+// borders can block sight as thin walls between cells. Cell (x, y) covers the
+// sub cells from (2x, 2y) to (2x+2, 2y+2): the center is at (2x+1, 2y+1),
+// the edges it shares with its neighbors are at even x or y and the corners
+// at even x and y.
+
+// opaque reports whether the sub cell at (sx, sy) blocks sight. The center
+// of a Solid cell is opaque, edges are opaque when they are a border or lie
+// between two Solid cells, and corners when an edge that meets them is
+// opaque or two Solid cells touch diagonally at them.
+func (t *Terrain) opaque(sx, sy int) bool {
+	if sx < 0 || sy < 0 || sx > 2*t.width || sy > 2*t.height {
+		return true
+	}
+	x, y := (sx-1)/2, (sy-1)/2
+	switch {
+	case sx%2 == 1 && sy%2 == 1: // center
+		return t.blocksSight(x, y)
+	case sx%2 == 0 && sy%2 == 1: // edge between (x, y) and (x+1, y)
+		return t.edgeOpaque(sx/2-1, y, direction.East)
+	case sx%2 == 1 && sy%2 == 0: // edge between (x, y) and (x, y+1)
+		return t.edgeOpaque(x, sy/2-1, direction.South)
+	}
+	// corner between (x, y), (x+1, y), (x, y+1) and (x+1, y+1)
+	x, y = sx/2-1, sy/2-1
+	return t.edgeOpaque(x, y, direction.East) || t.edgeOpaque(x, y+1, direction.East) ||
+		t.edgeOpaque(x, y, direction.South) || t.edgeOpaque(x+1, y, direction.South) ||
+		t.diagonalCorner(x, y)
+}
+
+// edgeOpaque reports whether the edge on the East or South side of the cell
+// at (x, y) blocks sight. Edges of a Solid cell are opaque at a corner where
+// Solid cells touch diagonally, so light does not slip through.
+func (t *Terrain) edgeOpaque(x, y int, side direction.Direction) bool {
+	move := moves[side]
+	a, b := t.blocksSight(x, y), t.blocksSight(x+move.dx, y+move.dy)
+	if a && b || t.edgeBlocksSight(x, y, side) {
+		return true
+	}
+	if !a && !b {
+		return false
+	}
+	if side == direction.East {
+		return t.diagonalCorner(x, y-1) || t.diagonalCorner(x, y)
+	}
+	return t.diagonalCorner(x-1, y) || t.diagonalCorner(x, y)
+}
+
+// diagonalCorner reports whether two Solid cells touch diagonally at the
+// corner between (x, y) and (x+1, y+1).
+func (t *Terrain) diagonalCorner(x, y int) bool {
+	return t.blocksSight(x, y) && t.blocksSight(x+1, y+1) ||
+		t.blocksSight(x+1, y) && t.blocksSight(x, y+1)
+}
+
+// blocksSight reports whether the cell at (x, y) is Solid or out of bounds.
+func (t *Terrain) blocksSight(x, y int) bool {
+	cell, ok := t.Cell(x, y)
+	return !ok || cell&Solid != 0
+}
+
+// edgeBlocksSight reports whether the edge on the East or South side of the
+// cell at (x, y) has a wall or a door that is not open.
+func (t *Terrain) edgeBlocksSight(x, y int, side direction.Direction) bool {
+	switch t.Door(x, y, side) {
+	case DoorOpen:
+		return false
+	case DoorClosed, DoorLocked:
+		return true
+	}
+	move := moves[side]
+	return t.Wall(x, y, side) || t.Wall(x+move.dx, y+move.dy, side.Opposite())
+}
+
+// octants transform the coordinates of the first octant to the other seven.
+var octants = [8][4]int{
+	{1, 0, 0, 1}, {0, 1, 1, 0}, {0, -1, 1, 0}, {-1, 0, 0, 1},
+	{-1, 0, 0, -1}, {0, -1, -1, 0}, {0, 1, -1, 0}, {1, 0, 0, -1},
+}
+
+// FieldOfView returns the cells that can be seen from origin within radius
+// cells, including origin itself. Solid cells, borders and doors that are
+// not open block sight; Solid cells themselves can be seen.
+func (t *Terrain) FieldOfView(origin point.P, radius int) iter.Seq[point.P] {
+	return func(yield func(point.P) bool) {
+		if !t.InBounds(origin.X, origin.Y) || radius < 0 {
+			return
+		}
+
+		// lit sub cells in a window around the origin
+		subRadius := 2*radius + 2
+		size := 2*subRadius + 1
+		lit := make([]bool, size*size)
+		ox, oy := 2*origin.X+1, 2*origin.Y+1
+		light := func(sx, sy int) {
+			lit[(sy-oy+subRadius)*size+sx-ox+subRadius] = true
+		}
+		light(ox, oy)
+		for _, o := range octants {
+			t.castLight(ox, oy, subRadius, 1, 1, 0, o, light)
+		}
+		isLit := func(sx, sy int) bool {
+			i, j := sx-ox+subRadius, sy-oy+subRadius
+			return i >= 0 && j >= 0 && i < size && j < size && lit[j*size+i]
+		}
+
+		for y := origin.Y - radius; y <= origin.Y+radius; y++ {
+			for x := origin.X - radius; x <= origin.X+radius; x++ {
+				dx, dy := x-origin.X, y-origin.Y
+				if dx*dx+dy*dy > radius*radius || !t.InBounds(x, y) {
+					continue
+				}
+				if t.visible(x, y, isLit) && !yield(point.New(x, y)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// visible reports whether the cell at (x, y) is seen: its center is lit, or
+// for Solid cells any of the sub cells it covers.
+func (t *Terrain) visible(x, y int, isLit func(sx, sy int) bool) bool {
+	if !t.Solid(x, y) {
+		return isLit(2*x+1, 2*y+1)
+	}
+	for sy := 2 * y; sy <= 2*y+2; sy++ {
+		for sx := 2 * x; sx <= 2*x+2; sx++ {
+			if isLit(sx, sy) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// castLight is recursive shadowcasting over one octant of the sub cell grid,
+// from row onwards between the start and end slopes.
+func (t *Terrain) castLight(ox, oy, radius, row int, start, end float64, o [4]int, light func(sx, sy int)) {
+	if start < end {
+		return
+	}
+	xx, xy, yx, yy := o[0], o[1], o[2], o[3]
+	var newStart float64
+	for j := row; j <= radius; j++ {
+		blocked := false
+		for dx, dy := -j, -j; dx <= 0; dx++ {
+			sx, sy := ox+dx*xx+dy*xy, oy+dx*yx+dy*yy
+			left, right := (float64(dx)-0.5)/(float64(dy)+0.5), (float64(dx)+0.5)/(float64(dy)-0.5)
+			// sub cells that only touch the lit area on its boundary are not lit
+			if start <= right {
+				continue
+			}
+			if end >= left {
+				break
+			}
+			if dx*dx+dy*dy <= radius*radius {
+				light(sx, sy)
+			}
+			switch {
+			case blocked && t.opaque(sx, sy):
+				newStart = right
+			case blocked:
+				blocked = false
+				start = newStart
+			case t.opaque(sx, sy) && j < radius:
+				blocked = true
+				t.castLight(ox, oy, radius, j+1, start, left, o, light)
+				newStart = right
+			}
+		}
+		if blocked {
+			break
+		}
+	}
+}
+
+// LineOfSight reports whether b can be seen from a along the straight line
+// between the centers of both cells. It follows the same rules as
+// FieldOfView and gives the same answer from both ends.
+func (t *Terrain) LineOfSight(a, b point.P) bool {
+	if !t.InBounds(a.X, a.Y) || !t.InBounds(b.X, b.Y) {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	// sub cells of a Solid end point do not block the view of it
+	see := func(sx, sy int) bool {
+		for _, p := range []point.P{a, b} {
+			if t.Solid(p.X, p.Y) && sx >= 2*p.X && sx <= 2*p.X+2 && sy >= 2*p.Y && sy <= 2*p.Y+2 {
+				return true
+			}
+		}
+		return !t.opaque(sx, sy)
+	}
+
+	x0, y0 := 2*a.X+1, 2*a.Y+1
+	x1, y1 := 2*b.X+1, 2*b.Y+1
+	dx, dy := abs(x1-x0), abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	x, y := x0, y0
+	err := dx - dy
+	for n := 1 + dx + dy; n > 0; n-- {
+		if !see(x, y) {
+			return false
+		}
+		switch {
+		case err > 0:
+			x += sx
+			err -= 2 * dy
+		case err < 0:
+			y += sy
+			err += 2 * dx
+		default:
+			// the line passes exactly through a corner, it is only blocked
+			// when the sub cells on both sides of it block sight
+			if !see(x+sx, y) && !see(x, y+sy) {
+				return false
+			}
+			x += sx
+			y += sy
+			err += 2 * (dx - dy)
+			n--
+		}
+	}
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+package terrain_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+)
+
+// sight draws the cells that are seen from origin as x, and the others as
+// they are in the terrain.
+func sight(tr *terrain.Terrain, origin point.P, radius int) string {
+	rows := make([][]byte, tr.Height())
+	for s := range tr.Walk() {
+		ch := byte('.')
+		if s.Cell&terrain.Solid != 0 {
+			ch = '#'
+		}
+		rows[s.Y] = append(rows[s.Y], ch)
+	}
+	for p := range tr.FieldOfView(origin, radius) {
+		rows[p.Y][p.X] = 'x'
+	}
+	var sb strings.Builder
+	for _, r := range rows {
+		sb.WriteString("\n")
+		sb.Write(r)
+	}
+	return sb.String() + "\n"
+}
+
+func TestTerrain_FieldOfView(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      string
+		radius int
+		want   string
+	}{
+		{
+			name: "pillar",
+			m: `
+.........
+.........
+....#....
+.........
+....@....
+`,
+			radius: 10,
+			want: `
+xxxx.xxxx
+xxxx.xxxx
+xxxxxxxxx
+xxxxxxxxx
+xxxxxxxxx
+`,
+		},
+		{
+			name: "border",
+			m: `
+.........
+.........
+^^^^.^^^^
+.........
+..@......
+`,
+			radius: 10,
+			want: `
+.....x...
+....x....
+xxxxxxxxx
+xxxxxxxxx
+xxxxxxxxx
+`,
+		},
+		{
+			name: "room",
+			m: `
+#########
+#.......#
+#...@...#
+#.......#
+#########
+.........
+`,
+			radius: 10,
+			want: `
+xxxxxxxxx
+xxxxxxxxx
+xxxxxxxxx
+xxxxxxxxx
+xxxxxxxxx
+.........
+`,
+		},
+		{
+			name: "diagonal gap",
+			m: `
+@..#
+..#.
+.#..
+#...
+`,
+			radius: 10,
+			want: `
+xxxx
+xxx.
+xx..
+x...
+`,
+		},
+		{
+			name: "radius",
+			m: `
+.........
+.........
+....@....
+.........
+.........
+`,
+			radius: 2,
+			want: `
+....x....
+...xxx...
+..xxxxx..
+...xxx...
+....x....
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, spawns := ascii.MustParse(tt.m)
+			if got := sight(tr, spawns[0].P, tt.radius); got != tt.want {
+				t.Errorf("FieldOfView() =%s\nwant%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerrain_LineOfSight(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+.........
+.........
+^^^^.^^^^
+.........
+....#....
+.......#.
+......#..
+`)
+	tests := []struct {
+		name string
+		a, b point.P
+		want bool
+	}{
+		{name: "same cell", a: point.New(0, 0), b: point.New(0, 0), want: true},
+		{name: "open ground", a: point.New(0, 3), b: point.New(8, 3), want: true},
+		{name: "through the gap", a: point.New(4, 3), b: point.New(4, 0), want: true},
+		{name: "border", a: point.New(0, 3), b: point.New(0, 1), want: false},
+		{name: "behind a pillar", a: point.New(4, 5), b: point.New(4, 3), want: false},
+		{name: "at a pillar", a: point.New(4, 5), b: point.New(4, 4), want: true},
+		{name: "past a pillar", a: point.New(3, 5), b: point.New(3, 3), want: true},
+		{name: "between diagonal walls", a: point.New(6, 5), b: point.New(7, 6), want: false},
+		{name: "out of bounds", a: point.New(0, 0), b: point.New(9, 0), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tr.LineOfSight(tt.a, tt.b); got != tt.want {
+				t.Errorf("LineOfSight(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := tr.LineOfSight(tt.b, tt.a); got != tt.want {
+				t.Errorf("LineOfSight(%v, %v) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("doors", func(t *testing.T) {
+		tr := terrain.New(3, 1)
+		a, b := point.New(0, 0), point.New(2, 0)
+		for _, tc := range []struct {
+			state terrain.DoorState
+			want  bool
+		}{
+			{terrain.DoorOpen, true},
+			{terrain.DoorClosed, false},
+			{terrain.DoorLocked, false},
+		} {
+			if err := tr.SetDoor(1, 0, direction.East, tc.state); err != nil {
+				t.Fatalf("SetDoor() error = %v", err)
+			}
+			if got := tr.LineOfSight(a, b); got != tc.want {
+				t.Errorf("LineOfSight() through %v door = %v, want %v", tc.state, got, tc.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package generate
+
+import (
+	"fmt"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// sides are the edges of a cell that can have a wall.
+var sides = []direction.Direction{direction.North, direction.South, direction.West, direction.East}
+
+// UpdateBorders recalculates the walls on the four edges of the cell at
+// (x, y) after its solidity changed: there is a wall on every edge where the
+// cell meets a neighbor that differs in solidity. Edges on the outside of
+// the terrain get no wall.
+func UpdateBorders(t *terrain.Terrain, x, y int) error {
+	if !t.InBounds(x, y) {
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d)", x, y)
+	}
+	return t.Batch(func() error {
+		for _, side := range sides {
+			dx, dy, _ := side.Delta()
+			nx, ny := x+dx, y+dy
+			wall := t.InBounds(nx, ny) && t.Solid(nx, ny) != t.Solid(x, y)
+			if err := t.SetWall(x, y, side, wall); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// outline puts walls on every edge between a Solid and an open cell of the
+// terrain.
+func outline(t *terrain.Terrain) error {
+	for y := range t.Height() {
+		for x := range t.Width() {
+			if err := UpdateBorders(t, x, y); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Dig clears the Solid cell at (x, y) and updates the borders around it.
+func Dig(t *terrain.Terrain, x, y int) error {
+	cell, ok := t.Cell(x, y)
+	if !ok {
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d)", x, y)
+	}
+	return t.Batch(func() error {
+		if err := t.Fill(x, y, cell&^terrain.Solid); err != nil {
+			return err
+		}
+		return UpdateBorders(t, x, y)
+	})
+}
+
+// Wall makes the cell at (x, y) Solid and updates the borders around it.
+func Wall(t *terrain.Terrain, x, y int) error {
+	cell, ok := t.Cell(x, y)
+	if !ok {
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d)", x, y)
+	}
+	return t.Batch(func() error {
+		if err := t.Fill(x, y, cell|terrain.Solid); err != nil {
+			return err
+		}
+		return UpdateBorders(t, x, y)
+	})
+}
+
+// Border puts a wall on the given edge (North, South, East or West) of the
+// cell at (x, y), which it shares with its neighbor.
+func Border(t *terrain.Terrain, x, y int, edge direction.Direction) error {
+	return t.SetWall(x, y, edge, true)
+}
@@ -0,0 +1,67 @@
+package generate_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+func TestDig(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+S = solid border-south
+N = solid border-north
+E = solid border-east
+a = border-north border-south border-west
+b = border-north border-south
+#SS
+Eab
+#NN
+`)
+	if err := generate.Dig(tr, 0, 1); err != nil {
+		t.Fatalf("Dig() error = %v", err)
+	}
+
+	want, _ := ascii.MustParse(`
+S = solid border-south
+N = solid border-north
+b = border-north border-south
+SSS
+bbb
+NNN
+`)
+	for s := range want.Walk() {
+		if got, _ := tr.Cell(s.X, s.Y); got != s.Cell {
+			t.Errorf("cell (%d, %d) = %08b, want %08b", s.X, s.Y, got, s.Cell)
+		}
+	}
+	if err := generate.Dig(tr, 3, 0); err == nil {
+		t.Errorf("Dig() expected error for out of bounds coordinates")
+	}
+}
+
+func TestWallAndBorder(t *testing.T) {
+	tr, _ := ascii.MustParse(`
+...
+...
+`)
+	if err := generate.Wall(tr, 1, 0); err != nil {
+		t.Fatalf("Wall() error = %v", err)
+	}
+	if err := generate.Border(tr, 0, 1, direction.East); err != nil {
+		t.Fatalf("Border() error = %v", err)
+	}
+
+	want, _ := ascii.MustParse(`
+S = solid border-south border-east border-west
+b = border-north border-west
+>S<
+>b.
+`)
+	for s := range want.Walk() {
+		if got, _ := tr.Cell(s.X, s.Y); got != s.Cell {
+			t.Errorf("cell (%d, %d) = %08b, want %08b", s.X, s.Y, got, s.Cell)
+		}
+	}
+}
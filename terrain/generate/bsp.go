@@ -0,0 +1,176 @@
+package generate
+
+import (
+	"math/rand/v2"
+
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// BSP splits the terrain in two again and again, puts a room in every part
+// and connects the rooms of every two parts that were split with a corridor.
+type BSP struct {
+	MinLeafSize  int              // smallest width and height of a part
+	MinRoomSize  int              // smallest width and height of a room
+	Ground       terrain.Material // ground of the rooms
+	DoorChance   float64          // chance that a room entrance gets a door
+	LockedChance float64          // chance that a door is locked
+}
+
+// DefaultBSP are the parameters of the "bsp" generator.
+var DefaultBSP = BSP{
+	MinLeafSize:  8,
+	MinRoomSize:  3,
+	Ground:       terrain.Stone,
+	DoorChance:   0.5,
+	LockedChance: 0.05,
+}
+
+func (g BSP) Generate(t *terrain.Terrain, r *rand.Rand) (Layout, error) {
+	for y := range t.Height() {
+		for x := range t.Width() {
+			if err := t.Fill(x, y, terrain.Solid); err != nil {
+				return Layout{}, err
+			}
+			if err := t.SetMaterial(x, y, terrain.Stone); err != nil {
+				return Layout{}, err
+			}
+		}
+	}
+
+	var rooms []Rect
+	// the outermost cells stay solid
+	if _, _, err := g.split(t, r, Rect{1, 1, t.Width() - 2, t.Height() - 2}, &rooms); err != nil {
+		return Layout{}, err
+	}
+	if err := outline(t); err != nil {
+		return Layout{}, err
+	}
+	for _, rm := range rooms {
+		if err := doors(t, r, rm.X, rm.Y, rm.W, rm.H, g.DoorChance, g.LockedChance); err != nil {
+			return Layout{}, err
+		}
+	}
+	return Layout{Rooms: rooms, Corridors: corridors(t, rooms)}, nil
+}
+
+// split carves the rooms of the part and returns one of them, so it can be
+// connected to the rooms of the other part it was split from. It returns
+// false if the part is too small for a room.
+func (g BSP) split(t *terrain.Terrain, r *rand.Rand, part Rect, rooms *[]Rect) (Rect, bool, error) {
+	horizontal := part.H > part.W || part.H == part.W && r.IntN(2) == 0
+	size := part.W
+	if horizontal {
+		size = part.H
+	}
+
+	if size < 2*g.MinLeafSize {
+		room, ok := g.room(r, part)
+		if !ok {
+			return Rect{}, false, nil
+		}
+		if err := carve(t, room, g.Ground); err != nil {
+			return Rect{}, false, err
+		}
+		*rooms = append(*rooms, room)
+		return room, true, nil
+	}
+
+	at := g.MinLeafSize + r.IntN(size-2*g.MinLeafSize+1)
+	a, b := part, part
+	if horizontal {
+		a.H, b.Y, b.H = at, part.Y+at, part.H-at
+	} else {
+		a.W, b.X, b.W = at, part.X+at, part.W-at
+	}
+	roomA, okA, err := g.split(t, r, a, rooms)
+	if err != nil {
+		return Rect{}, false, err
+	}
+	roomB, okB, err := g.split(t, r, b, rooms)
+	if err != nil {
+		return Rect{}, false, err
+	}
+	switch {
+	case okA && okB:
+		if err := corridor(t, r, roomA, roomB); err != nil {
+			return Rect{}, false, err
+		}
+		return roomA, true, nil
+	case okA:
+		return roomA, true, nil
+	}
+	return roomB, okB, nil
+}
+
+// room picks a room in the part, leaving a margin of one cell to the parts
+// next to it.
+func (g BSP) room(r *rand.Rand, part Rect) (Rect, bool) {
+	maxW, maxH := part.W-2, part.H-2
+	if maxW < g.MinRoomSize || maxH < g.MinRoomSize {
+		return Rect{}, false
+	}
+	w := g.MinRoomSize + r.IntN(maxW-g.MinRoomSize+1)
+	h := g.MinRoomSize + r.IntN(maxH-g.MinRoomSize+1)
+	x := part.X + 1 + r.IntN(maxW-w+1)
+	y := part.Y + 1 + r.IntN(maxH-h+1)
+	return Rect{x, y, w, h}, true
+}
+
+// carve opens the cells of the room on the given ground.
+func carve(t *terrain.Terrain, room Rect, ground terrain.Material) error {
+	for y := room.Y; y < room.Y+room.H; y++ {
+		for x := room.X; x < room.X+room.W; x++ {
+			if err := t.Fill(x, y, 0); err != nil {
+				return err
+			}
+			if err := t.SetMaterial(x, y, ground); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// corridor connects the centers of two rooms with an L-shaped corridor. Only
+// solid cells are paved with road, so rooms keep their ground.
+func corridor(t *terrain.Terrain, r *rand.Rand, a, b Rect) error {
+	ca, cb := a.Center(), b.Center()
+	ax, ay, bx, by := ca.X, ca.Y, cb.X, cb.Y
+	cx, cy := bx, ay // corner of the L
+	if r.IntN(2) == 0 {
+		cx, cy = ax, by
+	}
+	open := func(x, y int) error {
+		if !t.Solid(x, y) {
+			return nil
+		}
+		if err := t.Fill(x, y, 0); err != nil {
+			return err
+		}
+		return t.SetMaterial(x, y, terrain.Road)
+	}
+	for _, leg := range [][4]int{{ax, ay, cx, cy}, {cx, cy, bx, by}} {
+		x, y := leg[0], leg[1]
+		for {
+			if err := open(x, y); err != nil {
+				return err
+			}
+			if x == leg[2] && y == leg[3] {
+				break
+			}
+			x += sign(leg[2] - x)
+			y += sign(leg[3] - y)
+		}
+	}
+	return nil
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package generate
+
+import (
+	"math/rand/v2"
+
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// Caves grows caves with a cellular automaton: cells start out solid at
+// random and are smoothed by looking at their eight neighbors.
+type Caves struct {
+	WallChance   float64          // chance that a cell starts out solid
+	Steps        int              // number of smoothing steps
+	BirthLimit   int              // an open cell becomes solid with at least this many solid neighbors
+	DeathLimit   int              // a solid cell stays solid with at least this many solid neighbors
+	Ground       terrain.Material // ground of the caves
+	FillIsolated bool             // fill every cave but the largest, so all open cells are connected
+}
+
+// DefaultCaves are the parameters of the "caves" generator.
+var DefaultCaves = Caves{
+	WallChance:   0.45,
+	Steps:        4,
+	BirthLimit:   5,
+	DeathLimit:   4,
+	Ground:       terrain.Soil,
+	FillIsolated: true,
+}
+
+func (g Caves) Generate(t *terrain.Terrain, r *rand.Rand) (Layout, error) {
+	w, h := t.Width(), t.Height()
+	solid := make([]bool, w*h)
+	// cells out of bounds and on the edge of the terrain are solid, so the
+	// caves are closed in
+	solidAt := func(x, y int) bool {
+		return x <= 0 || y <= 0 || x >= w-1 || y >= h-1 || solid[y*w+x]
+	}
+	for i := range solid {
+		solid[i] = r.Float64() < g.WallChance
+	}
+
+	for range g.Steps {
+		next := make([]bool, w*h)
+		for y := range h {
+			for x := range w {
+				n := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						if (dx != 0 || dy != 0) && solidAt(x+dx, y+dy) {
+							n++
+						}
+					}
+				}
+				if solidAt(x, y) {
+					next[y*w+x] = n >= g.DeathLimit
+				} else {
+					next[y*w+x] = n >= g.BirthLimit
+				}
+			}
+		}
+		solid = next
+	}
+	for y := range h {
+		for x := range w {
+			solid[y*w+x] = solidAt(x, y)
+		}
+	}
+
+	if g.FillIsolated {
+		fillIsolated(solid, w, h)
+	}
+
+	for y := range h {
+		for x := range w {
+			cell, ground := terrain.Cell(0), g.Ground
+			if solid[y*w+x] {
+				cell, ground = terrain.Solid, terrain.Stone
+			}
+			if err := t.Fill(x, y, cell); err != nil {
+				return Layout{}, err
+			}
+			if err := t.SetMaterial(x, y, ground); err != nil {
+				return Layout{}, err
+			}
+		}
+	}
+	return Layout{}, outline(t)
+}
+
+// fillIsolated makes every open area of the w by h grid solid except the
+// largest one.
+func fillIsolated(solid []bool, w, h int) {
+	area := make([]int, w*h) // area of every open cell, 0 for solid cells
+	var sizes []int
+	for start := range solid {
+		if solid[start] || area[start] != 0 {
+			continue
+		}
+		id := len(sizes) + 1
+		size := 0
+		area[start] = id
+		for queue := []int{start}; len(queue) > 0; queue = queue[1:] {
+			i := queue[0]
+			size++
+			x, y := i%w, i/w
+			for _, n := range [][2]int{{x, y - 1}, {x, y + 1}, {x - 1, y}, {x + 1, y}} {
+				j := n[1]*w + n[0]
+				if n[0] < 0 || n[1] < 0 || n[0] >= w || n[1] >= h || solid[j] || area[j] != 0 {
+					continue
+				}
+				area[j] = id
+				queue = append(queue, j)
+			}
+		}
+		sizes = append(sizes, size)
+	}
+
+	largest := 0
+	for id, size := range sizes {
+		if largest == 0 || size > sizes[largest-1] {
+			largest = id + 1
+		}
+	}
+	for i, id := range area {
+		if id != 0 && id != largest {
+			solid[i] = true
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package generate
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+)
+
+// Level is what was generated on a single terrain.
+type Level struct {
+	Layout
+	// Prefabs are the prefabs that were stamped into the map, see WithPrefabs.
+	Prefabs []Placement
+	// Spawns are the entities of the prefabs at their cells on the level.
+	Spawns []ascii.Spawn
+	// Pockets are the areas of cells that can be stood on but can not be
+	// reached from the largest area, one slice of cells per pocket.
+	Pockets [][]point.P
+	// Repaired is the number of pockets that were connected, see WithRepair.
+	Repaired int
+}
+
+// Connected reports whether every cell that can be stood on can be reached
+// from every other.
+func (l Level) Connected() bool {
+	return len(l.Pockets) == 0
+}
+
+// Result describes a generated map.
+type Result struct {
+	Seed   uint64  // seed the map was generated from, see WithSeed
+	Levels []Level // one per level, a single terrain has one level
+}
+
+// areas returns the areas of cells that can reach each other, the largest
+// area first and the others in the order they appear in the terrain.
+func areas(t *terrain.Terrain) [][]point.P {
+	index := region.New(t)
+	var areas [][]point.P
+	seen := make(map[int]bool)
+	for step := range t.Walk() {
+		id := index.Region(point.New(step.X, step.Y))
+		if id == region.None || seen[id] {
+			continue
+		}
+		seen[id] = true
+		areas = append(areas, index.Cells(id))
+	}
+	slices.SortStableFunc(areas, func(a, b []point.P) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	return areas
+}
+
+// pockets returns the areas that can not be reached from the largest area.
+func pockets(t *terrain.Terrain) [][]point.P {
+	a := areas(t)
+	if len(a) < 2 {
+		return nil
+	}
+	return a[1:]
+}
+
+// repair connects the pockets of the terrain until every cell that can be
+// stood on can be reached from every other. It returns the number of
+// pockets it connected.
+func repair(t *terrain.Terrain) (int, error) {
+	var repaired int
+	for {
+		a := areas(t)
+		if len(a) < 2 {
+			return repaired, nil
+		}
+		// the smallest pocket is connected to the nearest cell outside it
+		pocket := a[len(a)-1]
+		inPocket := make(map[point.P]bool, len(pocket))
+		for _, p := range pocket {
+			inPocket[p] = true
+		}
+		inside := func(p point.P) bool { return inPocket[p] }
+		target := func(p point.P) bool { return t.Standable(p) }
+		if _, err := connect(t, pocket, inside, target); err != nil {
+			return repaired, fmt.Errorf("failed to connect pocket at %v: %w", pocket[0], err)
+		}
+		repaired++
+	}
+}
+
+// connect opens the shortest way from one of the cells in from to the
+// nearest target cell. The way never passes a cell inside. Solid cells on
+// the way are dug out and paved with road, deep water becomes shallow and
+// the walls and locked doors between the cells of the way are removed. It
+// returns the cells of the way, from the target back to the start.
+func connect(t *terrain.Terrain, from []point.P, inside, target func(point.P) bool) ([]point.P, error) {
+	prev := make(map[point.P]point.P, len(from))
+	queue := make([]point.P, 0, len(from))
+	for _, p := range from {
+		prev[p] = p
+		queue = append(queue, p)
+	}
+
+	var way []point.P
+	for len(queue) > 0 && way == nil {
+		p := queue[0]
+		queue = queue[1:]
+		for _, side := range sides {
+			dx, dy, _ := side.Delta()
+			n := point.New(p.X+dx, p.Y+dy)
+			if _, ok := prev[n]; ok || !t.InBounds(n.X, n.Y) || inside(n) {
+				continue
+			}
+			prev[n] = p
+			if target(n) {
+				c := n
+				for ; prev[c] != c; c = prev[c] {
+					way = append(way, c)
+				}
+				way = append(way, c)
+				break
+			}
+			queue = append(queue, n)
+		}
+	}
+	if way == nil {
+		return nil, errors.New("no way to a target cell")
+	}
+
+	return way, t.Batch(func() error {
+		for _, p := range way {
+			if t.Solid(p.X, p.Y) {
+				if err := Dig(t, p.X, p.Y); err != nil {
+					return err
+				}
+				if err := t.SetMaterial(p.X, p.Y, terrain.Road); err != nil {
+					return err
+				}
+			}
+			if t.Material(p.X, p.Y) == terrain.DeepWater {
+				if err := t.SetMaterial(p.X, p.Y, terrain.ShallowWater); err != nil {
+					return err
+				}
+			}
+		}
+		for k := 1; k < len(way); k++ {
+			if err := open(t, way[k-1], way[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// open removes the wall and a locked door on the edge between two cells
+// that share it.
+func open(t *terrain.Terrain, a, b point.P) error {
+	side := direction.FromDelta(b.X-a.X, b.Y-a.Y, 0)
+	if err := t.SetWall(a.X, a.Y, side, false); err != nil {
+		return err
+	}
+	if t.Door(a.X, a.Y, side) == terrain.DoorLocked {
+		return t.SetDoor(a.X, a.Y, side, terrain.DoorClosed)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package generate
+
+import (
+	"math/rand/v2"
+
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// Field is open ground with boulders and ponds.
+type Field struct {
+	Ground        terrain.Material // ground of the field
+	BoulderChance float64          // chance that a cell is a solid boulder
+	Ponds         int              // number of ponds
+	PondRadius    int              // largest radius of a pond, ponds with a radius of 2 or more are deep in the middle
+}
+
+// DefaultField are the parameters of the "field" generator.
+var DefaultField = Field{
+	Ground:        terrain.Soil,
+	BoulderChance: 0.03,
+	Ponds:         3,
+	PondRadius:    4,
+}
+
+func (g Field) Generate(t *terrain.Terrain, r *rand.Rand) (Layout, error) {
+	w, h := t.Width(), t.Height()
+	for y := range h {
+		for x := range w {
+			cell := terrain.Cell(0)
+			if r.Float64() < g.BoulderChance {
+				cell = terrain.Solid
+			}
+			if err := t.Fill(x, y, cell); err != nil {
+				return Layout{}, err
+			}
+			if err := t.SetMaterial(x, y, g.Ground); err != nil {
+				return Layout{}, err
+			}
+		}
+	}
+
+	if w > 0 && h > 0 && g.PondRadius > 0 {
+		for range g.Ponds {
+			cx, cy, radius := r.IntN(w), r.IntN(h), 1+r.IntN(g.PondRadius)
+			for y := max(cy-radius, 0); y <= min(cy+radius, h-1); y++ {
+				for x := max(cx-radius, 0); x <= min(cx+radius, w-1); x++ {
+					d := (x-cx)*(x-cx) + (y-cy)*(y-cy)
+					if d > radius*radius {
+						continue
+					}
+					water := terrain.ShallowWater
+					if d < (radius-1)*(radius-1) {
+						water = terrain.DeepWater
+					}
+					if err := t.Fill(x, y, 0); err != nil {
+						return Layout{}, err
+					}
+					if err := t.SetMaterial(x, y, water); err != nil {
+						return Layout{}, err
+					}
+				}
+			}
+		}
+	}
+	return Layout{}, outline(t)
+}
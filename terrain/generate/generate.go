@@ -1,328 +1,164 @@
 package generate
 
 import (
-	"math/rand"
-	"time"
+	"fmt"
+	"math/rand/v2"
 
+	"github.com/dwethmar/apostle/point"
 	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/prefab"
 )
 
-// Generate fills the terrain with rooms + connecting corridors and then
-// carves a maze in the remaining solid areas. Uses terrain.Solid to mark
-// walls/solid blocks and t.Fill to carve passages (0).
-func Generate(t *terrain.Terrain) error {
-	rand.Seed(time.Now().UnixNano())
+type settings struct {
+	seed      uint64
+	hasSeed   bool
+	rand      *rand.Rand
+	generator Generator
+	repair    bool
+	prefabs   []*prefab.Prefab
+	prefabN   int
+}
 
-	w := t.Width()
-	h := t.Height()
+type Option func(*settings)
 
-	// safety: if terrain too small just clear it
-	if w < 3 || h < 3 {
-		for y := 0; y < h; y++ {
-			for x := 0; x < w; x++ {
-				if err := t.Fill(x, y, 0); err != nil {
-					return err
-				}
-			}
-		}
-		return nil
+// WithSeed generates from the given seed. The same seed always generates
+// the same terrain.
+func WithSeed(seed uint64) Option {
+	return func(s *settings) {
+		s.seed, s.hasSeed = seed, true
 	}
+}
 
-	// Fill everything with walls
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			if err := t.Fill(x, y, terrain.Solid); err != nil {
-				return err
-			}
-		}
-	}
-
-	// Room placement parameters
-	const (
-		minRoomSize  = 3
-		maxRoomSize  = 9
-		roomAttempts = 200
-		roomMargin   = 1 // keep one tile margin around rooms
-	)
-
-	type room struct{ x, y, rw, rh, cx, cy int }
-	var rooms []room
-
-	// helper to make odd numbers (rooms sizes and positions on odd grid)
-	odd := func(v int) int {
-		if v%2 == 0 {
-			return v - 1
-		}
-		return v
+// WithRand draws the seed from r, so a sequence of generations can be
+// reproduced from the seed of r.
+func WithRand(r *rand.Rand) Option {
+	return func(s *settings) {
+		s.rand = r
 	}
+}
 
-	// try to place rooms
-	for i := 0; i < roomAttempts; i++ {
-		rw := minRoomSize + rand.Intn(maxRoomSize-minRoomSize+1)
-		rh := minRoomSize + rand.Intn(maxRoomSize-minRoomSize+1)
-		// ensure odd sizes for nicer maze connectivity
-		if rw%2 == 0 {
-			rw++
-		}
-		if rh%2 == 0 {
-			rh++
-		}
-		// pick position leaving a margin
-		maxX := w - rw - roomMargin - 1
-		maxY := h - rh - roomMargin - 1
-		if maxX <= roomMargin || maxY <= roomMargin {
-			continue
-		}
-		rx := rand.Intn(maxX-roomMargin) + roomMargin
-		ry := rand.Intn(maxY-roomMargin) + roomMargin
-		// snap to odd coordinates
-		rx = odd(rx)
-		ry = odd(ry)
-		if rx < roomMargin {
-			rx = roomMargin
-		}
-		if ry < roomMargin {
-			ry = roomMargin
-		}
-		// ensure within bounds
-		if rx+rw >= w-roomMargin {
-			rx = w - roomMargin - rw - 1
-			rx = odd(rx)
-		}
-		if ry+rh >= h-roomMargin {
-			ry = h - roomMargin - rh - 1
-			ry = odd(ry)
-		}
-
-		// check overlap (with a 1-cell buffer)
-		overlap := false
-		for yy := ry - 1; yy <= ry+rh; yy++ {
-			for xx := rx - 1; xx <= rx+rw; xx++ {
-				if xx >= 0 && xx < w && yy >= 0 && yy < h {
-					if !t.Solid(xx, yy) {
-						overlap = true
-						break
-					}
-				}
-			}
-			if overlap {
-				break
-			}
-		}
-		if overlap {
-			continue
-		}
-
-		// carve room interior
-		for yy := ry; yy < ry+rh; yy++ {
-			for xx := rx; xx < rx+rw; xx++ {
-				if err := t.Fill(xx, yy, 0); err != nil {
-					return err
-				}
-			}
-		}
-		cx := rx + rw/2
-		cy := ry + rh/2
-		rooms = append(rooms, room{x: rx, y: ry, rw: rw, rh: rh, cx: cx, cy: cy})
+// WithGenerator generates with g instead of DefaultRooms.
+func WithGenerator(g Generator) Option {
+	return func(s *settings) {
+		s.generator = g
 	}
+}
 
-	// connect rooms with simple straight corridors (L-shaped)
-	carveHoriz := func(x1, x2, y int) error {
-		if x1 > x2 {
-			x1, x2 = x2, x1
-		}
-		for x := x1; x <= x2; x++ {
-			if err := t.Fill(x, y, 0); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	carveVert := func(y1, y2, x int) error {
-		if y1 > y2 {
-			y1, y2 = y2, y1
-		}
-		for y := y1; y <= y2; y++ {
-			if err := t.Fill(x, y, 0); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-
-	for i := 1; i < len(rooms); i++ {
-		a := rooms[i-1]
-		b := rooms[i]
-		// random order for L-shape
-		if rand.Intn(2) == 0 {
-			if err := carveHoriz(a.cx, b.cx, a.cy); err != nil {
-				return err
-			}
-			if err := carveVert(a.cy, b.cy, b.cx); err != nil {
-				return err
-			}
-		} else {
-			if err := carveVert(a.cy, b.cy, a.cx); err != nil {
-				return err
-			}
-			if err := carveHoriz(a.cx, b.cx, b.cy); err != nil {
-				return err
-			}
-		}
+// WithRepair connects the pockets that can not be reached from the rest of
+// the map, so every cell that can be stood on can be reached from every
+// other. Solid cells on the way are dug out, deep water becomes shallow and
+// walls and locked doors are removed.
+func WithRepair() Option {
+	return func(s *settings) {
+		s.repair = true
 	}
+}
 
-	// Now carve a maze in the remaining solid areas using recursive backtracker
-	type p struct{ x, y int }
-	// find a starting solid odd cell
-	var start p
-	found := false
-	for yy := 1; yy < h-1 && !found; yy += 2 {
-		for xx := 1; xx < w-1; xx += 2 {
-			if t.Solid(xx, yy) {
-				start = p{xx, yy}
-				found = true
-				break
-			}
-		}
-	}
-	if !found {
-		// nothing left to maze
-		return nil
+// WithPrefabs stamps up to n of the prefabs into every level, see
+// prefab.Builtin. They are placed in free space, in a random orientation,
+// and connected to the corridors of the level.
+func WithPrefabs(n int, prefabs ...*prefab.Prefab) Option {
+	return func(s *settings) {
+		s.prefabN, s.prefabs = n, prefabs
 	}
+}
 
-	// carve start cell
-	if err := t.Fill(start.x, start.y, 0); err != nil {
-		return err
+// configure applies the options. Without a seed a random seed is picked.
+func configure(opts []Option) settings {
+	s := settings{generator: DefaultRooms}
+	for _, opt := range opts {
+		opt(&s)
 	}
-
-	var stack []p
-	stack = append(stack, start)
-
-	dirs := []struct{ dx, dy int }{
-		{0, -2}, {0, 2}, {2, 0}, {-2, 0},
+	switch {
+	case s.hasSeed:
+	case s.rand != nil:
+		s.seed = s.rand.Uint64()
+	default:
+		s.seed = rand.Uint64()
 	}
+	return s
+}
 
-	for len(stack) > 0 {
-		cur := stack[len(stack)-1]
-
-		// gather solid neighbors 2 cells away
-		neighbors := make([]p, 0, 4)
-		for _, d := range dirs {
-			nx := cur.x + d.dx
-			ny := cur.y + d.dy
-			if nx >= 1 && nx < w-1 && ny >= 1 && ny < h-1 && t.Solid(nx, ny) {
-				neighbors = append(neighbors, p{nx, ny})
-			}
-		}
-
-		if len(neighbors) == 0 {
-			// backtrack
-			stack = stack[:len(stack)-1]
-			continue
-		}
-
-		nb := neighbors[rand.Intn(len(neighbors))]
-		mx := (cur.x + nb.x) / 2
-		my := (cur.y + nb.y) / 2
+// NewRand returns the source of randomness that a seed generates from.
+func NewRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed))
+}
 
-		if err := t.Fill(mx, my, 0); err != nil {
+// generate generates a single terrain and reports its connectivity.
+func (s settings) generate(t *terrain.Terrain, r *rand.Rand) (Level, error) {
+	var level Level
+	err := t.Batch(func() error {
+		layout, err := s.generator.Generate(t, r)
+		if err != nil {
 			return err
 		}
-		if err := t.Fill(nb.x, nb.y, 0); err != nil {
+		level.Layout = layout
+		if err := placePrefabs(t, r, &level, s.prefabN, s.prefabs); err != nil {
 			return err
 		}
+		if s.repair {
+			if level.Repaired, err = repair(t); err != nil {
+				return err
+			}
+		}
+		level.Pockets = pockets(t)
+		return nil
+	})
+	return level, err
+}
 
-		stack = append(stack, nb)
+// Generate fills the terrain with the generator, rooms connected by
+// corridors by default, see WithGenerator. All changes are emitted as a
+// single batch. The result holds the seed it generated from, see WithSeed,
+// and a single level.
+func Generate(t *terrain.Terrain, opts ...Option) (Result, error) {
+	s := configure(opts)
+	level, err := s.generate(t, NewRand(s.seed))
+	if err != nil {
+		return Result{Seed: s.seed}, err
 	}
+	return Result{Seed: s.seed, Levels: []Level{level}}, nil
+}
 
-	// Build a snapshot of solidity and then set border flags based on adjacent solids.
-	// This ensures rooms/corridors (non-solid) have border flags where they touch walls,
-	// and wall cells can also carry border flags towards adjacent floors.
-	solid := make([][]bool, h)
-	for y := 0; y < h; y++ {
-		solid[y] = make([]bool, w)
-		for x := 0; x < w; x++ {
-			solid[y][x] = t.Solid(x, y)
-		}
+// GenerateStack generates every level of the stack with the generator and connects each level
+// with the one above it using up to stairsPerLevel stairs. Stairs are only
+// placed where both levels are open. The result holds the seed it generated
+// from, see WithSeed, and a level for every level of the stack.
+func GenerateStack(s *terrain.Stack, stairsPerLevel int, opts ...Option) (Result, error) {
+	settings := configure(opts)
+	result := Result{Seed: settings.seed}
+	r := NewRand(settings.seed)
+	for z := range s.Levels() {
+		level, err := settings.generate(s.Level(z), r)
+		if err != nil {
+			return result, fmt.Errorf("failed to generate level %d: %w", z, err)
+		}
+		result.Levels = append(result.Levels, level)
 	}
-
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			var cell terrain.Cell = 0
-			if solid[y][x] {
-				cell |= terrain.Solid
-			}
-			// mark borders where this cell meets a solid/non-solid neighbor
-			if y-1 >= 0 && solid[y-1][x] != solid[y][x] {
-				cell |= terrain.BorderNorth
-			}
-			if y+1 < h && solid[y+1][x] != solid[y][x] {
-				cell |= terrain.BorderSouth
-			}
-			if x-1 >= 0 && solid[y][x-1] != solid[y][x] {
-				cell |= terrain.BorderWest
-			}
-			if x+1 < w && solid[y][x+1] != solid[y][x] {
-				cell |= terrain.BorderEast
-			}
-			if err := t.Fill(x, y, cell); err != nil {
-				return err
+	for z := 0; z+1 < s.Levels(); z++ {
+		var candidates []point.P
+		for step := range s.Level(z).Walk() {
+			lower := point.New3(step.X, step.Y, z)
+			upper := point.New3(step.X, step.Y, z+1)
+			if !s.Solid(lower) && !s.Solid(upper) {
+				candidates = append(candidates, lower)
 			}
 		}
-	}
+		r.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
 
-	// Add some extra decorative walls / border flags inside open areas.
-	// These are low-probability so they don't destroy maze connectivity.
-	for y := 1; y < h-1; y++ {
-		for x := 1; x < w-1; x++ {
-			// only consider non-solid floor cells
-			if t.Solid(x, y) {
-				continue
+		for _, lower := range candidates[:min(stairsPerLevel, len(candidates))] {
+			upper := point.New3(lower.X, lower.Y, lower.Z+1)
+			below, _ := s.Cell(lower)
+			above, _ := s.Cell(upper)
+			if err := s.Fill(lower, (below|terrain.Stairs)&^terrain.Ceiling); err != nil {
+				return result, err
 			}
-			// small chance to add a decorative border on a floor cell
-			if rand.Float32() < 0.02 {
-				// pick one random border to add
-				var pick terrain.Cell
-				switch rand.Intn(4) {
-				case 0:
-					pick = terrain.BorderNorth
-				case 1:
-					pick = terrain.BorderSouth
-				case 2:
-					pick = terrain.BorderWest
-				default:
-					pick = terrain.BorderEast
-				}
-				// reconstruct current flags and add the pick
-				var cell terrain.Cell = 0
-				if t.Solid(x, y) {
-					cell |= terrain.Solid
-				}
-				if t.HasFlag(x, y, terrain.BorderNorth) {
-					cell |= terrain.BorderNorth
-				}
-				if t.HasFlag(x, y, terrain.BorderSouth) {
-					cell |= terrain.BorderSouth
-				}
-				if t.HasFlag(x, y, terrain.BorderWest) {
-					cell |= terrain.BorderWest
-				}
-				if t.HasFlag(x, y, terrain.BorderEast) {
-					cell |= terrain.BorderEast
-				}
-				cell |= pick
-				if err := t.Fill(x, y, cell); err != nil {
-					return err
-				}
-			}
-			// very small chance to place a thin solid wall (obstacle)
-			if rand.Float32() < 0.005 {
-				if err := t.Fill(x, y, terrain.Solid); err != nil {
-					return err
-				}
+			if err := s.Fill(upper, above&^terrain.Floor); err != nil {
+				return result, err
 			}
 		}
 	}
-
-	return nil
+	return result, nil
 }
@@ -0,0 +1,280 @@
+package generate_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/generate"
+	"github.com/dwethmar/apostle/terrain/prefab"
+)
+
+func save(t *testing.T, tr *terrain.Terrain) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tr.Save(&buf); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate_Seed(t *testing.T) {
+	generated := func(opts ...generate.Option) ([]byte, uint64) {
+		tr := terrain.New(40, 30)
+		res, err := generate.Generate(tr, opts...)
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		return save(t, tr), res.Seed
+	}
+
+	a, seed := generated(generate.WithSeed(7))
+	if seed != 7 {
+		t.Errorf("Generate() seed = %d, want 7", seed)
+	}
+	if b, _ := generated(generate.WithSeed(7)); !bytes.Equal(a, b) {
+		t.Errorf("Generate() with the same seed generated different terrains")
+	}
+	if b, _ := generated(generate.WithSeed(8)); bytes.Equal(a, b) {
+		t.Errorf("Generate() with another seed generated the same terrain")
+	}
+
+	// a random seed and a seed drawn from a source can be generated again
+	for _, opts := range [][]generate.Option{nil, {generate.WithRand(generate.NewRand(3))}} {
+		a, seed := generated(opts...)
+		if b, _ := generated(generate.WithSeed(seed)); !bytes.Equal(a, b) {
+			t.Errorf("Generate() with the returned seed %d generated a different terrain", seed)
+		}
+	}
+}
+
+func TestGenerateStack_Seed(t *testing.T) {
+	generated := func() []byte {
+		s := terrain.NewStack(30, 20, 2)
+		res, err := generate.GenerateStack(s, 3, generate.WithSeed(11))
+		if err != nil {
+			t.Fatalf("GenerateStack() error = %v", err)
+		}
+		if len(res.Levels) != s.Levels() {
+			t.Errorf("GenerateStack() returned %d levels, want %d", len(res.Levels), s.Levels())
+		}
+		var b []byte
+		for z := range s.Levels() {
+			b = append(b, save(t, s.Level(z))...)
+		}
+		return b
+	}
+	if !bytes.Equal(generated(), generated()) {
+		t.Errorf("GenerateStack() with the same seed generated different stacks")
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		name      string
+		connected bool // all open cells can reach each other
+	}{
+		{name: "rooms"},
+		{name: "caves", connected: true},
+		{name: "bsp", connected: true},
+		{name: "field"},
+		{name: "outdoor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := generate.Lookup(tt.name)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			generated := func() *terrain.Terrain {
+				tr := terrain.New(60, 40)
+				if _, err := generate.Generate(tr, generate.WithSeed(3), generate.WithGenerator(g)); err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				return tr
+			}
+			tr := generated()
+			if !bytes.Equal(save(t, tr), save(t, generated())) {
+				t.Errorf("Generate() with the same seed generated different terrains")
+			}
+			if got := region.New(tr).Regions(); got == 0 || tt.connected && got != 1 {
+				t.Errorf("Generate() made %d regions", got)
+			}
+		})
+	}
+
+	if _, err := generate.Lookup("volcano"); !errors.Is(err, generate.ErrUnknownGenerator) {
+		t.Errorf("Lookup() error = %v, want %v", err, generate.ErrUnknownGenerator)
+	}
+}
+
+func TestOutdoor_Biomes(t *testing.T) {
+	tr := terrain.New(80, 60)
+	if _, err := generate.Generate(tr, generate.WithSeed(5), generate.WithGenerator(generate.DefaultOutdoor)); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	found := make(map[terrain.Biome]bool)
+	for s := range tr.Walk() {
+		found[s.Biome] = true
+		switch {
+		case s.Biome == terrain.Rock && s.Cell&terrain.Solid == 0:
+			t.Errorf("rock at (%d, %d) is not solid", s.X, s.Y)
+		case s.Biome == terrain.Water && s.Material != terrain.ShallowWater && s.Material != terrain.DeepWater:
+			t.Errorf("water at (%d, %d) is %v", s.X, s.Y, s.Material)
+		case s.Biome == terrain.NoBiome:
+			t.Errorf("cell (%d, %d) has no biome", s.X, s.Y)
+		}
+	}
+	for _, b := range []terrain.Biome{terrain.Grassland, terrain.Forest, terrain.Rock, terrain.Water} {
+		if !found[b] {
+			t.Errorf("no %v generated", b)
+		}
+	}
+}
+
+func TestGenerate_Layout(t *testing.T) {
+	tests := []struct {
+		name  string
+		rooms bool // whether the generator digs rooms and corridors
+	}{
+		{"rooms", true},
+		{"bsp", true},
+		{"caves", false},
+		{"field", false},
+		{"outdoor", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := generate.Lookup(tt.name)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			tr := terrain.New(60, 40)
+			res, err := generate.Generate(tr, generate.WithSeed(3), generate.WithGenerator(g))
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			level := res.Levels[0]
+			if !tt.rooms {
+				if len(level.Rooms) != 0 || level.Corridors != nil {
+					t.Errorf("Generate() layout has %d rooms and %d corridor cells, want none", len(level.Rooms), len(level.Corridors))
+				}
+				return
+			}
+			if len(level.Rooms) == 0 || len(level.Corridors) == 0 {
+				t.Fatalf("Generate() layout has %d rooms and %d corridor cells", len(level.Rooms), len(level.Corridors))
+			}
+			for _, rm := range level.Rooms {
+				if !tr.InBounds(rm.X, rm.Y) || !tr.InBounds(rm.X+rm.W-1, rm.Y+rm.H-1) {
+					t.Errorf("room %v exceeds the terrain", rm)
+				}
+			}
+			for _, p := range level.Corridors {
+				if tr.Solid(p.X, p.Y) {
+					t.Errorf("corridor cell %v is solid", p)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_Repair(t *testing.T) {
+	for _, name := range generate.Names() {
+		t.Run(name, func(t *testing.T) {
+			g, err := generate.Lookup(name)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			for seed := range uint64(5) {
+				tr := terrain.New(60, 40)
+				res, err := generate.Generate(tr, generate.WithSeed(seed), generate.WithGenerator(g), generate.WithRepair())
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				level := res.Levels[0]
+				if !level.Connected() {
+					t.Errorf("seed %d: Generate() left %d pockets", seed, len(level.Pockets))
+				}
+				if got := region.New(tr).Regions(); got != 1 {
+					t.Errorf("seed %d: Generate() made %d regions, want 1", seed, got)
+				}
+
+				// without repair the pockets are reported instead
+				tr = terrain.New(60, 40)
+				res, err = generate.Generate(tr, generate.WithSeed(seed), generate.WithGenerator(g))
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				if got, want := len(res.Levels[0].Pockets), region.New(tr).Regions()-1; got != want {
+					t.Errorf("seed %d: Generate() reported %d pockets, want %d", seed, got, want)
+				}
+				if got := res.Levels[0].Repaired; got != 0 {
+					t.Errorf("seed %d: Generate() repaired %d pockets without WithRepair", seed, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_Prefabs(t *testing.T) {
+	prefabs, err := prefab.Builtin()
+	if err != nil {
+		t.Fatalf("Builtin() error = %v", err)
+	}
+	for _, name := range []string{"rooms", "bsp", "caves"} {
+		t.Run(name, func(t *testing.T) {
+			g, err := generate.Lookup(name)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			tr := terrain.New(60, 40)
+			res, err := generate.Generate(tr, generate.WithSeed(3), generate.WithGenerator(g), generate.WithPrefabs(3, prefabs...))
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			level := res.Levels[0]
+			if len(level.Prefabs) == 0 {
+				t.Fatalf("Generate() placed no prefabs")
+			}
+			index := region.New(tr)
+			for i, p := range level.Prefabs {
+				for _, rm := range level.Rooms {
+					if p.Overlaps(rm) {
+						t.Errorf("prefab %s at %v overlaps room %v", p.Name, p.Rect, rm)
+					}
+				}
+				for _, q := range level.Prefabs[i+1:] {
+					if p.Overlaps(q.Rect) {
+						t.Errorf("prefab %s at %v overlaps prefab %s at %v", p.Name, p.Rect, q.Name, q.Rect)
+					}
+				}
+				// every prefab is connected to the cells around it
+				outside := make(map[int]bool)
+				for s := range tr.Walk() {
+					if !p.Contains(s.X, s.Y) {
+						outside[index.Region(point.New(s.X, s.Y))] = true
+					}
+				}
+				reached := false
+				for y := p.Y; y < p.Y+p.H; y++ {
+					for x := p.X; x < p.X+p.W; x++ {
+						id := index.Region(point.New(x, y))
+						reached = reached || id != region.None && outside[id]
+					}
+				}
+				if !reached {
+					t.Errorf("prefab %s at %v is not connected", p.Name, p.Rect)
+				}
+			}
+			for _, s := range level.Spawns {
+				if !slices.ContainsFunc(level.Prefabs, func(p generate.Placement) bool { return p.Contains(s.P.X, s.P.Y) }) {
+					t.Errorf("spawn %s at %v is outside the prefabs", s.Name, s.P)
+				}
+			}
+		})
+	}
+}
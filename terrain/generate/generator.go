@@ -0,0 +1,92 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// Generator fills a terrain with a map and returns the layout it built. All
+// randomness must come from r, so the same seed generates the same map.
+type Generator interface {
+	Generate(t *terrain.Terrain, r *rand.Rand) (Layout, error)
+}
+
+// Rect is a rectangle of W by H cells with its top left cell at (X, Y).
+type Rect struct{ X, Y, W, H int }
+
+// Center returns the cell in the middle of the rectangle.
+func (r Rect) Center() point.P {
+	return point.New(r.X+r.W/2, r.Y+r.H/2)
+}
+
+// Contains reports whether the cell at (x, y) is inside the rectangle.
+func (r Rect) Contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H
+}
+
+// Overlaps reports whether the rectangles share a cell.
+func (r Rect) Overlaps(o Rect) bool {
+	return r.X < o.X+o.W && o.X < r.X+r.W && r.Y < o.Y+o.H && o.Y < r.Y+r.H
+}
+
+// Layout is the structure a generator built the map from. Generators that
+// do not dig rooms and corridors, such as caves, fields and outdoor maps,
+// return an empty layout: their open cells are not corridors. The ways dug
+// to prefabs are added to the corridors of any map.
+type Layout struct {
+	Rooms     []Rect    // rooms in the order they were placed
+	Corridors []point.P // open cells outside the rooms
+}
+
+// corridors returns the open cells of the terrain outside the rooms. It is
+// meant for generators that dig the terrain out of solid rock, where every
+// open cell outside a room was dug as a corridor.
+func corridors(t *terrain.Terrain, rooms []Rect) []point.P {
+	var cells []point.P
+	for y := range t.Height() {
+		for x := range t.Width() {
+			if t.Solid(x, y) || slices.ContainsFunc(rooms, func(r Rect) bool { return r.Contains(x, y) }) {
+				continue
+			}
+			cells = append(cells, point.New(x, y))
+		}
+	}
+	return cells
+}
+
+var ErrUnknownGenerator = errors.New("unknown generator")
+
+// registry holds the generators by name, with their default parameters.
+var registry = map[string]Generator{
+	"rooms":   DefaultRooms,
+	"caves":   DefaultCaves,
+	"bsp":     DefaultBSP,
+	"field":   DefaultField,
+	"outdoor": DefaultOutdoor,
+}
+
+// Register makes the generator available under name. A generator that was
+// registered under the same name is replaced.
+func Register(name string, g Generator) {
+	registry[name] = g
+}
+
+// Lookup returns the generator that is registered under name.
+func Lookup(name string) (Generator, error) {
+	g, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, want one of %v", ErrUnknownGenerator, name, Names())
+	}
+	return g, nil
+}
+
+// Names returns the names of the registered generators in sorted order.
+func Names() []string {
+	return slices.Sorted(maps.Keys(registry))
+}
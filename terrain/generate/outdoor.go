@@ -0,0 +1,73 @@
+package generate
+
+import (
+	"math/rand/v2"
+
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/noise"
+)
+
+// Outdoor shapes a surface map from height and moisture noise: low land is
+// water, high land solid rock and the land in between is forest where it is
+// wet and grassland where it is dry. Every cell gets the biome it belongs to.
+type Outdoor struct {
+	Scale          float64 // size in cells of the hills and lakes
+	Octaves        int     // number of layers of noise, more adds finer detail
+	DeepWaterLevel float64 // height below which water is deep
+	WaterLevel     float64 // height below which there is water
+	ShoreLevel     float64 // height below which land is sand
+	RockLevel      float64 // height above which rock outcrops are solid
+	ForestMoisture float64 // moisture above which land is forest
+}
+
+// DefaultOutdoor are the parameters of the "outdoor" generator.
+var DefaultOutdoor = Outdoor{
+	Scale:          16,
+	Octaves:        4,
+	DeepWaterLevel: -0.35,
+	WaterLevel:     -0.2,
+	ShoreLevel:     -0.15,
+	RockLevel:      0.25,
+	ForestMoisture: 0.05,
+}
+
+func (g Outdoor) Generate(t *terrain.Terrain, r *rand.Rand) (Layout, error) {
+	height, moisture := noise.New(r.Uint64()), noise.New(r.Uint64())
+	for y := range t.Height() {
+		for x := range t.Width() {
+			nx, ny := float64(x)/g.Scale, float64(y)/g.Scale
+			cell, material, biome := g.classify(
+				height.Fractal(nx, ny, g.Octaves, 0.5, 2),
+				moisture.Fractal(nx, ny, g.Octaves, 0.5, 2),
+			)
+			if err := t.Fill(x, y, cell); err != nil {
+				return Layout{}, err
+			}
+			if err := t.SetMaterial(x, y, material); err != nil {
+				return Layout{}, err
+			}
+			if err := t.SetBiome(x, y, biome); err != nil {
+				return Layout{}, err
+			}
+		}
+	}
+	return Layout{}, outline(t)
+}
+
+// classify returns the cell, material and biome for the height and moisture
+// of a cell.
+func (g Outdoor) classify(height, moisture float64) (terrain.Cell, terrain.Material, terrain.Biome) {
+	switch {
+	case height < g.DeepWaterLevel:
+		return 0, terrain.DeepWater, terrain.Water
+	case height < g.WaterLevel:
+		return 0, terrain.ShallowWater, terrain.Water
+	case height > g.RockLevel:
+		return terrain.Solid, terrain.Stone, terrain.Rock
+	case moisture > g.ForestMoisture:
+		return 0, terrain.Soil, terrain.Forest
+	case height < g.ShoreLevel:
+		return 0, terrain.Sand, terrain.Grassland
+	}
+	return 0, terrain.Soil, terrain.Grassland
+}
@@ -0,0 +1,111 @@
+package generate
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/prefab"
+)
+
+// placeAttempts is how often a spot is picked for a prefab before it is
+// left out.
+const placeAttempts = 50
+
+// Placement is a prefab that was stamped into the map.
+type Placement struct {
+	Name string
+	Rect
+}
+
+// placePrefabs stamps up to n prefabs, picked at random in a random
+// orientation, into free space of the level and connects their entrances to
+// the nearest corridor. A prefab keeps a margin of one cell to the rooms,
+// to the other prefabs and to the outside of the terrain. Corridor cells
+// that a prefab is stamped onto are no longer corridors.
+func placePrefabs(t *terrain.Terrain, r *rand.Rand, level *Level, n int, prefabs []*prefab.Prefab) error {
+	if len(prefabs) == 0 {
+		return nil
+	}
+	taken := slices.Clone(level.Rooms)
+	for range n {
+		p := prefabs[r.IntN(len(prefabs))].Orientations()[r.IntN(8)]
+		at, ok := free(t, r, p, taken)
+		if !ok {
+			continue
+		}
+		spawns, err := p.Stamp(t, at.X, at.Y)
+		if err != nil {
+			return err
+		}
+		level.Corridors = slices.DeleteFunc(level.Corridors, func(c point.P) bool { return at.Contains(c.X, c.Y) })
+		if err := connectPrefab(t, p, at, level); err != nil {
+			return fmt.Errorf("failed to connect prefab %q at (%d, %d): %w", p.Name, at.X, at.Y, err)
+		}
+		taken = append(taken, at)
+		level.Prefabs = append(level.Prefabs, Placement{Name: p.Name, Rect: at})
+		level.Spawns = append(level.Spawns, spawns...)
+	}
+	return nil
+}
+
+// free picks a spot for the prefab that keeps a margin of one cell to the
+// taken rectangles and to the outside of the terrain.
+func free(t *terrain.Terrain, r *rand.Rand, p *prefab.Prefab, taken []Rect) (Rect, bool) {
+	w, h := p.Width(), p.Height()
+	if w+2 > t.Width() || h+2 > t.Height() {
+		return Rect{}, false
+	}
+	for range placeAttempts {
+		at := Rect{X: 1 + r.IntN(t.Width()-w-1), Y: 1 + r.IntN(t.Height()-h-1), W: w, H: h}
+		margin := Rect{X: at.X - 1, Y: at.Y - 1, W: w + 2, H: h + 2}
+		if !slices.ContainsFunc(taken, margin.Overlaps) {
+			return at, true
+		}
+	}
+	return Rect{}, false
+}
+
+// connectPrefab opens a way from the entrances of the prefab placed at the
+// rectangle to the nearest corridor, or to the nearest open cell if the level
+// has no corridors. A prefab without entrances is connected from any of its
+// open cells.
+func connectPrefab(t *terrain.Terrain, p *prefab.Prefab, at Rect, level *Level) error {
+	var from []point.P
+	for _, e := range p.Entrances() {
+		from = append(from, point.New(at.X+e.X, at.Y+e.Y))
+	}
+	if len(from) == 0 {
+		for s := range p.Terrain.Walk() {
+			if c := point.New(s.X, s.Y); p.Terrain.Standable(c) {
+				from = append(from, point.New(at.X+c.X, at.Y+c.Y))
+			}
+		}
+	}
+	if len(from) == 0 {
+		return nil
+	}
+
+	inside := func(c point.P) bool { return at.Contains(c.X, c.Y) }
+	target := func(c point.P) bool { return t.Standable(c) }
+	if len(level.Corridors) > 0 {
+		corridors := make(map[point.P]bool, len(level.Corridors))
+		for _, c := range level.Corridors {
+			corridors[c] = true
+		}
+		target = func(c point.P) bool { return corridors[c] && t.Standable(c) }
+	}
+	way, err := connect(t, from, inside, target)
+	if err != nil {
+		return err
+	}
+	// the way from the corridor to the prefab is a corridor too
+	for _, c := range way {
+		if !inside(c) && !slices.Contains(level.Corridors, c) {
+			level.Corridors = append(level.Corridors, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package generate
+
+import (
+	"math/rand/v2"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+// Rooms places rooms connected by L-shaped corridors and then carves a
+// maze in the remaining solid areas.
+type Rooms struct {
+	MinRoomSize      int     // smallest width and height of a room
+	MaxRoomSize      int     // largest width and height of a room
+	RoomAttempts     int     // number of times a room is tried to be placed
+	PuddleChance     float64 // chance that a room gets a puddle of shallow water
+	DoorChance       float64 // chance that a room entrance gets a door
+	LockedChance     float64 // chance that a door is locked
+	DecorationChance float64 // chance that an open cell gets a wall on one of its sides
+	ObstacleChance   float64 // chance that an open cell is made solid
+}
+
+// DefaultRooms are the parameters of the "rooms" generator.
+var DefaultRooms = Rooms{
+	MinRoomSize:      3,
+	MaxRoomSize:      9,
+	RoomAttempts:     200,
+	PuddleChance:     0.3,
+	DoorChance:       0.5,
+	LockedChance:     0.05,
+	DecorationChance: 0.02,
+	ObstacleChance:   0.005,
+}
+
+func (g Rooms) Generate(t *terrain.Terrain, r *rand.Rand) (Layout, error) {
+	w := t.Width()
+	h := t.Height()
+
+	// safety: if terrain too small just clear it
+	if w < 3 || h < 3 {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if err := t.Fill(x, y, 0); err != nil {
+					return Layout{}, err
+				}
+			}
+		}
+		return Layout{}, nil
+	}
+
+	// Fill everything with walls on stone ground
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if err := t.Fill(x, y, terrain.Solid); err != nil {
+				return Layout{}, err
+			}
+			if err := t.SetMaterial(x, y, terrain.Stone); err != nil {
+				return Layout{}, err
+			}
+		}
+	}
+
+	// Room placement parameters
+	const roomMargin = 1 // keep one tile margin around rooms
+
+	roomMaterials := []terrain.Material{terrain.Stone, terrain.Stone, terrain.Soil, terrain.Sand}
+
+	var rooms []Rect
+
+	// helper to make odd numbers (rooms sizes and positions on odd grid)
+	odd := func(v int) int {
+		if v%2 == 0 {
+			return v - 1
+		}
+		return v
+	}
+
+	// try to place rooms
+	for i := 0; i < g.RoomAttempts; i++ {
+		rw := g.MinRoomSize + r.IntN(g.MaxRoomSize-g.MinRoomSize+1)
+		rh := g.MinRoomSize + r.IntN(g.MaxRoomSize-g.MinRoomSize+1)
+		// ensure odd sizes for nicer maze connectivity
+		if rw%2 == 0 {
+			rw++
+		}
+		if rh%2 == 0 {
+			rh++
+		}
+		// pick position leaving a margin
+		maxX := w - rw - roomMargin - 1
+		maxY := h - rh - roomMargin - 1
+		if maxX <= roomMargin || maxY <= roomMargin {
+			continue
+		}
+		rx := r.IntN(maxX-roomMargin) + roomMargin
+		ry := r.IntN(maxY-roomMargin) + roomMargin
+		// snap to odd coordinates
+		rx = odd(rx)
+		ry = odd(ry)
+		if rx < roomMargin {
+			rx = roomMargin
+		}
+		if ry < roomMargin {
+			ry = roomMargin
+		}
+		// ensure within bounds
+		if rx+rw >= w-roomMargin {
+			rx = w - roomMargin - rw - 1
+			rx = odd(rx)
+		}
+		if ry+rh >= h-roomMargin {
+			ry = h - roomMargin - rh - 1
+			ry = odd(ry)
+		}
+
+		// check overlap (with a 1-cell buffer)
+		overlap := false
+		for yy := ry - 1; yy <= ry+rh; yy++ {
+			for xx := rx - 1; xx <= rx+rw; xx++ {
+				if xx >= 0 && xx < w && yy >= 0 && yy < h {
+					if !t.Solid(xx, yy) {
+						overlap = true
+						break
+					}
+				}
+			}
+			if overlap {
+				break
+			}
+		}
+		if overlap {
+			continue
+		}
+
+		// carve room interior and pick the ground it is made of
+		ground := roomMaterials[r.IntN(len(roomMaterials))]
+		for yy := ry; yy < ry+rh; yy++ {
+			for xx := rx; xx < rx+rw; xx++ {
+				if err := t.Fill(xx, yy, 0); err != nil {
+					return Layout{}, err
+				}
+				if err := t.SetMaterial(xx, yy, ground); err != nil {
+					return Layout{}, err
+				}
+			}
+		}
+		// some rooms get a puddle of shallow water
+		if r.Float64() < g.PuddleChance {
+			px, py := rx+r.IntN(rw), ry+r.IntN(rh)
+			for yy := max(py-1, ry); yy <= min(py+1, ry+rh-1); yy++ {
+				for xx := max(px-1, rx); xx <= min(px+1, rx+rw-1); xx++ {
+					if err := t.SetMaterial(xx, yy, terrain.ShallowWater); err != nil {
+						return Layout{}, err
+					}
+				}
+			}
+		}
+		rooms = append(rooms, Rect{X: rx, Y: ry, W: rw, H: rh})
+	}
+
+	// connect rooms with simple straight corridors (L-shaped)
+	// corridors are paved with road
+	carveHoriz := func(x1, x2, y int) error {
+		if x1 > x2 {
+			x1, x2 = x2, x1
+		}
+		for x := x1; x <= x2; x++ {
+			if err := t.Fill(x, y, 0); err != nil {
+				return err
+			}
+			if err := t.SetMaterial(x, y, terrain.Road); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	carveVert := func(y1, y2, x int) error {
+		if y1 > y2 {
+			y1, y2 = y2, y1
+		}
+		for y := y1; y <= y2; y++ {
+			if err := t.Fill(x, y, 0); err != nil {
+				return err
+			}
+			if err := t.SetMaterial(x, y, terrain.Road); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 1; i < len(rooms); i++ {
+		a := rooms[i-1].Center()
+		b := rooms[i].Center()
+		// random order for L-shape
+		if r.IntN(2) == 0 {
+			if err := carveHoriz(a.X, b.X, a.Y); err != nil {
+				return Layout{}, err
+			}
+			if err := carveVert(a.Y, b.Y, b.X); err != nil {
+				return Layout{}, err
+			}
+		} else {
+			if err := carveVert(a.Y, b.Y, a.X); err != nil {
+				return Layout{}, err
+			}
+			if err := carveHoriz(a.X, b.X, b.Y); err != nil {
+				return Layout{}, err
+			}
+		}
+	}
+
+	// Now carve a maze in the remaining solid areas using recursive backtracker
+	type p struct{ x, y int }
+	// find a starting solid odd cell
+	var start p
+	found := false
+	for yy := 1; yy < h-1 && !found; yy += 2 {
+		for xx := 1; xx < w-1; xx += 2 {
+			if t.Solid(xx, yy) {
+				start = p{xx, yy}
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		// nothing left to maze
+		return Layout{Rooms: rooms, Corridors: corridors(t, rooms)}, nil
+	}
+
+	// carve start cell
+	if err := t.Fill(start.x, start.y, 0); err != nil {
+		return Layout{}, err
+	}
+
+	var stack []p
+	stack = append(stack, start)
+
+	dirs := []struct{ dx, dy int }{
+		{0, -2}, {0, 2}, {2, 0}, {-2, 0},
+	}
+
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+
+		// gather solid neighbors 2 cells away
+		neighbors := make([]p, 0, 4)
+		for _, d := range dirs {
+			nx := cur.x + d.dx
+			ny := cur.y + d.dy
+			if nx >= 1 && nx < w-1 && ny >= 1 && ny < h-1 && t.Solid(nx, ny) {
+				neighbors = append(neighbors, p{nx, ny})
+			}
+		}
+
+		if len(neighbors) == 0 {
+			// backtrack
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		nb := neighbors[r.IntN(len(neighbors))]
+		mx := (cur.x + nb.x) / 2
+		my := (cur.y + nb.y) / 2
+
+		if err := t.Fill(mx, my, 0); err != nil {
+			return Layout{}, err
+		}
+		if err := t.Fill(nb.x, nb.y, 0); err != nil {
+			return Layout{}, err
+		}
+
+		stack = append(stack, nb)
+	}
+
+	// Put walls where rooms/corridors (non-solid) touch solid cells.
+	if err := outline(t); err != nil {
+		return Layout{}, err
+	}
+
+	// Add some extra decorative walls / border flags inside open areas.
+	// These are low-probability so they don't destroy maze connectivity.
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			// only consider non-solid floor cells
+			if t.Solid(x, y) {
+				continue
+			}
+			// small chance to add a decorative border on a floor cell
+			if r.Float64() < g.DecorationChance {
+				// pick one random side to put a wall on
+				if err := t.SetWall(x, y, sides[r.IntN(len(sides))], true); err != nil {
+					return Layout{}, err
+				}
+			}
+			// very small chance to place a thin solid wall (obstacle)
+			if r.Float64() < g.ObstacleChance {
+				if err := t.Fill(x, y, terrain.Solid); err != nil {
+					return Layout{}, err
+				}
+			}
+		}
+	}
+
+	// Put doors in the entrances of rooms, where a corridor leaves the room.
+	for _, rm := range rooms {
+		if err := doors(t, r, rm.X, rm.Y, rm.W, rm.H, g.DoorChance, g.LockedChance); err != nil {
+			return Layout{}, err
+		}
+	}
+
+	return Layout{Rooms: rooms, Corridors: corridors(t, rooms)}, nil
+}
+
+// doors puts a door in the entrances of the room at (x, y) of w by h cells
+// with the given chance. A door is locked with the chance of locked.
+func doors(t *terrain.Terrain, r *rand.Rand, x, y, w, h int, chance, locked float64) error {
+	for _, e := range entrances(t, x, y, w, h) {
+		if r.Float64() >= chance {
+			continue
+		}
+		state := terrain.DoorClosed
+		if r.Float64() < locked {
+			state = terrain.DoorLocked
+		}
+		if err := t.SetDoor(e.p.X, e.p.Y, e.side, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type entrance struct {
+	p    point.P
+	side direction.Direction
+}
+
+// entrances returns the edges on the outline of the room at (x, y) of w by h
+// cells that lead to an open cell outside of it.
+func entrances(t *terrain.Terrain, x, y, w, h int) []entrance {
+	var found []entrance
+	add := func(cx, cy int, side direction.Direction) {
+		dx, dy, _ := side.Delta()
+		if !t.Solid(cx, cy) && t.InBounds(cx+dx, cy+dy) && !t.Solid(cx+dx, cy+dy) {
+			found = append(found, entrance{p: point.New(cx, cy), side: side})
+		}
+	}
+	for cx := x; cx < x+w; cx++ {
+		add(cx, y, direction.North)
+		add(cx, y+h-1, direction.South)
+	}
+	for cy := y; cy < y+h; cy++ {
+		add(x, cy, direction.West)
+		add(x+w-1, cy, direction.East)
+	}
+	return found
+}
@@ -0,0 +1,55 @@
+package terrain
+
+import "image/color"
+
+// Material is the ground type of a cell. It decides how expensive it is to
+// move onto the cell and whether it can be walked on at all.
+//
+//go:generate go tool stringer -type=Material
+type Material byte
+
+const (
+	Stone Material = iota
+	Soil
+	Sand
+	ShallowWater
+	Road
+	DeepWater
+)
+
+type materialProperties struct {
+	cost     float64 // movement cost multiplier, never below 1 so the A* heuristic stays admissible
+	walkable bool
+	color    color.RGBA
+}
+
+var materials = [...]materialProperties{
+	Stone:        {cost: 1, walkable: true, color: color.RGBA{48, 48, 48, 255}},
+	Soil:         {cost: 1.5, walkable: true, color: color.RGBA{92, 64, 36, 255}},
+	Sand:         {cost: 2, walkable: true, color: color.RGBA{194, 178, 128, 255}},
+	ShallowWater: {cost: 3, walkable: true, color: color.RGBA{64, 128, 192, 255}},
+	Road:         {cost: 1, walkable: true, color: color.RGBA{128, 128, 128, 255}},
+	DeepWater:    {cost: 1, walkable: false, color: color.RGBA{16, 32, 128, 255}},
+}
+
+func (m Material) properties() materialProperties {
+	if int(m) >= len(materials) {
+		return materials[Stone]
+	}
+	return materials[m]
+}
+
+// Cost returns the cost of moving onto a cell of this material relative to stone.
+func (m Material) Cost() float64 {
+	return m.properties().cost
+}
+
+// Walkable reports whether agents can walk on this material.
+func (m Material) Walkable() bool {
+	return m.properties().walkable
+}
+
+// Color returns the color the material is drawn with.
+func (m Material) Color() color.RGBA {
+	return m.properties().color
+}
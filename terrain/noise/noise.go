@@ -0,0 +1,73 @@
+// Package noise generates smooth two dimensional gradient noise, used to
+// shape natural looking terrain such as hills and wet areas.
+package noise
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// gradients are the directions the noise can slope in at a lattice point.
+var gradients = [8][2]float64{
+	{1, 1}, {-1, 1}, {1, -1}, {-1, -1},
+	{1, 0}, {-1, 0}, {0, 1}, {0, -1},
+}
+
+// Noise is Perlin noise: it is 0 at every integer coordinate and changes
+// smoothly in between. The same seed always gives the same noise.
+type Noise struct {
+	perm [512]uint8 // permutation of 0-255, twice so lookups do not wrap
+}
+
+func New(seed uint64) *Noise {
+	n := &Noise{}
+	r := rand.New(rand.NewPCG(seed, seed))
+	for i, v := range r.Perm(256) {
+		n.perm[i] = uint8(v)
+		n.perm[i+256] = uint8(v)
+	}
+	return n
+}
+
+// At returns the noise at (x, y), between -1 and 1.
+func (n *Noise) At(x, y float64) float64 {
+	fx, fy := math.Floor(x), math.Floor(y)
+	xi, yi := int(fx)&255, int(fy)&255
+	x, y = x-fx, y-fy
+
+	grad := func(i, j int, dx, dy float64) float64 {
+		g := gradients[n.perm[int(n.perm[i])+j]&7]
+		return g[0]*dx + g[1]*dy
+	}
+	u, v := fade(x), fade(y)
+	a := lerp(u, grad(xi, yi, x, y), grad(xi+1, yi, x-1, y))
+	b := lerp(u, grad(xi, yi+1, x, y-1), grad(xi+1, yi+1, x-1, y-1))
+	return max(-1, min(1, lerp(v, a, b)))
+}
+
+// Fractal adds octaves of noise, every octave with lacunarity times the
+// frequency and persistence times the amplitude of the one before it, for
+// detail at several scales. The result is between -1 and 1.
+func (n *Noise) Fractal(x, y float64, octaves int, persistence, lacunarity float64) float64 {
+	var sum, total float64
+	amplitude, frequency := 1.0, 1.0
+	for range octaves {
+		sum += amplitude * n.At(x*frequency, y*frequency)
+		total += amplitude
+		amplitude *= persistence
+		frequency *= lacunarity
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// fade eases t so the noise is smooth across lattice cells.
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
@@ -0,0 +1,46 @@
+package noise_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dwethmar/apostle/terrain/noise"
+)
+
+func TestNoise(t *testing.T) {
+	a, b, other := noise.New(1), noise.New(1), noise.New(2)
+	var differs bool
+	for i := range 1000 {
+		x, y := float64(i%37)*0.173-3, float64(i/37)*0.291-4
+		v := a.At(x, y)
+		if v < -1 || v > 1 {
+			t.Fatalf("At(%v, %v) = %v, want between -1 and 1", x, y, v)
+		}
+		if v != b.At(x, y) {
+			t.Fatalf("At(%v, %v) differs for the same seed", x, y)
+		}
+		if v != other.At(x, y) {
+			differs = true
+		}
+		if f := a.Fractal(x, y, 4, 0.5, 2); f < -1 || f > 1 {
+			t.Fatalf("Fractal(%v, %v) = %v, want between -1 and 1", x, y, f)
+		}
+	}
+	if !differs {
+		t.Errorf("At() is the same for different seeds")
+	}
+}
+
+func TestNoise_Smooth(t *testing.T) {
+	n := noise.New(7)
+	for i := range 100 {
+		x, y := float64(i)*0.37, float64(i)*0.11
+		if n.At(math.Floor(x), math.Floor(y)) != 0 {
+			t.Errorf("At() on a lattice point is not 0")
+		}
+		// neighboring samples are close together
+		if d := math.Abs(n.At(x, y) - n.At(x+0.01, y)); d > 0.05 {
+			t.Errorf("At(%v, %v) jumps by %v", x, y, d)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package prefab loads hand-made set pieces, such as storerooms, shrines and
+// orchards, that are stamped into generated maps.
+//
+// A prefab file is a map in the format of package ascii: a patch of terrain
+// and the entities to spawn in it, by the name of their blueprint. The name
+// of the prefab is the name of the file without its extension.
+package prefab
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+)
+
+//go:embed prefabs/*.txt
+var builtin embed.FS
+
+// Prefab is a patch of terrain with the entities that spawn in it.
+type Prefab struct {
+	Name    string
+	Terrain *terrain.Terrain
+	Spawns  []ascii.Spawn // cells of the spawns are relative to the patch
+}
+
+// Parse reads the prefab with the given name from r.
+func Parse(name string, r io.Reader) (*Prefab, error) {
+	t, spawns, err := ascii.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prefab %q: %w", name, err)
+	}
+	if t.Width() == 0 || t.Height() == 0 {
+		return nil, fmt.Errorf("prefab %q is empty", name)
+	}
+	return &Prefab{Name: name, Terrain: t, Spawns: spawns}, nil
+}
+
+// Load parses the files of fsys that match the pattern, see fs.Glob, in
+// the order of their names.
+func Load(fsys fs.FS, pattern string) ([]*Prefab, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	prefabs := make([]*Prefab, 0, len(names))
+	for _, name := range names {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		p, err := Parse(strings.TrimSuffix(path.Base(name), path.Ext(name)), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		prefabs = append(prefabs, p)
+	}
+	return prefabs, nil
+}
+
+// Builtin returns the prefabs that ship with the game.
+func Builtin() ([]*Prefab, error) {
+	return Load(builtin, "prefabs/*.txt")
+}
+
+func (p *Prefab) Width() int {
+	return p.Terrain.Width()
+}
+
+func (p *Prefab) Height() int {
+	return p.Terrain.Height()
+}
+
+// clockwise turns the sides of a cell a quarter turn clockwise.
+var clockwise = map[direction.Direction]direction.Direction{
+	direction.North: direction.East,
+	direction.East:  direction.South,
+	direction.South: direction.West,
+	direction.West:  direction.North,
+}
+
+// mirrored swaps the west and east sides of a cell.
+var mirrored = map[direction.Direction]direction.Direction{
+	direction.North: direction.North,
+	direction.East:  direction.West,
+	direction.South: direction.South,
+	direction.West:  direction.East,
+}
+
+// Rotate returns the prefab turned a quarter turn clockwise.
+func (p *Prefab) Rotate() *Prefab {
+	h := p.Height()
+	return p.transform(h, p.Width(), func(x, y int) (int, int) { return h - 1 - y, x }, clockwise)
+}
+
+// Mirror returns the prefab mirrored from left to right.
+func (p *Prefab) Mirror() *Prefab {
+	w := p.Width()
+	return p.transform(w, p.Height(), func(x, y int) (int, int) { return w - 1 - x, y }, mirrored)
+}
+
+// Orientations returns the eight ways the prefab can be placed: every
+// rotation, mirrored and not.
+func (p *Prefab) Orientations() []*Prefab {
+	orientations := make([]*Prefab, 0, 8)
+	for _, q := range []*Prefab{p, p.Mirror()} {
+		for range 4 {
+			orientations = append(orientations, q)
+			q = q.Rotate()
+		}
+	}
+	return orientations
+}
+
+// transform returns a w by h copy of the prefab where every cell is moved
+// to the cell returned by to and its walls to the sides returned by sides.
+func (p *Prefab) transform(w, h int, to func(x, y int) (int, int), sides map[direction.Direction]direction.Direction) *Prefab {
+	t := terrain.New(w, h)
+	for s := range p.Terrain.Walk() {
+		x, y := to(s.X, s.Y)
+		// the cell is in bounds and every side of it has an edge, so these can not fail
+		_ = t.Fill(x, y, s.Cell&^terrain.Borders)
+		_ = t.SetMaterial(x, y, s.Material)
+		_ = t.SetBiome(x, y, s.Biome)
+		for side, turned := range sides {
+			if p.Terrain.Wall(s.X, s.Y, side) {
+				_ = t.SetWall(x, y, turned, true)
+			}
+		}
+	}
+	spawns := make([]ascii.Spawn, len(p.Spawns))
+	for i, s := range p.Spawns {
+		x, y := to(s.P.X, s.P.Y)
+		spawns[i] = ascii.Spawn{Name: s.Name, P: point.New(x, y)}
+	}
+	return &Prefab{Name: p.Name, Terrain: t, Spawns: spawns}
+}
+
+// Entrances returns the cells on the outer edge of the prefab that can be
+// stood on, relative to the patch.
+func (p *Prefab) Entrances() []point.P {
+	var entrances []point.P
+	for s := range p.Terrain.Walk() {
+		c := point.New(s.X, s.Y)
+		onEdge := s.X == 0 || s.Y == 0 || s.X == p.Width()-1 || s.Y == p.Height()-1
+		if onEdge && p.Terrain.Standable(c) {
+			entrances = append(entrances, c)
+		}
+	}
+	return entrances
+}
+
+// sides are the edges of a cell.
+var sides = []direction.Direction{direction.North, direction.South, direction.West, direction.East}
+
+// Stamp copies the prefab onto t with its top left cell at (x, y) and
+// returns the spawns at their cells on t. The cells keep the biome of t
+// where the prefab has none. Walls inside the prefab are copied, the edges
+// around it get a wall where a Solid cell meets an open one, and doors on
+// the edges of the patch are removed.
+func (p *Prefab) Stamp(t *terrain.Terrain, x, y int) ([]ascii.Spawn, error) {
+	if !t.InBounds(x, y) || !t.InBounds(x+p.Width()-1, y+p.Height()-1) {
+		return nil, fmt.Errorf("prefab %q of %d by %d at (%d, %d) exceeds bounds (%d, %d)", p.Name, p.Width(), p.Height(), x, y, t.Width(), t.Height())
+	}
+	err := t.Batch(func() error {
+		for s := range p.Terrain.Walk() {
+			tx, ty := x+s.X, y+s.Y
+			if err := t.Fill(tx, ty, s.Cell&^terrain.Borders); err != nil {
+				return err
+			}
+			if err := t.SetMaterial(tx, ty, s.Material); err != nil {
+				return err
+			}
+			if s.Biome != terrain.NoBiome {
+				if err := t.SetBiome(tx, ty, s.Biome); err != nil {
+					return err
+				}
+			}
+		}
+		for s := range p.Terrain.Walk() {
+			tx, ty := x+s.X, y+s.Y
+			for _, side := range sides {
+				if t.Door(tx, ty, side) != terrain.NoDoor {
+					if err := t.SetDoor(tx, ty, side, terrain.NoDoor); err != nil {
+						return err
+					}
+				}
+				dx, dy, _ := side.Delta()
+				wall := p.Terrain.Wall(s.X, s.Y, side)
+				if !p.Terrain.InBounds(s.X+dx, s.Y+dy) {
+					// an edge around the patch
+					if !t.InBounds(tx+dx, ty+dy) {
+						continue
+					}
+					wall = t.Solid(tx+dx, ty+dy) != t.Solid(tx, ty)
+				}
+				if err := t.SetWall(tx, ty, side, wall); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	spawns := make([]ascii.Spawn, len(p.Spawns))
+	for i, s := range p.Spawns {
+		spawns[i] = ascii.Spawn{Name: s.Name, P: point.New(x+s.P.X, y+s.P.Y)}
+	}
+	return spawns, nil
+}
@@ -0,0 +1,100 @@
+package prefab_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/prefab"
+)
+
+func mustParse(t *testing.T, s string) *prefab.Prefab {
+	t.Helper()
+	p, err := prefab.Parse("test", strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return p
+}
+
+func print(t *testing.T, p *prefab.Prefab) string {
+	t.Helper()
+	s, err := ascii.String(p.Terrain, p.Spawns)
+	if err != nil {
+		t.Fatalf("String() error = %v", err)
+	}
+	return s
+}
+
+func TestPrefab_Transform(t *testing.T) {
+	p := mustParse(t, `
+##.
+^@:
+`)
+	tests := []struct {
+		name string
+		got  *prefab.Prefab
+		want string
+	}{
+		{name: "rotate", got: p.Rotate(), want: "A = solid border-west\n\n>A\n@#\n:.\n"},
+		{name: "mirror", got: p.Mirror(), want: "A = solid border-south\n\n.#A\n:@^\n"},
+		{name: "rotate four times", got: p.Rotate().Rotate().Rotate().Rotate(), want: print(t, p)},
+		{name: "mirror twice", got: p.Mirror().Mirror(), want: print(t, p)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := print(t, tt.got); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if got := len(p.Orientations()); got != 8 {
+		t.Errorf("Orientations() = %d prefabs, want 8", got)
+	}
+}
+
+func TestPrefab_Stamp(t *testing.T) {
+	p := mustParse(t, `
+#.#
+#a#
+`)
+	tr := terrain.New(5, 4)
+	spawns, err := p.Stamp(tr, 1, 1)
+	if err != nil {
+		t.Fatalf("Stamp() error = %v", err)
+	}
+	if want := []ascii.Spawn{{Name: "apple", P: point.New(2, 2)}}; !slices.Equal(spawns, want) {
+		t.Errorf("Stamp() spawns = %v, want %v", spawns, want)
+	}
+	if !tr.Solid(1, 1) || tr.Solid(2, 1) {
+		t.Errorf("Stamp() did not copy the cells")
+	}
+	// the solid cells of the patch are walled off from the open cells around it
+	if !tr.Wall(1, 1, direction.West) || tr.Wall(2, 1, direction.North) {
+		t.Errorf("Stamp() did not put walls around the patch")
+	}
+
+	if _, err := p.Stamp(tr, 3, 3); err == nil {
+		t.Errorf("Stamp() out of bounds error = nil")
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	prefabs, err := prefab.Builtin()
+	if err != nil {
+		t.Fatalf("Builtin() error = %v", err)
+	}
+	for _, p := range prefabs {
+		if len(p.Entrances()) == 0 {
+			t.Errorf("prefab %q has no entrances", p.Name)
+		}
+	}
+	if len(prefabs) == 0 {
+		t.Errorf("Builtin() returned no prefabs")
+	}
+}
@@ -0,0 +1,173 @@
+// Package spawn populates a generated map from a spawn table: which
+// blueprints to spawn, how many, where and how far apart.
+package spawn
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+)
+
+// Terrain is the part of a terrain that spawning needs. It is satisfied by
+// terrain.Terrain and terrain.Stack.
+type Terrain interface {
+	Walk() iter.Seq[terrain.Step]
+	Standable(p point.P) bool
+	Traversable(p point.P, d direction.Direction) bool
+}
+
+// Area is a part of the layout of a generated level.
+type Area int
+
+const (
+	Rooms     Area = iota + 1 // cells inside the rooms
+	Corridors                 // corridor cells
+	Prefabs                   // cells inside the prefabs
+)
+
+// Entry is a row of a spawn table.
+type Entry struct {
+	Blueprint string // name of the blueprint, such as "human" or "apple"
+	Min, Max  int    // number of entities, drawn between Min and Max
+	// Levels are the levels it spawns on, every level when empty.
+	Levels []int
+	// Biomes are the biomes it spawns in, every biome when empty.
+	Biomes []terrain.Biome
+	// Areas are the parts of the layout it spawns in, anywhere when empty.
+	Areas []Area
+	// MinDistance is the smallest distance in cells to the spawns of the
+	// named blueprints, including its own. Spawns on other levels are never
+	// too close.
+	MinDistance map[string]int
+}
+
+// Table is a spawn table. Its entries are placed in order, so the distances
+// of an entry only take the spawns of the entries before it into account.
+type Table []Entry
+
+var ErrUnsatisfiable = errors.New("spawn constraints can not be met")
+
+// Place picks the cells of the spawns of the table on the map that was
+// generated as result. Spawns only land on cells that can be stood on and
+// that can be reached from the largest area of the map, and never two on
+// the same cell. An entry spawns as many entities as were drawn if the cells
+// allow it, and returns an error wrapping ErrUnsatisfiable if fewer than Min
+// fit. r decides the counts and cells.
+func Place(t Terrain, result generate.Result, table Table, r *rand.Rand) ([]ascii.Spawn, error) {
+	floor := reachable(t)
+	var spawns []ascii.Spawn
+	taken := make(map[point.P]bool)
+	for _, e := range table {
+		if e.Min < 0 || e.Max < e.Min {
+			return spawns, fmt.Errorf("invalid count of %s: %d to %d", e.Blueprint, e.Min, e.Max)
+		}
+		n := e.Min + r.IntN(e.Max-e.Min+1)
+
+		var candidates []point.P
+		for _, s := range floor {
+			p := point.New3(s.X, s.Y, s.Z)
+			if !taken[p] && e.allows(s, result) {
+				candidates = append(candidates, p)
+			}
+		}
+		r.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+
+		placed := 0
+		for _, p := range candidates {
+			if placed == n {
+				break
+			}
+			if slices.ContainsFunc(spawns, func(s ascii.Spawn) bool { return e.tooClose(p, s) }) {
+				continue
+			}
+			spawns = append(spawns, ascii.Spawn{Name: e.Blueprint, P: p})
+			taken[p] = true
+			placed++
+		}
+		if placed < e.Min {
+			return spawns, fmt.Errorf("%w: placed %d of at least %d %s", ErrUnsatisfiable, placed, e.Min, e.Blueprint)
+		}
+	}
+	return spawns, nil
+}
+
+// reachable returns the cells of the largest area of the terrain whose
+// cells can reach each other.
+func reachable(t Terrain) []terrain.Step {
+	index := region.New(t)
+	var (
+		steps = make(map[int][]terrain.Step)
+		main  int
+	)
+	for s := range t.Walk() {
+		id := index.Region(point.New3(s.X, s.Y, s.Z))
+		if id == region.None {
+			continue
+		}
+		steps[id] = append(steps[id], s)
+		if main == region.None || len(steps[id]) > len(steps[main]) {
+			main = id
+		}
+	}
+	return steps[main]
+}
+
+// allows reports whether the entry can spawn on the cell.
+func (e Entry) allows(s terrain.Step, result generate.Result) bool {
+	if len(e.Levels) > 0 && !slices.Contains(e.Levels, s.Z) {
+		return false
+	}
+	if len(e.Biomes) > 0 && !slices.Contains(e.Biomes, s.Biome) {
+		return false
+	}
+	if len(e.Areas) == 0 {
+		return true
+	}
+	if s.Z >= len(result.Levels) {
+		return false
+	}
+	level := result.Levels[s.Z]
+	for _, a := range e.Areas {
+		var in bool
+		switch a {
+		case Rooms:
+			in = slices.ContainsFunc(level.Rooms, func(r generate.Rect) bool { return r.Contains(s.X, s.Y) })
+		case Corridors:
+			in = slices.Contains(level.Corridors, point.New(s.X, s.Y))
+		case Prefabs:
+			in = slices.ContainsFunc(level.Prefabs, func(p generate.Placement) bool { return p.Contains(s.X, s.Y) })
+		}
+		if in {
+			return true
+		}
+	}
+	return false
+}
+
+// tooClose reports whether the entry can not spawn at p because of the
+// spawn s. Distances are counted in moves, diagonal moves included.
+func (e Entry) tooClose(p point.P, s ascii.Spawn) bool {
+	d, ok := e.MinDistance[s.Name]
+	if !ok || p.Z != s.P.Z {
+		return false
+	}
+	return max(abs(p.X-s.P.X), abs(p.Y-s.P.Y)) < d
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
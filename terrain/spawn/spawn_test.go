@@ -0,0 +1,169 @@
+package spawn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dwethmar/apostle/pathfinding/region"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+	"github.com/dwethmar/apostle/terrain/ascii"
+	"github.com/dwethmar/apostle/terrain/generate"
+	"github.com/dwethmar/apostle/terrain/spawn"
+)
+
+func TestPlace(t *testing.T) {
+	// the pocket on the right can not be reached from the larger area
+	tr, _ := ascii.MustParse(`
+##########
+#......#.#
+#......#.#
+#......###
+##########
+`)
+	result := generate.Result{Levels: []generate.Level{{
+		Layout: generate.Layout{Rooms: []generate.Rect{{X: 1, Y: 1, W: 2, H: 3}}},
+	}}}
+
+	tests := []struct {
+		name    string
+		table   spawn.Table
+		want    int // number of spawns
+		wantErr error
+	}{
+		{
+			name:  "counts",
+			table: spawn.Table{{Blueprint: "human", Min: 1, Max: 1}, {Blueprint: "apple", Min: 2, Max: 2}},
+			want:  3,
+		},
+		{
+			name:  "fills the area",
+			table: spawn.Table{{Blueprint: "apple", Min: 18, Max: 18}},
+			want:  18,
+		},
+		{
+			name:    "more than fits",
+			table:   spawn.Table{{Blueprint: "apple", Min: 19, Max: 19}},
+			wantErr: spawn.ErrUnsatisfiable,
+		},
+		{
+			name:  "in a room",
+			table: spawn.Table{{Blueprint: "apple", Min: 6, Max: 6, Areas: []spawn.Area{spawn.Rooms}}},
+			want:  6,
+		},
+		{
+			name:    "not enough room",
+			table:   spawn.Table{{Blueprint: "apple", Min: 7, Max: 7, Areas: []spawn.Area{spawn.Rooms}}},
+			wantErr: spawn.ErrUnsatisfiable,
+		},
+		{
+			name: "apart",
+			table: spawn.Table{
+				{Blueprint: "apple", Min: 2, Max: 2, MinDistance: map[string]int{"apple": 5}},
+			},
+			want: 2,
+		},
+		{
+			name: "too far apart",
+			table: spawn.Table{
+				{Blueprint: "apple", Min: 2, Max: 2, MinDistance: map[string]int{"apple": 6}},
+			},
+			wantErr: spawn.ErrUnsatisfiable,
+		},
+		{
+			name: "away from others",
+			table: spawn.Table{
+				{Blueprint: "human", Min: 1, Max: 1},
+				{Blueprint: "apple", Min: 1, Max: 5, MinDistance: map[string]int{"human": 3}},
+			},
+			want: -1, // depends on where the human is
+		},
+		{
+			name:    "other level",
+			table:   spawn.Table{{Blueprint: "apple", Min: 1, Max: 1, Levels: []int{1}}},
+			wantErr: spawn.ErrUnsatisfiable,
+		},
+		{
+			name:    "other biome",
+			table:   spawn.Table{{Blueprint: "apple", Min: 1, Max: 1, Biomes: []terrain.Biome{terrain.Forest}}},
+			wantErr: spawn.ErrUnsatisfiable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spawns, err := spawn.Place(tr, result, tt.table, generate.NewRand(1))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Place() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.want >= 0 && len(spawns) != tt.want {
+				t.Errorf("Place() = %d spawns, want %d", len(spawns), tt.want)
+			}
+
+			index := region.New(tr)
+			taken := make(map[point.P]bool)
+			for i, s := range spawns {
+				if taken[s.P] {
+					t.Errorf("more than one spawn at %v", s.P)
+				}
+				taken[s.P] = true
+				if !index.Reachable(s.P, point.New(1, 1)) {
+					t.Errorf("%s at %v can not be reached", s.Name, s.P)
+				}
+				for _, e := range tt.table {
+					if e.Blueprint != s.Name {
+						continue
+					}
+					for _, o := range spawns[:i] {
+						d := max(abs(s.P.X-o.P.X), abs(s.P.Y-o.P.Y))
+						if min, ok := e.MinDistance[o.Name]; ok && d < min {
+							t.Errorf("%s at %v is %d from %s at %v, want at least %d", s.Name, s.P, d, o.Name, o.P, min)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPlace_Generated(t *testing.T) {
+	s := terrain.NewStack(40, 30, 2)
+	result, err := generate.GenerateStack(s, 2, generate.WithSeed(9))
+	if err != nil {
+		t.Fatalf("GenerateStack() error = %v", err)
+	}
+	table := spawn.Table{
+		{Blueprint: "human", Min: 1, Max: 1, Levels: []int{0}},
+		{Blueprint: "apple", Min: 5, Max: 10, Areas: []spawn.Area{spawn.Rooms, spawn.Corridors}},
+	}
+	a, err := spawn.Place(s, result, table, generate.NewRand(2))
+	if err != nil {
+		t.Fatalf("Place() error = %v", err)
+	}
+	b, _ := spawn.Place(s, result, table, generate.NewRand(2))
+	if len(a) != len(b) {
+		t.Fatalf("Place() with the same source placed %d and %d spawns", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("Place() with the same source placed %v and %v", a[i], b[i])
+		}
+	}
+	if a[0].P.Z != 0 {
+		t.Errorf("human spawned on level %d, want 0", a[0].P.Z)
+	}
+	for _, sp := range a {
+		if !s.Standable(sp.P) {
+			t.Errorf("%s spawned at %v, which can not be stood on", sp.Name, sp.P)
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,215 @@
+package terrain
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+)
+
+// Stack is a terrain with multiple levels of the same size stacked on top of
+// each other. Level 0 is the lowest level. The Z coordinate of a point
+// selects the level.
+//
+// Moving between levels is only possible through a cell with Stairs: from a
+// Stairs cell one can go Up to the same cell on the level above, and from
+// there Down again. The stairs cell must not have a Ceiling and the cell
+// above must not have a Floor and must not be Solid.
+type Stack struct {
+	width, height int
+	levels        []*Terrain
+}
+
+// NewStack creates a stack of levels, each w by h cells. The options are
+// applied to every level, events emitted by a level carry its Z.
+func NewStack(w, h, levels int, opts ...Option) *Stack {
+	s := &Stack{
+		width:  max(w, 0),
+		height: max(h, 0),
+		levels: make([]*Terrain, max(levels, 1)),
+	}
+	for z := range s.levels {
+		s.levels[z] = New(w, h, append(slices.Clip(opts), atLevel(z))...)
+	}
+	return s
+}
+
+func (s *Stack) Width() int {
+	return s.width
+}
+
+func (s *Stack) Height() int {
+	return s.height
+}
+
+// Levels returns the number of levels in the stack.
+func (s *Stack) Levels() int {
+	return len(s.levels)
+}
+
+// Level returns the terrain of level z, or nil if there is no such level.
+func (s *Stack) Level(z int) *Terrain {
+	if z < 0 || z >= len(s.levels) {
+		return nil
+	}
+	return s.levels[z]
+}
+
+func (s *Stack) InBounds(p point.P) bool {
+	return p.Z >= 0 && p.Z < len(s.levels) && s.levels[p.Z].InBounds(p.X, p.Y)
+}
+
+// Cell returns the cell at p and false if p is out of bounds.
+func (s *Stack) Cell(p point.P) (Cell, bool) {
+	if l := s.Level(p.Z); l != nil {
+		return l.Cell(p.X, p.Y)
+	}
+	return 0, false
+}
+
+func (s *Stack) Fill(p point.P, cell Cell) error {
+	l := s.Level(p.Z)
+	if l == nil {
+		return fmt.Errorf("level %d exceeds bounds: %d levels", p.Z, len(s.levels))
+	}
+	return l.Fill(p.X, p.Y, cell)
+}
+
+// Material returns the material of the cell at p. Cells out of bounds are Stone.
+func (s *Stack) Material(p point.P) Material {
+	if l := s.Level(p.Z); l != nil {
+		return l.Material(p.X, p.Y)
+	}
+	return Stone
+}
+
+func (s *Stack) SetMaterial(p point.P, m Material) error {
+	l := s.Level(p.Z)
+	if l == nil {
+		return fmt.Errorf("level %d exceeds bounds: %d levels", p.Z, len(s.levels))
+	}
+	return l.SetMaterial(p.X, p.Y, m)
+}
+
+// Biome returns the biome of the cell at p. Cells out of bounds have no biome.
+func (s *Stack) Biome(p point.P) Biome {
+	if l := s.Level(p.Z); l != nil {
+		return l.Biome(p.X, p.Y)
+	}
+	return NoBiome
+}
+
+func (s *Stack) SetBiome(p point.P, b Biome) error {
+	l := s.Level(p.Z)
+	if l == nil {
+		return fmt.Errorf("level %d exceeds bounds: %d levels", p.Z, len(s.levels))
+	}
+	return l.SetBiome(p.X, p.Y, b)
+}
+
+// MoveCost returns the cost of moving onto the cell at p, based on its material.
+func (s *Stack) MoveCost(p point.P) float64 {
+	return s.Material(p).Cost()
+}
+
+// Standable reports whether an agent can stand on the cell at p: it is in
+// bounds, not Solid and its material is walkable.
+func (s *Stack) Standable(p point.P) bool {
+	l := s.Level(p.Z)
+	return l != nil && l.Standable(p)
+}
+
+func (s *Stack) Solid(p point.P) bool {
+	return s.HasFlag(p, Solid)
+}
+
+func (s *Stack) HasFlag(p point.P, flag Cell) bool {
+	cell, ok := s.Cell(p)
+	return ok && cell&flag != 0
+}
+
+// Door returns the state of the door on the given side of the cell at p.
+func (s *Stack) Door(p point.P, side direction.Direction) DoorState {
+	if l := s.Level(p.Z); l != nil {
+		return l.Door(p.X, p.Y, side)
+	}
+	return NoDoor
+}
+
+func (s *Stack) SetDoor(p point.P, side direction.Direction, state DoorState) error {
+	l := s.Level(p.Z)
+	if l == nil {
+		return fmt.Errorf("level %d exceeds bounds: %d levels", p.Z, len(s.levels))
+	}
+	return l.SetDoor(p.X, p.Y, side, state)
+}
+
+// OpenDoor opens the closed door on the given side of the cell at p.
+func (s *Stack) OpenDoor(p point.P, side direction.Direction) error {
+	l := s.Level(p.Z)
+	if l == nil {
+		return fmt.Errorf("level %d exceeds bounds: %d levels", p.Z, len(s.levels))
+	}
+	return l.OpenDoor(p, side)
+}
+
+// DoorCost returns the extra cost of moving from p in direction d because of
+// a closed door on the way.
+func (s *Stack) DoorCost(p point.P, d direction.Direction) float64 {
+	if l := s.Level(p.Z); l != nil {
+		return l.DoorCost(p, d)
+	}
+	return 0
+}
+
+// Traversable checks if a point is traversable in a given direction,
+// including Up and Down through stairs.
+func (s *Stack) Traversable(p point.P, d direction.Direction) bool {
+	switch d {
+	case direction.Up:
+		return s.vertical(p, point.New3(p.X, p.Y, p.Z+1))
+	case direction.Down:
+		return s.vertical(point.New3(p.X, p.Y, p.Z-1), p)
+	}
+	l := s.Level(p.Z)
+	if l == nil {
+		return false
+	}
+	return l.Traversable(p, d)
+}
+
+// vertical checks if the stairs at lower connect it with upper. The
+// connection works both ways, so the target must not be Solid either way.
+func (s *Stack) vertical(lower, upper point.P) bool {
+	below, ok := s.Cell(lower)
+	if !ok {
+		return false
+	}
+	above, ok := s.Cell(upper)
+	if !ok {
+		return false
+	}
+	if below&Stairs == 0 || below&Ceiling != 0 || above&Floor != 0 {
+		return false
+	}
+	if !s.Material(lower).Walkable() || !s.Material(upper).Walkable() {
+		return false
+	}
+	return below&Solid == 0 && above&Solid == 0
+}
+
+// Walk walks through every level from the bottom up.
+func (s *Stack) Walk() iter.Seq[Step] {
+	return func(yield func(Step) bool) {
+		for z, l := range s.levels {
+			for step := range l.Walk() {
+				step.Z = z
+				if !yield(step) {
+					return
+				}
+			}
+		}
+	}
+}
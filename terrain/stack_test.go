@@ -0,0 +1,84 @@
+package terrain_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func TestStack_Traversable(t *testing.T) {
+	newStack := func(t *testing.T, lower, upper terrain.Cell) *terrain.Stack {
+		t.Helper()
+		s := terrain.NewStack(3, 3, 2)
+		if err := s.Fill(point.New3(1, 1, 0), lower); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if err := s.Fill(point.New3(1, 1, 1), upper); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name         string
+		lower, upper terrain.Cell
+		wantUp       bool
+		wantDown     bool
+	}{
+		{name: "stairs", lower: terrain.Stairs, wantUp: true, wantDown: true},
+		{name: "no stairs", lower: 0, wantUp: false, wantDown: false},
+		{name: "ceiling above stairs", lower: terrain.Stairs | terrain.Ceiling, wantUp: false, wantDown: false},
+		{name: "floor above stairs", lower: terrain.Stairs, upper: terrain.Floor, wantUp: false, wantDown: false},
+		{name: "solid above stairs", lower: terrain.Stairs, upper: terrain.Solid, wantUp: false, wantDown: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStack(t, tt.lower, tt.upper)
+			if got := s.Traversable(point.New3(1, 1, 0), direction.Up); got != tt.wantUp {
+				t.Errorf("Traversable(Up) = %v, want %v", got, tt.wantUp)
+			}
+			if got := s.Traversable(point.New3(1, 1, 1), direction.Down); got != tt.wantDown {
+				t.Errorf("Traversable(Down) = %v, want %v", got, tt.wantDown)
+			}
+		})
+	}
+
+	t.Run("no level above the top", func(t *testing.T) {
+		s := newStack(t, 0, terrain.Stairs)
+		if s.Traversable(point.New3(1, 1, 1), direction.Up) {
+			t.Errorf("Traversable(Up) from the top level = true, want false")
+		}
+	})
+
+	t.Run("horizontal moves stay on the level", func(t *testing.T) {
+		s := newStack(t, 0, terrain.Solid)
+		if !s.Traversable(point.New3(0, 1, 0), direction.East) {
+			t.Errorf("Traversable(East) on level 0 = false, want true")
+		}
+		if s.Traversable(point.New3(0, 1, 1), direction.East) {
+			t.Errorf("Traversable(East) into solid on level 1 = true, want false")
+		}
+	})
+}
+
+func TestStack_Walk(t *testing.T) {
+	s := terrain.NewStack(2, 2, 3)
+	counts := make(map[int]int)
+	for step := range s.Walk() {
+		counts[step.Z]++
+	}
+	for z := range 3 {
+		if counts[z] != 4 {
+			t.Errorf("Walk() yielded %d cells on level %d, want 4", counts[z], z)
+		}
+	}
+}
+
+func TestTerrain_TraversableVertical(t *testing.T) {
+	tr := terrain.New(2, 2, terrain.WithFill(terrain.Stairs))
+	if tr.Traversable(point.New(0, 0), direction.Up) || tr.Traversable(point.New(0, 0), direction.Down) {
+		t.Errorf("a single terrain should not be traversable up or down")
+	}
+}
@@ -12,11 +12,6 @@ type (
 	Cell byte // 1 byte to store flags for solidity and borders
 )
 
-const (
-	width  = 50
-	height = 50
-)
-
 // Solidity, border and other flags for terrain cells
 const (
 	Solid       Cell = 1 << iota // 00000001
@@ -26,32 +21,223 @@ const (
 	BorderEast                   // 00010000
 	Ceiling                      // 00100000
 	Floor                        // 01000000
-	_                            // 10000000 (unused)
+	Stairs                       // 10000000 stairs or a ramp leading to the level above
 )
 
+// Terrain is a grid of cells with a size that is chosen at runtime.
+// Cells and their materials are stored row by row in slices. Walls are
+// stored on the edges between cells, see Borders.
 type Terrain struct {
-	cells [width][height]Cell
+	width, height int
+	level         int    // level of the terrain in a stack, used in events
+	cells         []Cell // without Border flags
+	materials     []Material
+	biomes        []Biome
+	northWalls    []bool      // wall on the north edge of every cell, and the south edge of the last row
+	westWalls     []bool      // wall on the west edge of every cell, and the east edge of the last column
+	northDoors    []DoorState // door on the north edge of every cell
+	westDoors     []DoorState // door on the west edge of every cell
+
+	emitCellChangedEvent  func(*CellChangedEvent)
+	emitCellsChangedEvent func(*CellsChangedEvent)
+	emitDoorChangedEvent  func(*DoorChangedEvent)
+	batchDepth            int
+	batch                 []CellChangedEvent
+	batchIndex            map[point.P]int // index of a coordinate in batch
+}
+
+type Option func(*Terrain)
+
+// WithEmitCellChangedEvent sets the handler that is called every time a cell
+// changes outside of a batch.
+func WithEmitCellChangedEvent(handler func(*CellChangedEvent)) Option {
+	return func(t *Terrain) {
+		t.emitCellChangedEvent = handler
+	}
+}
+
+// WithEmitCellsChangedEvent sets the handler that is called at the end of a
+// batch with every cell that changed during the batch.
+func WithEmitCellsChangedEvent(handler func(*CellsChangedEvent)) Option {
+	return func(t *Terrain) {
+		t.emitCellsChangedEvent = handler
+	}
+}
+
+// atLevel sets the level of the terrain within a stack.
+func atLevel(z int) Option {
+	return func(t *Terrain) {
+		t.level = z
+	}
+}
+
+// WithFill sets every cell of the terrain to the given cell on creation.
+func WithFill(cell Cell) Option {
+	return func(t *Terrain) {
+		for i := range t.cells {
+			t.cells[i] = cell &^ Borders
+		}
+		for y := range t.height {
+			for x := range t.width {
+				for side, flag := range wallFlags {
+					walls, i, _ := t.wallEdge(x, y, side)
+					walls[i] = cell&flag != 0
+				}
+			}
+		}
+	}
 }
 
-func New() *Terrain {
-	return &Terrain{
-		cells: [width][height]Cell{},
+// New creates a terrain of w by h cells. Negative dimensions are treated as zero.
+func New(w, h int, opts ...Option) *Terrain {
+	w, h = max(w, 0), max(h, 0)
+	t := &Terrain{
+		width:      w,
+		height:     h,
+		cells:      make([]Cell, w*h),
+		materials:  make([]Material, w*h),
+		biomes:     make([]Biome, w*h),
+		northWalls: make([]bool, w*(h+1)),
+		westWalls:  make([]bool, (w+1)*h),
+		northDoors: make([]DoorState, w*h),
+		westDoors:  make([]DoorState, w*h),
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	return t
 }
 
 func (t *Terrain) InBounds(x, y int) bool {
 	// calc if x and y are within the bounds of the terrain
-	return x >= 0 && x < width && y >= 0 && y < height
+	return x >= 0 && x < t.width && y >= 0 && y < t.height
+}
+
+// index returns the position of the cell at (x, y) in the cells slice.
+// The caller is responsible for checking the bounds.
+func (t *Terrain) index(x, y int) int {
+	return y*t.width + x
 }
 
+// Cell returns the cell at (x, y) and false if the coordinates are out of bounds.
+// The Border flags of the cell are set for the walls around it.
+func (t *Terrain) Cell(x, y int) (Cell, bool) {
+	if !t.InBounds(x, y) {
+		return 0, false
+	}
+	return t.cells[t.index(x, y)] | t.borders(x, y), true
+}
+
+// Fill sets the cell at (x, y). Its Border flags put walls on the edges
+// around the cell. Edges the flags do not name keep their walls, as they are
+// shared with the neighbors; use SetWall to remove a wall.
 func (t *Terrain) Fill(x, y int, cell Cell) error {
 	if !t.InBounds(x, y) {
-		return fmt.Errorf("coordinates exceed bounds: (%d, %d) out of (%d, %d)", x, y, width, height)
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d) out of (%d, %d)", x, y, t.width, t.height)
 	}
-	t.cells[y][x] = cell
+	before := t.snapshot(x, y)
+	t.cells[t.index(x, y)] = cell &^ Borders
+	for side, flag := range wallFlags {
+		if cell&flag != 0 {
+			walls, i, _ := t.wallEdge(x, y, side)
+			walls[i] = true
+		}
+	}
+	t.changedAround(x, y, before)
 	return nil
 }
 
+// Material returns the material of the cell at (x, y). Cells out of bounds are Stone.
+func (t *Terrain) Material(x, y int) Material {
+	if !t.InBounds(x, y) {
+		return Stone
+	}
+	return t.materials[t.index(x, y)]
+}
+
+func (t *Terrain) SetMaterial(x, y int, m Material) error {
+	if !t.InBounds(x, y) {
+		return fmt.Errorf("coordinates exceed bounds: (%d, %d) out of (%d, %d)", x, y, t.width, t.height)
+	}
+	i := t.index(x, y)
+	old := t.materials[i]
+	t.materials[i] = m
+	cell, _ := t.Cell(x, y)
+	t.changed(x, y, cell, cell, old, m)
+	return nil
+}
+
+// Batch runs fn and collects all changes it makes into a single
+// CellsChangedEvent that is emitted when fn returns, instead of emitting a
+// CellChangedEvent per change. Batches can be nested; the event is emitted
+// when the outermost batch ends, even if fn returns an error.
+func (t *Terrain) Batch(fn func() error) error {
+	if t.batchDepth == 0 {
+		t.batch = nil
+		t.batchIndex = make(map[point.P]int)
+	}
+	t.batchDepth++
+	defer func() {
+		t.batchDepth--
+		if t.batchDepth > 0 {
+			return
+		}
+		changes := make([]CellChangedEvent, 0, len(t.batch))
+		for _, c := range t.batch {
+			// cells that were changed back to their original value did not change
+			if c.Old != c.New || c.OldMaterial != c.NewMaterial {
+				changes = append(changes, c)
+			}
+		}
+		t.batch, t.batchIndex = nil, nil
+		if len(changes) > 0 && t.emitCellsChangedEvent != nil {
+			t.emitCellsChangedEvent(&CellsChangedEvent{Changes: changes})
+		}
+	}()
+	return fn()
+}
+
+// changed records or emits a change of the cell at (x, y).
+func (t *Terrain) changed(x, y int, oldCell, newCell Cell, oldMaterial, newMaterial Material) {
+	if oldCell == newCell && oldMaterial == newMaterial {
+		return
+	}
+	if t.batchDepth > 0 {
+		k := point.New(x, y)
+		if i, ok := t.batchIndex[k]; ok {
+			t.batch[i].New = newCell
+			t.batch[i].NewMaterial = newMaterial
+			return
+		}
+		t.batchIndex[k] = len(t.batch)
+		t.batch = append(t.batch, CellChangedEvent{
+			X: x, Y: y, Z: t.level,
+			Old: oldCell, New: newCell,
+			OldMaterial: oldMaterial, NewMaterial: newMaterial,
+		})
+		return
+	}
+	if t.emitCellChangedEvent != nil {
+		t.emitCellChangedEvent(&CellChangedEvent{
+			X: x, Y: y, Z: t.level,
+			Old: oldCell, New: newCell,
+			OldMaterial: oldMaterial, NewMaterial: newMaterial,
+		})
+	}
+}
+
+// MoveCost returns the cost of moving onto the cell at p, based on its material.
+func (t *Terrain) MoveCost(p point.P) float64 {
+	return t.Material(p.X, p.Y).Cost()
+}
+
+// Standable reports whether an agent can stand on the cell at p: it is in
+// bounds, not Solid and its material is walkable.
+func (t *Terrain) Standable(p point.P) bool {
+	cell, ok := t.Cell(p.X, p.Y)
+	return ok && cell&Solid == 0 && t.Material(p.X, p.Y).Walkable()
+}
+
 func (t *Terrain) Solid(x, y int) bool {
 	if !t.InBounds(x, y) {
 		return false
@@ -60,7 +246,8 @@ func (t *Terrain) Solid(x, y int) bool {
 }
 
 func (t *Terrain) HasFlag(x, y int, flag Cell) bool {
-	return t.InBounds(x, y) && (t.cells[y][x]&flag != 0)
+	cell, ok := t.Cell(x, y)
+	return ok && cell&flag != 0
 }
 
 func (t *Terrain) HasCeiling(x, y int) bool {
@@ -73,14 +260,20 @@ func (t *Terrain) HasFloor(x, y int) bool {
 
 var borderFlags = []Cell{BorderNorth, BorderSouth, BorderEast, BorderWest}
 
+// Walls returns the Border flags of the walls around the cell at (x, y).
 func (t *Terrain) Walls(x, y int) []Cell {
-	if !t.InBounds(x, y) {
+	cell, ok := t.Cell(x, y)
+	if !ok {
 		return nil
 	}
-	cell := t.cells[y][x]
+	return cell.Walls()
+}
+
+// Walls returns the border flags that are set on the cell.
+func (c Cell) Walls() []Cell {
 	borders := make([]Cell, 0, 4)
 	for _, flag := range borderFlags {
-		if cell&flag != 0 {
+		if c&flag != 0 {
 			borders = append(borders, flag)
 		}
 	}
@@ -88,59 +281,111 @@ func (t *Terrain) Walls(x, y int) []Cell {
 }
 
 func (t *Terrain) Width() int {
-	return width
+	return t.width
 }
 
 func (t *Terrain) Height() int {
-	return height
+	return t.height
 }
 
 type moveInfo struct {
-	dx, dy                      int
-	currentBorder, targetBorder Cell
+	dx, dy int
 }
 
 var moves = map[direction.Direction]moveInfo{
-	direction.North:     {0, -1, BorderNorth, BorderSouth},
-	direction.South:     {0, 1, BorderSouth, BorderNorth},
-	direction.East:      {1, 0, BorderEast, BorderWest},
-	direction.West:      {-1, 0, BorderWest, BorderEast},
-	direction.NorthEast: {1, -1, BorderNorth, BorderSouth},
-	direction.NorthWest: {-1, -1, BorderNorth, BorderSouth},
-	direction.SouthEast: {1, 1, BorderSouth, BorderNorth},
-	direction.SouthWest: {-1, 1, BorderSouth, BorderNorth},
+	direction.North:     {0, -1},
+	direction.South:     {0, 1},
+	direction.East:      {1, 0},
+	direction.West:      {-1, 0},
+	direction.NorthEast: {1, -1},
+	direction.NorthWest: {-1, -1},
+	direction.SouthEast: {1, 1},
+	direction.SouthWest: {-1, 1},
 }
 
 // Traversable checks if a point is traversable in a given direction.
+// A single terrain has no other levels, so Up and Down are never traversable.
+// Cells with a material that is not walkable can not be entered. A locked
+// door blocks the edge it is on, an open or closed door lets agents through
+// even if the edge has borders. Diagonal moves past a door are not allowed.
 func (t *Terrain) Traversable(p point.P, d direction.Direction) bool {
 	move := moves[d]
-	newX, newY := p.X+move.dx, p.Y+move.dy
-
-	if !t.InBounds(newX, newY) {
+	switch t.Door(p.X, p.Y, d) {
+	case DoorLocked:
+		return false
+	case DoorOpen, DoorClosed:
+		target, ok := t.Cell(p.X+move.dx, p.Y+move.dy)
+		return ok && target&Solid == 0 && t.Material(p.X+move.dx, p.Y+move.dy).Walkable()
+	}
+	if d.Diagonal() && t.doorAtCorner(p, d) {
+		return false
+	}
+	if !traversable(t.Cell, t.Wall, p, d) {
 		return false
 	}
+	return t.Material(p.X+move.dx, p.Y+move.dy).Walkable()
+}
 
-	if t.cells[p.Y][p.X]&move.currentBorder != 0 {
+// traversable implements the movement rules shared by all terrain backends.
+// cellAt returns the cell at the given coordinates and false when they are
+// out of bounds, wall reports whether there is a wall on a side of a cell.
+//
+// A diagonal move passes the corner between the cell and the target. It is
+// only possible when none of the four walls that meet at the corner is
+// there and both cells next to the corner are not Solid, so agents do not
+// cut corners.
+func traversable(cellAt func(x, y int) (Cell, bool), wall func(x, y int, side direction.Direction) bool, p point.P, d direction.Direction) bool {
+	move, ok := moves[d]
+	if !ok {
+		return false
+	}
+	if _, ok := cellAt(p.X, p.Y); !ok {
 		return false
 	}
-	if t.cells[newY][newX]&move.targetBorder != 0 {
+	target, ok := cellAt(p.X+move.dx, p.Y+move.dy)
+	if !ok || target&Solid != 0 {
 		return false
 	}
+	if !d.Diagonal() {
+		return !wall(p.X, p.Y, d)
+	}
 
-	return t.cells[newY][newX]&Solid == 0
+	vertical, horizontal := d.Split()
+	tx, ty := p.X+move.dx, p.Y+move.dy
+	if wall(p.X, p.Y, vertical) || wall(p.X, p.Y, horizontal) ||
+		wall(tx, ty, vertical.Opposite()) || wall(tx, ty, horizontal.Opposite()) {
+		return false
+	}
+	for _, side := range []direction.Direction{vertical, horizontal} {
+		m := moves[side]
+		if c, ok := cellAt(p.X+m.dx, p.Y+m.dy); !ok || c&Solid != 0 {
+			return false
+		}
+	}
+	return true
 }
 
 // Step represents a position and the cell at that position during a walk through the terrain.
 type Step struct {
-	X, Y int
-	Cell Cell
+	X, Y, Z   int
+	Cell      Cell
+	Material  Material
+	Biome     Biome
+	DoorNorth DoorState // door on the north edge of the cell
+	DoorWest  DoorState // door on the west edge of the cell
 }
 
 func (t *Terrain) Walk() iter.Seq[Step] {
 	return func(yield func(Step) bool) {
-		for y := range height {
-			for x := range width {
-				if !yield(Step{X: x, Y: y, Cell: t.cells[y][x]}) {
+		for y := range t.height {
+			for x := range t.width {
+				i := t.index(x, y)
+				step := Step{
+					X: x, Y: y,
+					Cell: t.cells[i] | t.borders(x, y), Material: t.materials[i], Biome: t.biomes[i],
+					DoorNorth: t.northDoors[i], DoorWest: t.westDoors[i],
+				}
+				if !yield(step) {
 					return
 				}
 			}
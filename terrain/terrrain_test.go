@@ -1 +1,236 @@
 package terrain_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name          string
+		w, h          int
+		wantW, wantH  int
+		wantCellCount int
+	}{
+		{name: "square", w: 50, h: 50, wantW: 50, wantH: 50, wantCellCount: 2500},
+		{name: "wide", w: 7, h: 2, wantW: 7, wantH: 2, wantCellCount: 14},
+		{name: "single cell", w: 1, h: 1, wantW: 1, wantH: 1, wantCellCount: 1},
+		{name: "negative", w: -3, h: 4, wantW: 0, wantH: 4, wantCellCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := terrain.New(tt.w, tt.h)
+			if tr.Width() != tt.wantW || tr.Height() != tt.wantH {
+				t.Errorf("New() size = %dx%d, want %dx%d", tr.Width(), tr.Height(), tt.wantW, tt.wantH)
+			}
+			var count int
+			for range tr.Walk() {
+				count++
+			}
+			if count != tt.wantCellCount {
+				t.Errorf("Walk() yielded %d cells, want %d", count, tt.wantCellCount)
+			}
+		})
+	}
+}
+
+func TestWithFill(t *testing.T) {
+	tr := terrain.New(3, 2, terrain.WithFill(terrain.Solid))
+	for s := range tr.Walk() {
+		if s.Cell != terrain.Solid {
+			t.Errorf("cell (%d, %d) = %08b, want %08b", s.X, s.Y, s.Cell, terrain.Solid)
+		}
+	}
+}
+
+func TestTerrain_InBounds(t *testing.T) {
+	tr := terrain.New(4, 2)
+	tests := []struct {
+		name string
+		x, y int
+		want bool
+	}{
+		{name: "origin", x: 0, y: 0, want: true},
+		{name: "last cell", x: 3, y: 1, want: true},
+		{name: "past width", x: 4, y: 0, want: false},
+		{name: "past height", x: 0, y: 2, want: false},
+		{name: "negative", x: -1, y: 0, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tr.InBounds(tt.x, tt.y); got != tt.want {
+				t.Errorf("InBounds(%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerrain_Fill(t *testing.T) {
+	t.Run("fill within bounds on a non square terrain", func(t *testing.T) {
+		tr := terrain.New(5, 2)
+		if err := tr.Fill(4, 1, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if !tr.Solid(4, 1) {
+			t.Errorf("Solid(4, 1) = false, want true")
+		}
+		if tr.Solid(1, 4) {
+			t.Errorf("Solid(1, 4) = true, want false")
+		}
+	})
+
+	t.Run("fill out of bounds", func(t *testing.T) {
+		tr := terrain.New(5, 2)
+		if err := tr.Fill(2, 5, terrain.Solid); err == nil {
+			t.Errorf("Fill() expected error for out of bounds coordinates")
+		}
+	})
+}
+
+func TestTerrain_Walk(t *testing.T) {
+	tr := terrain.New(3, 2)
+	want := []point.P{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 1}}
+	var got []point.P
+	for s := range tr.Walk() {
+		got = append(got, point.New(s.X, s.Y))
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Walk() yielded %d steps, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("Walk() step %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTerrain_Traversable(t *testing.T) {
+	tr := terrain.New(3, 1)
+	if err := tr.Fill(2, 0, terrain.Solid); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		p    point.P
+		d    direction.Direction
+		want bool
+	}{
+		{name: "open neighbor", p: point.New(0, 0), d: direction.East, want: true},
+		{name: "solid neighbor", p: point.New(1, 0), d: direction.East, want: false},
+		{name: "out of bounds", p: point.New(0, 0), d: direction.South, want: false},
+		{name: "start out of bounds", p: point.New(-1, 0), d: direction.East, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tr.Traversable(tt.p, tt.d); got != tt.want {
+				t.Errorf("Traversable(%v, %v) = %v, want %v", tt.p, tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerrain_Material(t *testing.T) {
+	tr := terrain.New(3, 1)
+	if got := tr.Material(0, 0); got != terrain.Stone {
+		t.Errorf("Material() of a new terrain = %v, want %v", got, terrain.Stone)
+	}
+	if err := tr.SetMaterial(1, 0, terrain.ShallowWater); err != nil {
+		t.Fatalf("SetMaterial() error = %v", err)
+	}
+	if err := tr.SetMaterial(2, 0, terrain.DeepWater); err != nil {
+		t.Fatalf("SetMaterial() error = %v", err)
+	}
+	if err := tr.SetMaterial(3, 0, terrain.Sand); err == nil {
+		t.Errorf("SetMaterial() expected error for out of bounds coordinates")
+	}
+
+	if got, want := tr.MoveCost(point.New(1, 0)), terrain.ShallowWater.Cost(); got != want {
+		t.Errorf("MoveCost() = %v, want %v", got, want)
+	}
+	if !tr.Traversable(point.New(0, 0), direction.East) {
+		t.Errorf("Traversable() into shallow water = false, want true")
+	}
+	if tr.Traversable(point.New(1, 0), direction.East) {
+		t.Errorf("Traversable() into deep water = true, want false")
+	}
+}
+
+func TestTerrain_ChangeEvents(t *testing.T) {
+	var (
+		single  []*terrain.CellChangedEvent
+		batched []*terrain.CellsChangedEvent
+	)
+	opts := []terrain.Option{
+		terrain.WithEmitCellChangedEvent(func(e *terrain.CellChangedEvent) { single = append(single, e) }),
+		terrain.WithEmitCellsChangedEvent(func(e *terrain.CellsChangedEvent) { batched = append(batched, e) }),
+	}
+
+	t.Run("fill emits a change", func(t *testing.T) {
+		single, batched = nil, nil
+		tr := terrain.New(3, 3, opts...)
+		if err := tr.Fill(1, 2, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if err := tr.Fill(1, 2, terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if len(single) != 1 {
+			t.Fatalf("got %d events, want 1", len(single))
+		}
+		want := terrain.CellChangedEvent{X: 1, Y: 2, Old: 0, New: terrain.Solid}
+		if *single[0] != want {
+			t.Errorf("event = %+v, want %+v", *single[0], want)
+		}
+	})
+
+	t.Run("material change emits a change", func(t *testing.T) {
+		single, batched = nil, nil
+		tr := terrain.New(3, 3, opts...)
+		if err := tr.SetMaterial(0, 0, terrain.Sand); err != nil {
+			t.Fatalf("SetMaterial() error = %v", err)
+		}
+		if len(single) != 1 || single[0].NewMaterial != terrain.Sand {
+			t.Errorf("events = %v, want a single change to sand", single)
+		}
+	})
+
+	t.Run("batch emits a single event", func(t *testing.T) {
+		single, batched = nil, nil
+		tr := terrain.New(3, 3, opts...)
+		err := tr.Batch(func() error {
+			for s := range tr.Walk() {
+				if err := tr.Fill(s.X, s.Y, terrain.Solid); err != nil {
+					return err
+				}
+			}
+			// changed back, so it is not part of the batch
+			return tr.Fill(0, 0, 0)
+		})
+		if err != nil {
+			t.Fatalf("Batch() error = %v", err)
+		}
+		if len(single) != 0 {
+			t.Errorf("got %d single events during a batch, want 0", len(single))
+		}
+		if len(batched) != 1 {
+			t.Fatalf("got %d batch events, want 1", len(batched))
+		}
+		if len(batched[0].Changes) != 8 {
+			t.Errorf("batch has %d changes, want 8", len(batched[0].Changes))
+		}
+	})
+
+	t.Run("stack levels emit their level", func(t *testing.T) {
+		single, batched = nil, nil
+		s := terrain.NewStack(2, 2, 2, opts...)
+		if err := s.Fill(point.New3(1, 1, 1), terrain.Solid); err != nil {
+			t.Fatalf("Fill() error = %v", err)
+		}
+		if len(single) != 1 || single[0].Z != 1 {
+			t.Errorf("events = %v, want a single change on level 1", single)
+		}
+	})
+}
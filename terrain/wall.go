@@ -0,0 +1,139 @@
+package terrain
+
+import (
+	"fmt"
+
+	"github.com/dwethmar/apostle/direction"
+)
+
+// Borders are the flags of the four walls around a cell. A Terrain does not
+// store them in its cells: every wall is stored once on the edge between two
+// cells, and the Border flags of a cell are derived from the edges around it.
+const Borders = BorderNorth | BorderSouth | BorderWest | BorderEast
+
+// wallFlags are the Border flags of the sides of a cell.
+var wallFlags = map[direction.Direction]Cell{
+	direction.North: BorderNorth,
+	direction.South: BorderSouth,
+	direction.West:  BorderWest,
+	direction.East:  BorderEast,
+}
+
+// wallEdge returns where the wall on the given side of the cell at (x, y)
+// is stored. Edges between two cells are shared by both cells, edges on the
+// outside of the terrain belong to a single cell.
+func (t *Terrain) wallEdge(x, y int, side direction.Direction) (walls []bool, i int, ok bool) {
+	if !t.InBounds(x, y) {
+		return nil, 0, false
+	}
+	switch side {
+	case direction.North:
+		return t.northWalls, y*t.width + x, true
+	case direction.South:
+		return t.northWalls, (y+1)*t.width + x, true
+	case direction.West:
+		return t.westWalls, y*(t.width+1) + x, true
+	case direction.East:
+		return t.westWalls, y*(t.width+1) + x + 1, true
+	}
+	return nil, 0, false
+}
+
+// Wall reports whether there is a wall on the given side (North, South, East
+// or West) of the cell at (x, y).
+func (t *Terrain) Wall(x, y int, side direction.Direction) bool {
+	walls, i, ok := t.wallEdge(x, y, side)
+	return ok && walls[i]
+}
+
+// SetWall puts or removes the wall on the given side of the cell at (x, y).
+// The neighbor on the other side of the edge shares the wall, so both cells
+// are reported as changed.
+func (t *Terrain) SetWall(x, y int, side direction.Direction, wall bool) error {
+	walls, i, ok := t.wallEdge(x, y, side)
+	if !ok {
+		return fmt.Errorf("no edge on side %d of (%d, %d) in (%d, %d)", side, x, y, t.width, t.height)
+	}
+	if walls[i] == wall {
+		return nil
+	}
+	before := t.snapshot(x, y)
+	walls[i] = wall
+	t.changedAround(x, y, before)
+	return nil
+}
+
+// AddWalls puts a wall on every side of the cell at (x, y) that has a Border
+// flag in cell. Walls on the other sides are left as they are.
+func (t *Terrain) AddWalls(x, y int, cell Cell) error {
+	for side, flag := range wallFlags {
+		if cell&flag == 0 {
+			continue
+		}
+		if err := t.SetWall(x, y, side, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// borders returns the Border flags of the cell at (x, y) from the walls
+// around it. The caller is responsible for checking the bounds.
+func (t *Terrain) borders(x, y int) Cell {
+	// the edges are read directly, this is on the path of every move
+	var cell Cell
+	if t.northWalls[y*t.width+x] {
+		cell |= BorderNorth
+	}
+	if t.northWalls[(y+1)*t.width+x] {
+		cell |= BorderSouth
+	}
+	if t.westWalls[y*(t.width+1)+x] {
+		cell |= BorderWest
+	}
+	if t.westWalls[y*(t.width+1)+x+1] {
+		cell |= BorderEast
+	}
+	return cell
+}
+
+// neighborhood is the offset of a cell and the cells it shares an edge with.
+var neighborhood = [5][2]int{{0, 0}, {0, -1}, {0, 1}, {1, 0}, {-1, 0}}
+
+// snapshot returns the cells around (x, y) before a change of the walls
+// around it, see changedAround.
+func (t *Terrain) snapshot(x, y int) [5]Cell {
+	var cells [5]Cell
+	for k, o := range neighborhood {
+		cells[k], _ = t.Cell(x+o[0], y+o[1])
+	}
+	return cells
+}
+
+// changedAround records or emits the changes of the cells around (x, y)
+// since the snapshot was taken.
+func (t *Terrain) changedAround(x, y int, before [5]Cell) {
+	for k, o := range neighborhood {
+		nx, ny := x+o[0], y+o[1]
+		if after, ok := t.Cell(nx, ny); ok {
+			m := t.materials[t.index(nx, ny)]
+			t.changed(nx, ny, before[k], after, m, m)
+		}
+	}
+}
+
+// legacyWalls converts cells in which both sides of an edge carried their
+// own Border flag to walls on the edges of a w by h terrain. An edge has a
+// wall when the cell on either side of it has the flag.
+func legacyWalls(cells []byte, w, h int) (north, west []bool) {
+	north, west = make([]bool, w*(h+1)), make([]bool, (w+1)*h)
+	for i, c := range cells {
+		x, y := i%w, i/w
+		cell := Cell(c)
+		north[y*w+x] = north[y*w+x] || cell&BorderNorth != 0
+		north[(y+1)*w+x] = north[(y+1)*w+x] || cell&BorderSouth != 0
+		west[y*(w+1)+x] = west[y*(w+1)+x] || cell&BorderWest != 0
+		west[y*(w+1)+x+1] = west[y*(w+1)+x+1] || cell&BorderEast != 0
+	}
+	return north, west
+}
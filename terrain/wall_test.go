@@ -0,0 +1,76 @@
+package terrain_test
+
+import (
+	"testing"
+
+	"github.com/dwethmar/apostle/direction"
+	"github.com/dwethmar/apostle/point"
+	"github.com/dwethmar/apostle/terrain"
+)
+
+func TestTerrain_Wall(t *testing.T) {
+	var events []*terrain.CellChangedEvent
+	tr := terrain.New(2, 2, terrain.WithEmitCellChangedEvent(func(e *terrain.CellChangedEvent) { events = append(events, e) }))
+	if err := tr.SetWall(0, 0, direction.East, true); err != nil {
+		t.Fatalf("SetWall() error = %v", err)
+	}
+	if !tr.Wall(1, 0, direction.West) || !tr.HasFlag(1, 0, terrain.BorderWest) {
+		t.Errorf("wall is not shared with the neighbor")
+	}
+	if len(events) != 2 {
+		t.Errorf("got %d events, want one for each side of the wall", len(events))
+	}
+	if err := tr.SetWall(0, 0, direction.NorthEast, true); err == nil {
+		t.Errorf("SetWall() expected error for a diagonal side")
+	}
+
+	// filling a cell adds the walls its borders name and keeps the others,
+	// which its neighbors share
+	if err := tr.Fill(1, 0, terrain.BorderSouth); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	if !tr.Wall(0, 0, direction.East) || !tr.Wall(1, 1, direction.North) {
+		t.Errorf("Fill() did not keep the neighbor's wall and add its own")
+	}
+	if got, want := tr.Walls(1, 1), []terrain.Cell{terrain.BorderNorth}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Walls() = %v, want %v", got, want)
+	}
+	if err := tr.Fill(1, 0, 0); err != nil {
+		t.Fatalf("Fill() error = %v", err)
+	}
+	if !tr.Wall(0, 0, direction.East) || !tr.Wall(1, 1, direction.North) {
+		t.Errorf("Fill() without borders removed walls around the cell")
+	}
+}
+
+func TestTerrain_TraversableDiagonalWalls(t *testing.T) {
+	// every wall that meets at the corner between (0, 0) and (1, 1) blocks
+	// the diagonal move across it, in both directions
+	tests := []struct {
+		name string
+		x, y int
+		side direction.Direction
+	}{
+		{name: "north of the target", x: 1, y: 1, side: direction.North},
+		{name: "west of the target", x: 1, y: 1, side: direction.West},
+		{name: "south of the start", x: 0, y: 0, side: direction.South},
+		{name: "east of the start", x: 0, y: 0, side: direction.East},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := terrain.New(2, 2)
+			if !tr.Traversable(point.New(0, 0), direction.SouthEast) {
+				t.Fatalf("Traversable() without walls = false, want true")
+			}
+			if err := tr.SetWall(tt.x, tt.y, tt.side, true); err != nil {
+				t.Fatalf("SetWall() error = %v", err)
+			}
+			if tr.Traversable(point.New(0, 0), direction.SouthEast) {
+				t.Errorf("Traversable() = true, want false")
+			}
+			if tr.Traversable(point.New(1, 1), direction.NorthWest) {
+				t.Errorf("Traversable() back = true, want false")
+			}
+		})
+	}
+}